@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+// defaultAnalyticsRange is the range of the reports without ?from=
+const defaultAnalyticsRange = time.Hour * 24 * 30
+
+// analyticsWriter saves the query events in the background, so that the answers never wait for postgres
+type analyticsWriter struct {
+	events chan *store.QueryEvent
+	done   chan struct{}
+}
+
+type UnusedChaptersResponse struct {
+	Chapters []store.ChapterRef `json:"chapters"`
+}
+
+// recordQueryEvent queues an event for the writer, it is dropped when the buffer is full
+func (app *application) recordQueryEvent(event *store.QueryEvent) {
+	if app.analytics == nil {
+		return
+	}
+	select {
+	case app.analytics.events <- event:
+	default:
+		app.logger.Warnw("analytics buffer is full, query event dropped", "knowledge_base", event.KnowledgeBase)
+	}
+}
+
+func (app *application) startAnalyticsWriter() {
+	app.analytics = &analyticsWriter{
+		events: make(chan *store.QueryEvent, max(app.config.analytics.bufferSize, 1)),
+		done:   make(chan struct{}),
+	}
+	go app.analyticsWriterLoop()
+}
+
+// stopAnalyticsWriter saves the events still in the buffer before returning
+func (app *application) stopAnalyticsWriter() {
+	close(app.analytics.events)
+	<-app.analytics.done
+}
+
+func (app *application) analyticsWriterLoop() {
+	defer close(app.analytics.done)
+
+	ticker := time.NewTicker(app.config.analytics.flushInterval)
+	defer ticker.Stop()
+
+	batchSize := max(app.config.analytics.batchSize, 1)
+	batch := make([]*store.QueryEvent, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		// the writer keeps going when postgres is down, the events of the batch are lost
+		if err := app.postgreStore.Analytics.CreateBatch(context.Background(), batch); err != nil {
+			app.logger.Errorw("error saving query events", "events", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case event, ok := <-app.analytics.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// queryEvent builds the event of a question, the retrieved documents are the chapters of the context
+func queryEvent(r *http.Request, question string, standaloneQuestion string, hits []*store.RetrievalHit, answer string, started time.Time) *store.QueryEvent {
+	event := &store.QueryEvent{
+		KnowledgeBase:      getKnowledgeBaseFromCtx(r).Name,
+		Tenant:             getTenantFromCtx(r).Name,
+		ConversationID:     r.Header.Get("X-User-ID"),
+		Question:           question,
+		StandaloneQuestion: standaloneQuestion,
+		Retrieved:          []store.RetrievedObject{},
+		InsufficientInfo:   len(hits) == 0 || strings.Contains(answer, insufficientInfoAnswer),
+		LatencyMs:          time.Since(started).Milliseconds(),
+		CreatedAt:          started,
+	}
+	if principal := getPrincipalFromCtx(r); principal != nil {
+		event.UserID = principal.UserID
+	}
+	if conversationID := r.Header.Get("X-Conversation-ID"); conversationID != "" {
+		event.ConversationID = conversationID
+	}
+	for _, hit := range hits {
+		event.Retrieved = append(event.Retrieved, store.RetrievedObject{
+			ID:       hit.ID,
+			Chapter:  hit.Document.Chapter,
+			Rank:     hit.Rank,
+			Score:    hit.Score,
+			Distance: hit.Distance,
+		})
+	}
+	return event
+}
+
+// analyticsRangeFromQuery reads ?from= and ?to= (RFC 3339, the last 30 days by default) and ?limit=
+func analyticsRangeFromQuery(r *http.Request) (store.AnalyticsRange, error) {
+	params := r.URL.Query()
+	analyticsRange := store.AnalyticsRange{
+		KnowledgeBase: getKnowledgeBaseFromCtx(r).Name,
+		Tenant:        getTenantFromCtx(r).Name,
+		To:            time.Now(),
+	}
+	if value := params.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return analyticsRange, fmt.Errorf("invalid to value: %w", err)
+		}
+		analyticsRange.To = to
+	}
+	analyticsRange.From = analyticsRange.To.Add(-defaultAnalyticsRange)
+	if value := params.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return analyticsRange, fmt.Errorf("invalid from value: %w", err)
+		}
+		analyticsRange.From = from
+	}
+	if !analyticsRange.From.Before(analyticsRange.To) {
+		return analyticsRange, ErrorInvalidTimeRange
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return analyticsRange, fmt.Errorf("invalid limit value: %w", err)
+		}
+		analyticsRange.Limit = limit
+	}
+	return analyticsRange, nil
+}
+
+// topQuestionsHandler returns the questions asked the most to the knowledge base
+func (app *application) topQuestionsHandler(w http.ResponseWriter, r *http.Request) {
+	analyticsRange, err := analyticsRangeFromQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	questions, err := app.postgreStore.Analytics.TopQuestions(r.Context(), analyticsRange)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, questions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// topChaptersHandler returns the chapters retrieved the most to answer the questions
+func (app *application) topChaptersHandler(w http.ResponseWriter, r *http.Request) {
+	analyticsRange, err := analyticsRangeFromQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	hidden, err := app.hiddenChapterIDs(ctx, getCollectionFromCtx(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	chapters, err := app.postgreStore.Analytics.TopChapters(ctx, analyticsRange, hidden)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, chapters); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// hiddenChapterIDs returns the ids of the chapters of the knowledge base that the reader of the collection can not read
+func (app *application) hiddenChapterIDs(ctx context.Context, collection store.Collection) ([]string, error) {
+	// the export only walks the chapters of its reader, all of them are needed to find the others
+	unrestricted := collection
+	unrestricted.Reader = nil
+
+	var hidden []string
+	err := app.weaviateStore.Vectors.ExportObjects(ctx, unrestricted, false, func(obj *store.ExportedObject) error {
+		if !obj.Access.Allows(collection.Reader) {
+			hidden = append(hidden, obj.ID)
+		}
+		return nil
+	})
+	return hidden, err
+}
+
+// unusedChaptersHandler returns the chapters of the knowledge base that were never retrieved in the range
+func (app *application) unusedChaptersHandler(w http.ResponseWriter, r *http.Request) {
+	analyticsRange, err := analyticsRangeFromQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	retrieved, err := app.postgreStore.Analytics.RetrievedChapterIDs(ctx, analyticsRange)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	collection := getCollectionFromCtx(r)
+	response := UnusedChaptersResponse{Chapters: []store.ChapterRef{}}
+	err = app.weaviateStore.Vectors.ExportObjects(ctx, collection, false, func(obj *store.ExportedObject) error {
+		if !retrieved[obj.ID] && obj.Access.Allows(collection.Reader) {
+			response.Chapters = append(response.Chapters, store.ChapterRef{
+				ID:        obj.ID,
+				Chapter:   obj.Chapter,
+				Source:    obj.Source,
+				CreatedAt: obj.CreatedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/mik-dmi/rag_chatbot/backend/internal/auth"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/embedding"
 	"github.com/mik-dmi/rag_chatbot/backend/internal/mailer"
 	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
 	"github.com/tmc/langchaingo/llms/openai"
@@ -28,6 +29,10 @@ type application struct {
 	logger        *zap.SugaredLogger
 	authenticator auth.Authenticator
 	mailer        mailer.MailtrapClient
+	ingestion     *ingestionWorkers
+	analytics     *analyticsWriter
+	gapReports    *gapReporter
+	embedder      embedding.Embedder // clusters the unanswered questions and matches the faq questions when they are enabled
 }
 type OpenaiClients struct {
 	standaloneChainClient *openai.LLM
@@ -35,7 +40,9 @@ type OpenaiClients struct {
 }
 type config struct {
 	addr               string
+	vectorBackend      string
 	weaviateDB         weaviateDBConfig
+	memoryDB           memoryDBConfig
 	redisDB            redisDBConfig
 	postgresDB         postgresDBConfig
 	env                string
@@ -44,6 +51,70 @@ type config struct {
 	authCredencials    authConfig
 	mail               mailConfig
 	frontendURL        string
+	chunking           chunkingConfig
+	embedding          embeddingConfig
+	ingestion          ingestionConfig
+	duplicates         duplicatesConfig
+	analytics          analyticsConfig
+	gapReport          gapReportConfig
+	retrieval          retrievalConfig
+	faq                faqConfig
+}
+
+type faqConfig struct {
+	enabled   bool    // the faqs need an embedding provider, the hashing embedder only matches the same words
+	threshold float64 // cosine similarity from which a question gets the approved answer of a faq variant
+}
+
+type retrievalConfig struct {
+	mode       string  // search of the /search endpoint: vector, hybrid or keyword
+	limit      int     // chunks in the context of an answer
+	candidates int     // closest chunks the context is picked from
+	mmrLambda  float64 // 1 keeps the closest chunks, lower values favor chunks unlike the ones already picked
+}
+
+type gapReportConfig struct {
+	threshold     float32 // cosine similarity from which two questions are in the same cluster
+	interval      time.Duration
+	checkInterval time.Duration // how often the instances check if the report is due
+	cacheTTL      time.Duration // how long the reports returned by the api are reused
+}
+
+type analyticsConfig struct {
+	bufferSize    int // events waiting to be saved, the new ones are dropped when it is full
+	batchSize     int
+	flushInterval time.Duration
+}
+
+// duplicatesConfig is the screening of the ingested documents against the chapters already indexed
+type duplicatesConfig struct {
+	policy    store.DuplicatePolicy // used when the request has no ?duplicates= param
+	threshold float32               // cosine similarity from which two chapters are copies
+}
+
+type ingestionConfig struct {
+	workers     int
+	batchSize   int
+	maxAttempts int
+	// batchTimeout bounds the indexing of a batch of chapters, embeddings included
+	batchTimeout time.Duration
+	pollInterval time.Duration
+	// leaseDuration is how long a job stays claimed by an instance that stopped renewing it
+	leaseDuration time.Duration
+}
+
+type embeddingConfig struct {
+	provider   string
+	model      string
+	apiKey     string
+	baseURL    string
+	dimensions int
+	cacheSize  int
+}
+
+type chunkingConfig struct {
+	size    int
+	overlap int
 }
 
 type mailConfig struct {
@@ -78,6 +149,10 @@ type llmConfig struct {
 	token string
 	model string
 }
+type memoryDBConfig struct {
+	snapshotPath string
+}
+
 type weaviateDBConfig struct {
 	addr string
 	host string
@@ -109,14 +184,49 @@ func (app *application) mount() http.Handler {
 
 	})
 
+	// organizations are managed with the client credentials, not with the tokens of their users
+	router.Route("/v1/tenants", func(r chi.Router) {
+		r.Use(middleware.BasicAuth("tenants", map[string]string{
+			app.config.authCredencials.authCredencials.clientID: app.config.authCredencials.authCredencials.password,
+		}))
+		r.Get("/", app.listTenantsHandler)
+		r.Post("/", app.createTenantHandler)
+
+		r.Route("/{tenantName}", func(r chi.Router) {
+			r.Use(app.tenantNameMiddleware)
+			r.Put("/activate", app.activateTenantHandler)
+			r.Put("/deactivate", app.deactivateTenantHandler)
+			r.Put("/gap-report-emails", app.setGapReportEmailsHandler)
+			r.Delete("/", app.deleteTenantHandler)
+		})
+	})
+
 	router.Route("/v1", func(r chi.Router) {
 
 		r.Use(app.AuthTokenMiddleware)
 
-		r.Post("/vector-db", app.createVectorHandler)
-		r.Get("/vector-db/object", app.getObjectIDByChapterHandler)
-		r.Delete("/vector-db/object/{id}", app.deleteVectorObjectByIdHandler)
-		r.Patch("/vector-db/object/{id}", app.updateVectorObjectByIdHandler)
+		r.Get("/vector-db/jobs/{id}", app.getIngestionJobHandler)
+
+		// the routes without a knowledge base in the path work on the default one
+		r.Group(func(r chi.Router) {
+			r.Use(app.knowledgeBaseContextMiddleware)
+			app.mountKnowledgeBaseRoutes(r)
+		})
+
+		r.Route("/knowledge-bases", func(r chi.Router) {
+			r.Get("/", app.listKnowledgeBasesHandler)
+			r.With(app.requireAdminMiddleware).Post("/", app.createKnowledgeBaseHandler)
+
+			r.Route("/{kbName}", func(r chi.Router) {
+				r.Use(app.knowledgeBaseContextMiddleware)
+				r.Get("/", app.getKnowledgeBaseHandler)
+				r.With(app.requireAdminMiddleware).Patch("/", app.updateKnowledgeBaseHandler)
+				r.With(app.requireAdminMiddleware).Delete("/", app.deleteKnowledgeBaseHandler)
+
+				r.Post("/query", app.userQuestionHandler)
+				app.mountKnowledgeBaseRoutes(r)
+			})
+		})
 
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
@@ -125,7 +235,7 @@ func (app *application) mount() http.Handler {
 				r.Use(app.AuthTokenMiddleware)
 				r.Get("/", app.getUserHandler)
 
-				r.Post("/query", app.userQuestionHandler)
+				r.With(app.knowledgeBaseContextMiddleware).Post("/query", app.userQuestionHandler)
 				//r.Post("/create-user", app.createUserHandler)
 
 			})
@@ -163,6 +273,13 @@ func (app *application) Run(mux http.Handler) error {
 		shutdown <- srv.Shutdown(ctx)
 	}()
 
+	app.startIngestionWorkers()
+	defer app.stopIngestionWorkers()
+	app.startAnalyticsWriter()
+	defer app.stopAnalyticsWriter()
+	app.startGapReports()
+	defer app.stopGapReports()
+
 	app.logger.Infow("server has started", "addr", app.config.addr, "env", app.config.env)
 
 	err := srv.ListenAndServe()
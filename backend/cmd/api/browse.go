@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+type ChapterResponse struct {
+	ID string `json:"id"`
+	store.Document
+}
+
+// listChaptersHandler returns a page of the chapters of the knowledge base.
+// ?limit=20&cursor=...&sort=chapter|created_at|updated_at&order=asc|desc, the metadata query params
+// (product, version, language, audience and tags, comma separated) filter the chapters like the queries.
+// The weaviate backend pages with ?offset= and next_offset instead of ?cursor= and next_cursor.
+func (app *application) listChaptersHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := store.ChapterListQuery{
+		Cursor: params.Get("cursor"),
+		Sort:   params.Get("sort"),
+		Filter: metadataFilterFromQuery(r),
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid limit value: %w", err))
+			return
+		}
+		query.Limit = limit
+	}
+	if value := params.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid offset value: %w", err))
+			return
+		}
+		query.Offset = offset
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		app.badRequestError(w, r, ErrorUnknownSortOrder)
+		return
+	}
+
+	page, err := app.weaviateStore.Vectors.ListChapters(r.Context(), getCollectionFromCtx(r), query)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor), errors.Is(err, store.ErrUnknownSortName),
+			errors.Is(err, store.ErrOffsetPaging), errors.Is(err, store.ErrCursorPaging):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// getChapterHandler returns a chapter with all its subsections
+func (app *application) getChapterHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	document, err := app.weaviateStore.Vectors.GetObjectWithID(r.Context(), getCollectionFromCtx(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, ChapterResponse{ID: id, Document: *document}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// searchChapterTitlesHandler searches the keywords of ?q= in the titles of the chapters and subsections, ?limit=20
+func (app *application) searchChapterTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	keywords := r.URL.Query().Get("q")
+	if keywords == "" {
+		app.badRequestError(w, r, ErrorMissingSearchQuery)
+		return
+	}
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid limit value: %w", err))
+			return
+		}
+		limit = parsed
+	}
+
+	matches, err := app.weaviateStore.Vectors.SearchTitles(r.Context(), getCollectionFromCtx(r), keywords, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, matches); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// chapterFacetsHandler counts the chapters for every value of the metadata fields
+func (app *application) chapterFacetsHandler(w http.ResponseWriter, r *http.Request) {
+	facets, err := app.weaviateStore.Vectors.CountFacets(r.Context(), getCollectionFromCtx(r))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, facets); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// metadataFilterFromQuery reads a metadata filter from the query params, every field is a comma separated list
+func metadataFilterFromQuery(r *http.Request) *store.MetadataFilter {
+	filter := &store.MetadataFilter{
+		Product:  formList(r, "product"),
+		Version:  formList(r, "version"),
+		Language: formList(r, "language"),
+		Audience: formList(r, "audience"),
+		Tags:     formList(r, "tags"),
+	}
+	if filter.IsEmpty() {
+		return nil
+	}
+	return filter
+}
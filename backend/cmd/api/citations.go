@@ -0,0 +1,83 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+// Citation is a subsection the answer was generated from, with the deep link to it when its chapter has a url
+type Citation struct {
+	ID         string   `json:"id"` // id of the chapter object
+	Chapter    string   `json:"chapter"`
+	Title      string   `json:"title"`
+	URL        string   `json:"url,omitempty"`
+	Breadcrumb []string `json:"breadcrumb,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Pages      []int    `json:"pages,omitempty"`
+	Rank       int      `json:"rank"`              // rank of the chapter in the context
+	Score      float64  `json:"score"`             // score of the best chunk of the chapter
+	Matched    bool     `json:"matched,omitempty"` // the best chunk of the chapter is in this subsection
+}
+
+// markdown links, [text](url "title"), and the bare or <autolinked> urls without the punctuation that ends a sentence
+var answerLinkRegex = regexp.MustCompile(`\[([^\]]*)\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)|<?(https?://[^\s)\]>]*[^\s)\]>.,;:!?])>?`)
+
+func citationsFromHits(hits []*store.RetrievalHit) []Citation {
+	citations := []Citation{}
+	for _, hit := range hits {
+		document := hit.Document
+		for i, subsection := range document.Subsections {
+			citations = append(citations, Citation{
+				ID:         hit.ID,
+				Chapter:    document.Chapter,
+				Title:      subsection.Title,
+				URL:        document.SubsectionURL(i),
+				Breadcrumb: document.SubsectionBreadcrumb(i),
+				Source:     document.Source,
+				Pages:      subsection.Pages,
+				Rank:       hit.Rank,
+				Score:      hit.Score,
+				Matched:    i == hit.MatchedSubsection,
+			})
+		}
+	}
+	return citations
+}
+
+// sanitizeAnswerLinks removes from the answer the links that do not point at the url of a retrieved chapter,
+// the markdown links are replaced by their text. It returns the answer and the urls that were removed.
+func sanitizeAnswerLinks(answer string, documents []*store.Document) (string, []string) {
+	known := make(map[string]bool)
+	for _, document := range documents {
+		if document.URL != "" {
+			known[linkBase(document.URL)] = true
+		}
+	}
+
+	var removed []string
+	sanitized := answerLinkRegex.ReplaceAllStringFunc(answer, func(match string) string {
+		groups := answerLinkRegex.FindStringSubmatch(match)
+		text, url := groups[1], groups[2]
+		if url == "" {
+			url = groups[3]
+		}
+		// any anchor of a known page is accepted
+		if known[linkBase(url)] {
+			return match
+		}
+		removed = append(removed, url)
+		if groups[2] != "" {
+			return text
+		}
+		return ""
+	})
+	return sanitized, removed
+}
+
+// linkBase returns the url without its fragment and trailing slash
+func linkBase(url string) string {
+	base, _, _ := strings.Cut(url, "#")
+	return strings.TrimSuffix(base, "/")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+func TestSanitizeAnswerLinks(t *testing.T) {
+	documents := []*store.Document{
+		{Chapter: "Install", URL: "https://docs.example.com/install/"},
+		{Chapter: "No url"},
+	}
+
+	tests := []struct {
+		name        string
+		answer      string
+		want        string
+		wantRemoved []string
+	}{
+		{
+			name:        "links to retrieved chapters are kept",
+			answer:      "See [the install guide](https://docs.example.com/install#linux).",
+			want:        "See [the install guide](https://docs.example.com/install#linux).",
+			wantRemoved: nil,
+		},
+		{
+			name:        "unknown markdown links are replaced by their text",
+			answer:      `See [this page](https://evil.example.com/x "title") now.`,
+			want:        "See this page now.",
+			wantRemoved: []string{"https://evil.example.com/x"},
+		},
+		{
+			name:        "unknown bare urls are removed without the ending punctuation",
+			answer:      "Go to https://other.example.com/page. Then https://docs.example.com/install/.",
+			want:        "Go to . Then https://docs.example.com/install/.",
+			wantRemoved: []string{"https://other.example.com/page"},
+		},
+		{
+			name:        "unknown autolinks are removed",
+			answer:      "Read <https://other.example.com>",
+			want:        "Read ",
+			wantRemoved: []string{"https://other.example.com"},
+		},
+		{
+			name:        "answers without links are unchanged",
+			answer:      "Run the installer.",
+			want:        "Run the installer.",
+			wantRemoved: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, removed := sanitizeAnswerLinks(tt.answer, documents)
+			if got != tt.want {
+				t.Errorf("sanitizeAnswerLinks() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("sanitizeAnswerLinks() removed %q, want %q", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
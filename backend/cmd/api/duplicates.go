@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+	"go.uber.org/zap"
+)
+
+type DuplicateClustersResponse struct {
+	Threshold float32                   `json:"threshold"`
+	Clusters  []*store.DuplicateCluster `json:"clusters"`
+}
+
+// duplicatePolicyFromQuery reads the ?duplicates= param, the DUPLICATE_POLICY of the config when it is not set
+func (app *application) duplicatePolicyFromQuery(r *http.Request) (store.DuplicatePolicy, error) {
+	return store.ParseDuplicatePolicy(r.URL.Query().Get("duplicates"), app.config.duplicates.policy)
+}
+
+// duplicateDecision is what the duplicate policy did with a document
+type duplicateDecision struct {
+	duplicateOf string // id of the indexed chapter the document copies
+	indexed     bool   // false when the document was rejected or merged in another one
+	err         string // why the document was rejected or could not be merged
+}
+
+// screenDocuments applies a duplicate policy to documents about to be indexed, the merged chapters are updated
+// right away. The documents are also compared with each other, the tags of a copy are merged in the document it copies.
+func (app *application) screenDocuments(ctx context.Context, logger *zap.SugaredLogger, collection store.Collection, policy store.DuplicatePolicy, scope versionScope, userID string, docs []store.Document) []duplicateDecision {
+	decisions := make([]duplicateDecision, len(docs))
+	for i := range decisions {
+		decisions[i].indexed = true
+	}
+	if policy == store.DuplicateOff || policy == "" {
+		return decisions
+	}
+
+	keptHashes := make(map[string]int)
+	for i, doc := range docs {
+		// copies of a document of the same batch are not indexed yet, only their text can match
+		hash := store.TextHash(doc)
+		if original, ok := keptHashes[hash]; ok && hash != "" && policy != store.DuplicateFlag {
+			decisions[i].indexed = false
+			if policy == store.DuplicateReject {
+				decisions[i].err = fmt.Sprintf("%s: same text as chapter %s of the batch", store.ErrDuplicateDocument, docs[original].Chapter)
+			} else {
+				docs[original].Metadata = mergeMetadataTags(docs[original].Metadata, doc.Metadata)
+			}
+			continue
+		}
+
+		matches, err := app.weaviateStore.Vectors.FindDuplicates(ctx, collection, doc, app.config.duplicates.threshold)
+		if err != nil {
+			// the screening is best effort, the chapter is indexed as if it had no copy
+			logger.Warnw("error looking up duplicates of chapter", "chapter", doc.Chapter, "error", err)
+		}
+		// a chapter uploaded again under the same name is not a copy, the upsert handles it
+		matches = slices.DeleteFunc(matches, func(match store.DuplicateMatch) bool { return match.Chapter == doc.Chapter })
+		if len(matches) == 0 {
+			keptHashes[hash] = i
+			continue
+		}
+
+		match := matches[0]
+		decisions[i].duplicateOf = match.ID
+		logger.Infow("duplicate chapter found", "chapter", doc.Chapter,
+			"duplicate_of", match.Chapter, "similarity", match.Similarity, "policy", policy)
+
+		switch policy {
+		case store.DuplicateReject:
+			decisions[i].indexed = false
+			decisions[i].err = fmt.Sprintf("%s: copy of chapter %s (similarity %.3f)", store.ErrDuplicateDocument, match.Chapter, match.Similarity)
+		case store.DuplicateMerge:
+			decisions[i].indexed = false
+			if err := app.mergeDuplicate(ctx, collection, scope, userID, match.ID, doc); err != nil {
+				decisions[i].err = fmt.Sprintf("error merging in chapter %s: %s", match.Chapter, err)
+			}
+		default:
+			keptHashes[hash] = i
+		}
+	}
+	return decisions
+}
+
+// screenDuplicates applies the duplicate policy of the job to a batch of chapters and returns the ones to index.
+// The rejected and merged chapters are saved right away.
+func (app *application) screenDuplicates(ctx context.Context, collection store.Collection, job *store.IngestionJob, batch []store.IngestionJobChapter) []store.IngestionJobChapter {
+	docs := make([]store.Document, len(batch))
+	for i, chapter := range batch {
+		docs[i] = chapter.Document
+	}
+	// the chapters are only compared with the ones the user who queued them can read
+	collection.Reader = job.Principal()
+	scope := versionScope{knowledgeBase: job.KnowledgeBase, tenant: job.Tenant}
+	decisions := app.screenDocuments(ctx, app.logger.With("job_id", job.JobID), collection, job.DuplicatePolicy, scope, job.UserID, docs)
+
+	var kept []store.IngestionJobChapter
+	for i, chapter := range batch {
+		chapter.Document = docs[i]
+		if decisions[i].duplicateOf != "" {
+			chapter.DuplicateOf = decisions[i].duplicateOf
+		}
+		if decisions[i].indexed {
+			kept = append(kept, chapter)
+			continue
+		}
+
+		chapter.Attempts++
+		if decisions[i].err != "" {
+			chapter.Status = store.JobChapterStatusFailed
+			chapter.Error = decisions[i].err
+		} else {
+			chapter.Status = store.JobChapterStatusDone
+			chapter.Error = ""
+		}
+		app.saveIngestionChapter(ctx, job, &chapter)
+	}
+	return kept
+}
+
+// mergeDuplicate adds the tags of a document to the chapter it copies, the chapter is only updated when it gains some
+func (app *application) mergeDuplicate(ctx context.Context, collection store.Collection, scope versionScope, userID string, id string, doc store.Document) error {
+	existing, err := app.weaviateStore.Vectors.GetObjectWithID(ctx, collection, id)
+	if err != nil {
+		return err
+	}
+	merged := mergeMetadataTags(existing.Metadata, doc.Metadata)
+	if merged == existing.Metadata {
+		return nil
+	}
+	if err := app.ensureOriginalChapterVersion(ctx, scope, id, existing); err != nil {
+		return err
+	}
+	previous := *existing
+	existing.Metadata = merged
+	if _, err := app.weaviateStore.Vectors.UpdateObjectWithID(ctx, collection, *existing, id); err != nil {
+		return err
+	}
+	app.recordChapterVersion(ctx, scope, id, store.VersionActionUpdate, userID, previous, *existing)
+	app.invalidateRelated(ctx, collection, id)
+	return nil
+}
+
+// mergeMetadataTags returns the metadata with the tags of from that it does not have yet, the same pointer when there are none
+func mergeMetadataTags(metadata *store.Metadata, from *store.Metadata) *store.Metadata {
+	if from == nil {
+		return metadata
+	}
+	var tags []string
+	for _, tag := range from.Tags {
+		if (metadata == nil || !slices.Contains(metadata.Tags, tag)) && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return metadata
+	}
+
+	merged := &store.Metadata{}
+	if metadata != nil {
+		*merged = *metadata
+	}
+	merged.Tags = append(slices.Clone(merged.Tags), tags...)
+	return merged
+}
+
+// duplicateClustersHandler lists the groups of chapters of the knowledge base that copy each other,
+// ?threshold= overrides the similarity from which two chapters are copies
+func (app *application) duplicateClustersHandler(w http.ResponseWriter, r *http.Request) {
+	threshold := app.config.duplicates.threshold
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 32)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			app.badRequestError(w, r, fmt.Errorf("invalid threshold value %q, it must be in ]0, 1]", value))
+			return
+		}
+		threshold = float32(parsed)
+	}
+
+	clusters, err := store.FindDuplicateClusters(r.Context(), app.weaviateStore.Vectors, getCollectionFromCtx(r), threshold)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, DuplicateClustersResponse{Threshold: threshold, Clusters: clusters}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
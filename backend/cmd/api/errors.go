@@ -9,6 +9,20 @@ var (
 	ErrorMissingSessionIDHeader                 = errors.New("error missing session ID in the Header of the request")
 	ErrorSessionIDHeaderDifferentFromJWTSubject = errors.New("error session ID in the Header is different from JWT Subject")
 	ErrorUserNotAuthorized                      = errors.New("user not authorized")
+	ErrorMissingUploadedFiles                   = errors.New("error no files uploaded in the \"files\" field of the form")
+	ErrorUnsupportedFileType                    = errors.New("error unsupported file type")
+	ErrorDefaultKnowledgeBaseDelete             = errors.New("error the default knowledge base can not be deleted")
+	ErrorMissingOrganizationClaim               = errors.New("error missing organization in the JWT")
+	ErrorTenantNotActive                        = errors.New("error the organization is deactivated")
+	ErrorInvalidTenantName                      = errors.New("error tenant names can only have letters, digits, '-' and '_'")
+	ErrorMissingSearchQuery                     = errors.New("error missing the q query param")
+	ErrorUnknownSortOrder                       = errors.New("error unknown order, use asc or desc")
+	ErrorInvalidTimeRange                       = errors.New("error from must be before to")
+	ErrorAdminRoleRequired                      = errors.New("error the admin role is required")
+	ErrorAccessChangeForbidden                  = errors.New("error only admins can change the access of a chapter")
+	ErrorInvalidKnowledgeBaseName               = errors.New("error knowledge base names need at least one ascii letter")
+	ErrorReservedKnowledgeBaseClass             = errors.New("error knowledge base names can not end in chunk, it is kept for the chunk classes")
+	ErrorKnowledgeBaseClassTaken                = errors.New("error the name maps to the classes of another knowledge base")
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -26,6 +40,16 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request,
 	writeJSONError(w, http.StatusNotFound, err.Error())
 }
 
+func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Errorf("conflict error: %s", err)
+	writeJSONError(w, http.StatusConflict, err.Error())
+}
+
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("forbidden", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	writeJSONError(w, http.StatusForbidden, err.Error())
+}
+
 func (app *application) unauthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warnf("unauthorized error - method=%s, path=%s, error=%s", r.Method, r.URL.Path, err.Error())
 
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+const (
+	maxImportSize    = 256 << 20 // 256mb for a jsonl import
+	importBatchSize  = 100
+	exportFlushEvery = 100
+)
+
+// exportVectorsHandler streams every object of the knowledge base the caller can read as jsonl, with ?vectors=true the vectors are included
+func (app *application) exportVectorsHandler(w http.ResponseWriter, r *http.Request) {
+	withVectors := false
+	if value := r.URL.Query().Get("vectors"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid vectors value: %w", err))
+			return
+		}
+		withVectors = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	kb := getKnowledgeBaseFromCtx(r)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.jsonl"`, kb.Name))
+
+	ctx := r.Context()
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	exported := 0
+
+	err := app.weaviateStore.Vectors.ExportObjects(ctx, getCollectionFromCtx(r), withVectors, func(obj *store.ExportedObject) error {
+		if err := encoder.Encode(obj); err != nil {
+			return err
+		}
+		exported++
+		if flusher != nil && exported%exportFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// the status line is already sent once an object was written, the export is just cut
+		if exported == 0 {
+			app.internalServerError(w, r, err)
+			return
+		}
+		app.logger.Errorw("error exporting knowledge base", "exported", exported, "error", err)
+		return
+	}
+	app.logger.Infow("knowledge base exported", "knowledge_base", kb.Name, "objects", exported)
+}
+
+// importVectorsHandler reads a jsonl export from the body and writes it in batches.
+// ?policy=skip|overwrite|fail decides what happens with the objects that already exist.
+func (app *application) importVectorsHandler(w http.ResponseWriter, r *http.Request) {
+	policy, err := store.ParseConflictPolicy(r.URL.Query().Get("policy"))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	ctx := r.Context()
+	collection := getCollectionFromCtx(r)
+
+	total := &store.ImportReport{}
+	err = store.DecodeExportedObjects(r.Body, importBatchSize, func(objects []store.ExportedObject) error {
+		report, err := app.weaviateStore.Vectors.ImportObjects(ctx, collection, objects, policy)
+		if err != nil {
+			return err
+		}
+		total.Imported += report.Imported
+		total.Overwritten += report.Overwritten
+		total.Skipped += report.Skipped
+		total.Changes = append(total.Changes, report.Changes...)
+		return nil
+	})
+	app.recordChapterChanges(ctx, versionScopeFromCtx(r), getPrincipalFromCtx(r).UserID, total.Changes)
+	if total.Overwritten > 0 {
+		app.invalidateAllRelated(ctx, collection)
+	}
+	if err != nil {
+		// the batches before the failing one are already written
+		err = fmt.Errorf("%w (objects already written: %d)", err, total.Imported+total.Overwritten)
+		switch {
+		case errors.Is(err, store.ErrImportConflict):
+			app.conflictResponse(w, r, err)
+		case errors.Is(err, store.ErrInvalidImportLine):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, total); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
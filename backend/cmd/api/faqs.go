@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+type FAQPayload struct {
+	Questions []string         `json:"questions" validate:"required,min=1,max=20,dive,required,max=500"`
+	Answer    string           `json:"answer" validate:"required,max=5000"`
+	Links     []FAQLinkPayload `json:"links" validate:"max=10,dive"`
+}
+
+type FAQLinkPayload struct {
+	Title string `json:"title" validate:"max=200"`
+	URL   string `json:"url" validate:"required,url,max=2000"`
+}
+
+// faqEntryFromPayload returns the entry of the payload for the knowledge base and the tenant of the request
+func faqEntryFromPayload(r *http.Request, payload FAQPayload) *store.FAQEntry {
+	entry := &store.FAQEntry{
+		KnowledgeBase: getKnowledgeBaseFromCtx(r).Name,
+		Tenant:        getTenantFromCtx(r).Name,
+		Answer:        strings.TrimSpace(payload.Answer),
+		Links:         []store.FAQLink{},
+	}
+	for _, question := range payload.Questions {
+		entry.Questions = append(entry.Questions, strings.TrimSpace(question))
+	}
+	for _, link := range payload.Links {
+		entry.Links = append(entry.Links, store.FAQLink{Title: link.Title, URL: link.URL})
+	}
+	return entry
+}
+
+// readFAQPayload reads and validates the body of the create and update requests
+func (app *application) readFAQPayload(w http.ResponseWriter, r *http.Request) (*store.FAQEntry, bool) {
+	var payload FAQPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return nil, false
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return nil, false
+	}
+	return faqEntryFromPayload(r, payload), true
+}
+
+// embedFAQQuestions returns the vectors of the question variants of the entry, the questions asked to the bot
+// are compared with them
+func (app *application) embedFAQQuestions(ctx context.Context, entry *store.FAQEntry) ([][]float32, error) {
+	vectors, err := app.embedder.EmbedDocuments(ctx, entry.Questions)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding faq questions: %w", err)
+	}
+	return vectors, nil
+}
+
+func (app *application) listFAQsHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := app.postgreStore.FAQs.List(r.Context(), getKnowledgeBaseFromCtx(r).Name, getTenantFromCtx(r).Name)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, entries); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// createFAQHandler adds an approved answer, it is returned as it is to the questions close to one of its variants
+func (app *application) createFAQHandler(w http.ResponseWriter, r *http.Request) {
+	entry, ok := app.readFAQPayload(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	vectors, err := app.embedFAQQuestions(ctx, entry)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.postgreStore.FAQs.Create(ctx, entry, vectors); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, entry); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getFAQHandler(w http.ResponseWriter, r *http.Request) {
+	entry, err := app.postgreStore.FAQs.GetByID(r.Context(), getKnowledgeBaseFromCtx(r).Name, getTenantFromCtx(r).Name, r.PathValue("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, entry); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// updateFAQHandler replaces the questions, the answer and the links of an entry
+func (app *application) updateFAQHandler(w http.ResponseWriter, r *http.Request) {
+	entry, ok := app.readFAQPayload(w, r)
+	if !ok {
+		return
+	}
+	entry.ID = r.PathValue("id")
+
+	ctx := r.Context()
+	vectors, err := app.embedFAQQuestions(ctx, entry)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.postgreStore.FAQs.Update(ctx, entry, vectors); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, entry); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteFAQHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.postgreStore.FAQs.Delete(r.Context(), getKnowledgeBaseFromCtx(r).Name, getTenantFromCtx(r).Name, r.PathValue("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// matchFAQ returns the faq entry whose variant is the closest to the question, nil when none is above the threshold
+// or when the faqs are disabled
+func (app *application) matchFAQ(ctx context.Context, r *http.Request, question string) (*store.FAQMatch, error) {
+	if !app.config.faq.enabled {
+		return nil, nil
+	}
+	// the question is compared with other questions, so it is embedded like them
+	vectors, err := app.embedder.EmbedDocuments(ctx, []string{question})
+	if err != nil {
+		return nil, fmt.Errorf("error embedding the question: %w", err)
+	}
+	match, err := app.postgreStore.FAQs.Match(ctx, getKnowledgeBaseFromCtx(r).Name, getTenantFromCtx(r).Name, vectors[0], app.config.faq.threshold)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return match, nil
+}
+
+// faqAnswerResponse returns the approved answer of the entry verbatim, with the id of the entry
+func (app *application) faqAnswerResponse(w http.ResponseWriter, r *http.Request, match *store.FAQMatch, question string, standaloneQuestion string, started time.Time) {
+	event := queryEvent(r, question, standaloneQuestion, nil, match.Entry.Answer, started)
+	event.FAQID = match.Entry.ID
+	event.InsufficientInfo = false
+	app.recordQueryEvent(event)
+
+	response := map[string]any{
+		"text":           match.Entry.Answer,
+		"faq_id":         match.Entry.ID,
+		"faq_question":   match.Question,
+		"faq_similarity": match.Similarity,
+		"links":          match.Entry.Links,
+		"citations":      []Citation{},
+	}
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
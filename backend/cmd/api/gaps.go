@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/mailer"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+// maxEmailedGapClusters is the number of clusters listed in the emails
+const maxEmailedGapClusters = 10
+
+// gapReporter emails the knowledge gap reports of the last week to the docs team
+type gapReporter struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// the reports returned by the api, the questions are embedded again to build a report
+	mu     sync.Mutex
+	cached map[string]cachedGapReport
+}
+
+type cachedGapReport struct {
+	report  *store.KnowledgeGapReport
+	expires time.Time
+}
+
+// cachedReport returns the report of the key, built with build when it is not cached or expired
+func (g *gapReporter) cachedReport(key string, ttl time.Duration, build func() (*store.KnowledgeGapReport, error)) (*store.KnowledgeGapReport, error) {
+	now := time.Now()
+	g.mu.Lock()
+	entry, ok := g.cached[key]
+	g.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.report, nil
+	}
+
+	report, err := build()
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key, entry := range g.cached {
+		if !now.Before(entry.expires) {
+			delete(g.cached, key)
+		}
+	}
+	g.cached[key] = cachedGapReport{report: report, expires: now.Add(ttl)}
+	return report, nil
+}
+
+// buildGapReport clusters the unanswered questions of a knowledge base in the range
+func (app *application) buildGapReport(ctx context.Context, analyticsRange store.AnalyticsRange, threshold float32) (*store.KnowledgeGapReport, error) {
+	questions, err := app.postgreStore.Analytics.UnansweredQuestions(ctx, analyticsRange)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &store.KnowledgeGapReport{
+		KnowledgeBase: analyticsRange.KnowledgeBase,
+		Tenant:        analyticsRange.Tenant,
+		From:          analyticsRange.From.Format(time.RFC3339),
+		To:            analyticsRange.To.Format(time.RFC3339),
+		Threshold:     threshold,
+		Unanswered:    len(questions),
+		Clusters:      []*store.GapCluster{},
+	}
+	if len(questions) == 0 {
+		return report, nil
+	}
+
+	texts := make([]string, 0, len(questions))
+	for _, question := range questions {
+		texts = append(texts, question.SearchText())
+	}
+	vectors, err := app.embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding unanswered questions: %w", err)
+	}
+	report.Clusters = store.ClusterQuestions(questions, vectors, threshold)
+	return report, nil
+}
+
+// knowledgeGapsHandler returns the clusters of questions the knowledge base could not answer,
+// ?from= and ?to= select the range (the last 30 days by default), ?threshold= overrides the similarity of a cluster
+// and ?limit= keeps the biggest clusters only. The reports are cached for the cache ttl of the gap reports.
+func (app *application) knowledgeGapsHandler(w http.ResponseWriter, r *http.Request) {
+	analyticsRange, err := analyticsRangeFromQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	threshold := app.config.gapReport.threshold
+	if value := r.URL.Query().Get("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 32)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			app.badRequestError(w, r, fmt.Errorf("invalid threshold value %q, it must be in ]0, 1]", value))
+			return
+		}
+		threshold = float32(parsed)
+	}
+
+	// the default range ends now, the same query within the ttl gets the same report
+	key := fmt.Sprintf("%s/%s/%s/%s/%g", analyticsRange.KnowledgeBase, analyticsRange.Tenant,
+		r.URL.Query().Get("from"), r.URL.Query().Get("to"), threshold)
+	cached, err := app.gapReports.cachedReport(key, app.config.gapReport.cacheTTL, func() (*store.KnowledgeGapReport, error) {
+		return app.buildGapReport(r.Context(), analyticsRange, threshold)
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	report := *cached
+	if analyticsRange.Limit > 0 && len(report.Clusters) > analyticsRange.Limit {
+		report.Clusters = report.Clusters[:analyticsRange.Limit]
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, report); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// gapReportName is the row of the gap reports in report_schedules
+const gapReportName = "knowledge_gaps"
+
+// startGapReports sends the report of every knowledge base with unanswered questions once per interval to the
+// emails of its tenant. Every instance checks if the report is due, the first one to claim it sends it.
+func (app *application) startGapReports() {
+	ctx, cancel := context.WithCancel(context.Background())
+	app.gapReports = &gapReporter{cancel: cancel, cached: make(map[string]cachedGapReport)}
+
+	app.gapReports.wg.Add(1)
+	go func() {
+		defer app.gapReports.wg.Done()
+
+		ticker := time.NewTicker(app.config.gapReport.checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.sendDueGapReports(ctx)
+			}
+		}
+	}()
+}
+
+func (app *application) stopGapReports() {
+	app.gapReports.cancel()
+	app.gapReports.wg.Wait()
+}
+
+// sendDueGapReports sends the reports of the questions since the last ones, when they were sent at least an interval ago
+func (app *application) sendDueGapReports(ctx context.Context) {
+	to := time.Now()
+	from, claimed, err := app.postgreStore.Analytics.ClaimReport(ctx, gapReportName, to, app.config.gapReport.interval)
+	if err != nil {
+		app.logger.Errorw("error claiming knowledge gap reports", "error", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	app.sendGapReports(ctx, from, to)
+}
+
+func (app *application) sendGapReports(ctx context.Context, from time.Time, to time.Time) {
+	scopes, err := app.postgreStore.Analytics.UnansweredScopes(ctx, from, to)
+	if err != nil {
+		app.logger.Errorw("error listing knowledge bases with unanswered questions", "error", err)
+		return
+	}
+
+	isProdEnv := app.config.env == "production"
+	for _, scope := range scopes {
+		// the questions of an organization are only sent to its own emails
+		tenant, err := app.postgreStore.Tenants.GetByName(ctx, scope.Tenant)
+		if err != nil {
+			app.logger.Errorw("error getting tenant of knowledge gap report", "tenant", scope.Tenant, "error", err)
+			continue
+		}
+		if len(tenant.GapReportEmails) == 0 {
+			continue
+		}
+
+		report, err := app.buildGapReport(ctx, scope, app.config.gapReport.threshold)
+		if err != nil {
+			app.logger.Errorw("error building knowledge gap report", "knowledge_base", scope.KnowledgeBase, "tenant", scope.Tenant, "error", err)
+			continue
+		}
+		if len(report.Clusters) > maxEmailedGapClusters {
+			report.Clusters = report.Clusters[:maxEmailedGapClusters]
+		}
+
+		for _, email := range tenant.GapReportEmails {
+			if _, err := app.mailer.Send(mailer.KnowledgeGapTemplate, "", email, report, !isProdEnv); err != nil {
+				app.logger.Errorw("error sending knowledge gap report", "knowledge_base", scope.KnowledgeBase, "email", email, "error", err)
+			}
+		}
+		app.logger.Infow("knowledge gap report sent", "knowledge_base", scope.KnowledgeBase, "tenant", scope.Tenant, "clusters", len(report.Clusters))
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+// ingestionWorkers index the chapters of the queued ingestion jobs in the background
+type ingestionWorkers struct {
+	wakeup chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// enqueueIngestion stores a job for the documents and wakes up a worker, the job is returned right away
+func (app *application) enqueueIngestion(ctx context.Context, kb *store.KnowledgeBase, tenant *store.Tenant, user *store.Principal, policy store.DuplicatePolicy, documents []store.Document) (*store.IngestionJob, error) {
+	job := &store.IngestionJob{
+		UserID:          user.UserID,
+		UserRoles:       user.Roles,
+		UserGroups:      user.Groups,
+		KnowledgeBase:   kb.Name,
+		Tenant:          tenant.Name,
+		DuplicatePolicy: policy,
+	}
+	if err := app.postgreStore.Jobs.Create(ctx, job, documents); err != nil {
+		return nil, err
+	}
+
+	select {
+	case app.ingestion.wakeup <- struct{}{}:
+	default:
+		// every worker is busy, the job is picked up when one of them is done
+	}
+	return job, nil
+}
+
+func (app *application) startIngestionWorkers() {
+	ctx, cancel := context.WithCancel(context.Background())
+	app.ingestion = &ingestionWorkers{
+		wakeup: make(chan struct{}, app.config.ingestion.workers),
+		cancel: cancel,
+	}
+
+	for i := 0; i < app.config.ingestion.workers; i++ {
+		app.ingestion.wg.Add(1)
+		go func() {
+			defer app.ingestion.wg.Done()
+			app.ingestionWorker(ctx)
+		}()
+	}
+}
+
+func (app *application) stopIngestionWorkers() {
+	app.ingestion.cancel()
+	app.ingestion.wg.Wait()
+}
+
+// requeueExpiredIngestionJobs puts back in the queue the jobs of the instances that stopped while running them,
+// the jobs of the instances still running are kept by their lease
+func (app *application) requeueExpiredIngestionJobs(ctx context.Context) {
+	requeued, err := app.postgreStore.Jobs.RequeueExpired(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			app.logger.Errorw("error requeuing ingestion jobs", "error", err)
+		}
+		return
+	}
+	if requeued > 0 {
+		app.logger.Infow("ingestion jobs requeued", "jobs", requeued)
+	}
+}
+
+func (app *application) ingestionWorker(ctx context.Context) {
+	ticker := time.NewTicker(app.config.ingestion.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		app.requeueExpiredIngestionJobs(ctx)
+
+		// process jobs until the queue is empty, then wait for a new one
+		for {
+			job, err := app.postgreStore.Jobs.ClaimNext(ctx, app.config.ingestion.leaseDuration)
+			if err != nil {
+				if !errors.Is(err, store.ErrNotFound) && ctx.Err() == nil {
+					app.logger.Errorw("error claiming ingestion job", "error", err)
+				}
+				break
+			}
+			app.processIngestionJob(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.ingestion.wakeup:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processIngestionJob indexes the pending chapters of a job in batches, after screening them for duplicates.
+// When a batch fails its chapters are retried one by one, so that one bad chapter does not fail the others.
+func (app *application) processIngestionJob(ctx context.Context, job *store.IngestionJob) {
+	app.logger.Infow("ingestion job started", "job_id", job.JobID, "knowledge_base", job.KnowledgeBase)
+
+	stopRenewing := app.renewIngestionLease(ctx, job)
+	defer stopRenewing()
+
+	kb, err := app.postgreStore.KnowledgeBases.GetByName(ctx, job.KnowledgeBase)
+	if err != nil {
+		app.failIngestionJob(ctx, job, "error getting knowledge base of ingestion job", err)
+		return
+	}
+	collection := kb.Collection(job.Tenant)
+
+	chapters, err := app.postgreStore.Jobs.GetPendingChapters(ctx, job.JobID)
+	if err != nil {
+		app.failIngestionJob(ctx, job, "error getting chapters of ingestion job", err)
+		return
+	}
+
+	batchSize := max(app.config.ingestion.batchSize, 1)
+	for start := 0; start < len(chapters); start += batchSize {
+		if ctx.Err() != nil {
+			// the job stays running and is requeued when its lease expires
+			return
+		}
+		end := min(start+batchSize, len(chapters))
+		batch := app.screenDuplicates(ctx, collection, job, chapters[start:end])
+		if len(batch) == 0 {
+			continue
+		}
+
+		documents := make([]store.Document, 0, len(batch))
+		for _, chapter := range batch {
+			documents = append(documents, chapter.Document)
+		}
+		err := app.indexIngestionDocuments(ctx, collection, job, documents)
+		if err == nil {
+			for i := range batch {
+				batch[i].Status = store.JobChapterStatusDone
+				batch[i].Attempts++
+				app.saveIngestionChapter(ctx, job, &batch[i])
+			}
+			continue
+		}
+
+		app.logger.Warnw("ingestion batch failed, retrying chapters one by one", "job_id", job.JobID, "error", err)
+		for i := range batch {
+			app.ingestChapterWithRetries(ctx, collection, job, &batch[i])
+		}
+	}
+
+	status, err := app.postgreStore.Jobs.Finish(ctx, job.JobID)
+	if err != nil {
+		app.logger.Errorw("error finishing ingestion job", "job_id", job.JobID, "error", err)
+		return
+	}
+	app.logger.Infow("ingestion job finished", "job_id", job.JobID, "status", status)
+}
+
+// renewIngestionLease renews the lease of the job until the returned function is called, so that the other
+// instances do not requeue it while it is processed
+func (app *application) renewIngestionLease(ctx context.Context, job *store.IngestionJob) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(app.config.ingestion.leaseDuration / 4)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := app.postgreStore.Jobs.RenewLease(ctx, job.JobID, app.config.ingestion.leaseDuration)
+				if err != nil && ctx.Err() == nil {
+					app.logger.Errorw("error renewing lease of ingestion job", "job_id", job.JobID, "error", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// failIngestionJob marks the job as failed when it can not be processed, a job left running would never finish
+func (app *application) failIngestionJob(ctx context.Context, job *store.IngestionJob, message string, err error) {
+	app.logger.Errorw(message, "job_id", job.JobID, "error", err)
+	if ctx.Err() != nil {
+		// the server is stopping, the job is requeued when its lease expires
+		return
+	}
+	if err := app.postgreStore.Jobs.Fail(ctx, job.JobID, fmt.Sprintf("%s: %s", message, err)); err != nil {
+		app.logger.Errorw("error failing ingestion job", "job_id", job.JobID, "error", err)
+	}
+}
+
+// indexIngestionDocuments indexes documents of a job within the batch timeout of the workers, embedding long
+// chapters takes longer than the queries of the api
+func (app *application) indexIngestionDocuments(ctx context.Context, collection store.Collection, job *store.IngestionJob, documents []store.Document) error {
+	ctx, cancel := context.WithTimeout(ctx, app.config.ingestion.batchTimeout)
+	defer cancel()
+
+	_, err := app.weaviateStore.Vectors.CreateVectors(ctx, collection, &store.RagData{UserID: job.UserID, Documents: documents})
+	return err
+}
+
+func (app *application) ingestChapterWithRetries(ctx context.Context, collection store.Collection, job *store.IngestionJob, chapter *store.IngestionJobChapter) {
+	for chapter.Attempts < app.config.ingestion.maxAttempts {
+		chapter.Attempts++
+		err := app.indexIngestionDocuments(ctx, collection, job, []store.Document{chapter.Document})
+		if err == nil {
+			chapter.Status = store.JobChapterStatusDone
+			chapter.Error = ""
+			app.saveIngestionChapter(ctx, job, chapter)
+			return
+		}
+
+		chapter.Error = err.Error()
+		// retrying can not fix a chapter that already exists
+		if errors.Is(err, store.ErrChapterAlreadyExists) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * time.Duration(chapter.Attempts)):
+		}
+	}
+
+	chapter.Status = store.JobChapterStatusFailed
+	app.saveIngestionChapter(ctx, job, chapter)
+}
+
+func (app *application) saveIngestionChapter(ctx context.Context, job *store.IngestionJob, chapter *store.IngestionJobChapter) {
+	if err := app.postgreStore.Jobs.UpdateChapter(ctx, chapter); err != nil {
+		app.logger.Errorw("error saving chapter of ingestion job", "job_id", job.JobID, "chapter", chapter.Chapter, "error", err)
+	}
+}
+
+func (app *application) getIngestionJobHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	job, err := app.postgreStore.Jobs.GetByID(ctx, id)
+	// the jobs of the other organizations are hidden
+	if err == nil && job.Tenant != getTenantFromCtx(r).Name {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, job); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
 )
 
 type jwtTokenPayload struct {
 	ClientID string `json:"user" validate:"required,max=50"`
 	Password string `json:"password" validate:"required,max=70,min=3 "`
+	// organization of the user, its documents are the only ones the token gives access to
+	Organization string `json:"organization" validate:"required,max=64"`
+	// roles and groups of the user, they decide which restricted documents it can read
+	Roles  []string `json:"roles" validate:"max=50,dive,max=64"`
+	Groups []string `json:"groups" validate:"max=50,dive,max=64"`
 }
 
 func (app *application) jwtTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -38,14 +45,36 @@ func (app *application) jwtTokenHandler(w http.ResponseWriter, r *http.Request)
 		app.badRequestResponse(w, r, ErrorMissingSessionIDHeader)
 		return
 	}
+	tenant, err := app.postgreStore.Tenants.GetByName(r.Context(), credentials.Organization)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if !tenant.IsActive {
+		app.forbiddenResponse(w, r, ErrorTenantNotActive)
+		return
+	}
+
 	claims := jwt.MapClaims{
 		"suv": userID,
+		"org": tenant.Name,
 		"exp": time.Now().Add(app.config.authCredencials.token.exp).Unix(),
 		"iat": time.Now().Unix(),
 		"nbf": time.Now().Unix(),
 		"iss": app.config.authCredencials.token.iss,
 		"aud": app.config.authCredencials.token.iss,
 	}
+	if len(credentials.Roles) > 0 {
+		claims["roles"] = credentials.Roles
+	}
+	if len(credentials.Groups) > 0 {
+		claims["groups"] = credentials.Groups
+	}
 	token, err := app.authenticator.GenerateToken(claims)
 	if err != nil {
 		app.internalServerError(w, r, err)
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+type knowledgeBaseKey string
+
+const knowledgeBaseCtx knowledgeBaseKey = "knowledgeBase"
+
+type CreateKnowledgeBasePayload struct {
+	Name             string         `json:"name" validate:"required,max=50"`
+	Description      string         `json:"description" validate:"max=500"`
+	Vectorizer       string         `json:"vectorizer" validate:"max=100"`
+	VectorizerConfig map[string]any `json:"vectorizer_config"`
+}
+
+type UpdateKnowledgeBasePayload struct {
+	Description string `json:"description" validate:"max=500"`
+}
+
+// mountKnowledgeBaseRoutes registers the endpoints that work on the knowledge base in the request context
+func (app *application) mountKnowledgeBaseRoutes(r chi.Router) {
+	r.Post("/vector-db", app.createVectorHandler)
+	r.Put("/vector-db", app.upsertVectorHandler)
+	r.Post("/vector-db/upload", app.uploadDocumentsHandler)
+	r.Get("/vector-db/export", app.exportVectorsHandler)
+	r.Post("/vector-db/import", app.importVectorsHandler)
+	r.Get("/vector-db/object", app.getObjectIDByChapterHandler)
+	r.Get("/vector-db/object/{id}", app.getChapterHandler)
+	r.Get("/vector-db/chapters", app.listChaptersHandler)
+	r.Get("/vector-db/chapters/search", app.searchChapterTitlesHandler)
+	r.Get("/vector-db/chapters/facets", app.chapterFacetsHandler)
+	r.Get("/search", app.searchHandler)
+	r.Delete("/vector-db/object/{id}", app.deleteVectorObjectByIdHandler)
+	r.Patch("/vector-db/object/{id}", app.updateVectorObjectByIdHandler)
+	r.Get("/vector-db/object/{id}/related", app.relatedChaptersHandler)
+	r.Get("/vector-db/object/{id}/versions", app.listChapterVersionsHandler)
+	r.Get("/vector-db/object/{id}/versions/diff", app.diffChapterVersionsHandler)
+	r.Post("/vector-db/object/{id}/versions/{version}/rollback", app.rollbackChapterHandler)
+
+	// the routes of the admins of the tenant, the tokens need the admin role
+	r.Group(func(r chi.Router) {
+		r.Use(app.requireAdminMiddleware)
+
+		r.Get("/vector-db/duplicates", app.duplicateClustersHandler)
+
+		// the reports show the questions of the other users of the tenant
+		r.Get("/analytics/questions", app.topQuestionsHandler)
+		r.Get("/analytics/chapters", app.topChaptersHandler)
+		r.Get("/analytics/chapters/unused", app.unusedChaptersHandler)
+		r.Get("/analytics/gaps", app.knowledgeGapsHandler)
+
+		// the faq answers are returned as they are to every user of the tenant
+		if app.config.faq.enabled {
+			r.Get("/faqs", app.listFAQsHandler)
+			r.Post("/faqs", app.createFAQHandler)
+			r.Get("/faqs/{id}", app.getFAQHandler)
+			r.Put("/faqs/{id}", app.updateFAQHandler)
+			r.Delete("/faqs/{id}", app.deleteFAQHandler)
+		}
+	})
+}
+
+// knowledgeBaseContextMiddleware loads the knowledge base of the {kbName} url param, the default one when there is no param
+func (app *application) knowledgeBaseContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "kbName")
+		if name == "" {
+			name = store.DefaultKnowledgeBaseName
+		}
+
+		ctx := r.Context()
+		kb, err := app.postgreStore.KnowledgeBases.GetByName(ctx, name)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, knowledgeBaseCtx, kb)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getKnowledgeBaseFromCtx(r *http.Request) *store.KnowledgeBase {
+	kb, _ := r.Context().Value(knowledgeBaseCtx).(*store.KnowledgeBase)
+	return kb
+}
+
+func (app *application) createKnowledgeBaseHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateKnowledgeBasePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if !strings.ContainsFunc(payload.Name, isASCIILetter) {
+		app.badRequestError(w, r, ErrorInvalidKnowledgeBaseName)
+		return
+	}
+
+	kb := &store.KnowledgeBase{
+		Name:             payload.Name,
+		Description:      payload.Description,
+		ClassName:        store.ClassNameFromName(payload.Name),
+		Vectorizer:       payload.Vectorizer,
+		VectorizerConfig: payload.VectorizerConfig,
+	}
+	if kb.Vectorizer == "" {
+		kb.Vectorizer = store.DefaultVectorizer
+		// with an embedder configured the app writes the vectors itself
+		if app.config.embedding.provider != "" || app.config.vectorBackend != store.VectorBackendWeaviate {
+			kb.Vectorizer = store.VectorizerNone
+		}
+	}
+
+	// the chunks of a knowledge base are in its class followed by Chunk, no other knowledge base may use that name
+	if strings.HasSuffix(kb.ClassName, "Chunk") {
+		app.badRequestError(w, r, ErrorReservedKnowledgeBaseClass)
+		return
+	}
+	ctx := r.Context()
+	kbs, err := app.postgreStore.KnowledgeBases.List(ctx)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	for _, existing := range kbs {
+		collection := existing.Collection("")
+		if kb.ClassName == collection.Class || kb.ClassName == collection.ChunkClass() {
+			app.conflictResponse(w, r, ErrorKnowledgeBaseClassTaken)
+			return
+		}
+	}
+
+	if err := app.postgreStore.KnowledgeBases.Create(ctx, kb); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateKnowledgeBase):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	err = app.weaviateStore.Vectors.CreateCollection(ctx, kb)
+	if err == nil {
+		err = app.createKnowledgeBaseTenants(ctx, kb)
+	}
+	if err != nil {
+		// without its classes the knowledge base can not be used, so it is removed again
+		if deleteErr := app.postgreStore.KnowledgeBases.Delete(ctx, kb.ID); deleteErr != nil {
+			app.logger.Errorw("error removing knowledge base", "name", kb.Name, "error", deleteErr)
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, kb); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func isASCIILetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func (app *application) listKnowledgeBasesHandler(w http.ResponseWriter, r *http.Request) {
+	kbs, err := app.postgreStore.KnowledgeBases.List(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, kbs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getKnowledgeBaseHandler(w http.ResponseWriter, r *http.Request) {
+	kb := getKnowledgeBaseFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, kb); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) updateKnowledgeBaseHandler(w http.ResponseWriter, r *http.Request) {
+	kb := getKnowledgeBaseFromCtx(r)
+
+	var payload UpdateKnowledgeBasePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	kb.Description = payload.Description
+	if err := app.postgreStore.KnowledgeBases.Update(r.Context(), kb); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, kb); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteKnowledgeBaseHandler deletes a knowledge base together with its weaviate classes and all their objects
+func (app *application) deleteKnowledgeBaseHandler(w http.ResponseWriter, r *http.Request) {
+	kb := getKnowledgeBaseFromCtx(r)
+	if kb.Name == store.DefaultKnowledgeBaseName {
+		app.badRequestError(w, r, ErrorDefaultKnowledgeBaseDelete)
+		return
+	}
+
+	ctx := r.Context()
+	if err := app.weaviateStore.Vectors.DeleteCollection(ctx, kb.Collection("")); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.invalidateAllRelated(ctx, kb.Collection(""))
+	if err := app.postgreStore.KnowledgeBases.Delete(ctx, kb.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ensureKnowledgeBaseCollections migrates the weaviate classes and creates the tenants of every knowledge base,
+// the schema changes that can not be applied are logged
+func (app *application) ensureKnowledgeBaseCollections(ctx context.Context) error {
+	kbs, err := app.postgreStore.KnowledgeBases.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, kb := range kbs {
+		plan, err := app.weaviateStore.Vectors.MigrateSchema(ctx, kb, true)
+		if err != nil {
+			return err
+		}
+		for _, change := range plan.Additive {
+			app.logger.Infow("schema change applied", "knowledge_base", kb.Name, "change", change.String())
+		}
+		for _, change := range plan.Incompatible {
+			app.logger.Warnw("incompatible schema change, export the knowledge base and recreate its classes", "knowledge_base", kb.Name, "change", change.String())
+		}
+		if err := plan.Err(); err != nil {
+			return err
+		}
+		if err := app.createKnowledgeBaseTenants(ctx, kb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
 	"time"
 
@@ -8,6 +10,7 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/mik-dmi/rag_chatbot/backend/internal/auth"
 	"github.com/mik-dmi/rag_chatbot/backend/internal/db"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/embedding"
 	"github.com/mik-dmi/rag_chatbot/backend/internal/env"
 	"github.com/mik-dmi/rag_chatbot/backend/internal/llm"
 	"github.com/mik-dmi/rag_chatbot/backend/internal/mailer"
@@ -54,10 +57,16 @@ func main() {
 	cfg := config{
 		addr:        env.GetString("ADDR", ":8080"),
 		frontendURL: env.GetString("FRONTEND_URL", "http://localhost:4000"),
+		// pgvector keeps the vectors in the postgres database and needs an EMBEDDING_PROVIDER,
+		// memory keeps them and every other store in the process, for development without postgres and redis
+		vectorBackend: env.GetString("VECTOR_BACKEND", store.VectorBackendWeaviate),
 		weaviateDB: weaviateDBConfig{
 			addr: env.GetString("WEAVIATE_DB_PORT", ":8080"),
 			host: env.GetString("WEAVIATE_DB_HOST", "localhost"),
 		},
+		memoryDB: memoryDBConfig{
+			snapshotPath: env.GetString("MEMORY_DB_SNAPSHOT", ""),
+		},
 		redisDB: redisDBConfig{
 			addr:     env.GetString("REDIS_DB_PORT", ":6379"),
 			host:     env.GetString("REDIS_DB_HOST", "localhost"),
@@ -96,8 +105,75 @@ func main() {
 			},
 		},
 
+		chunking: chunkingConfig{
+			size:    env.GetInt("CHUNK_SIZE", 200),
+			overlap: env.GetInt("CHUNK_OVERLAP", 40),
+		},
+
+		// without a provider the vectors are computed by the vectorizer module of weaviate
+		embedding: embeddingConfig{
+			provider:   env.GetString("EMBEDDING_PROVIDER", ""),
+			model:      env.GetString("EMBEDDING_MODEL", ""),
+			apiKey:     env.GetString("EMBEDDING_API_KEY", env.GetString("OPEN_AI_SECRET", "openai_key")),
+			baseURL:    env.GetString("EMBEDDING_BASE_URL", ""),
+			dimensions: env.GetInt("EMBEDDING_DIMENSIONS", 256),
+			cacheSize:  env.GetInt("EMBEDDING_CACHE_SIZE", 10000),
+		},
+
+		ingestion: ingestionConfig{
+			workers:       env.GetInt("INGESTION_WORKERS", 2),
+			batchSize:     env.GetInt("INGESTION_BATCH_SIZE", 5),
+			maxAttempts:   env.GetInt("INGESTION_MAX_ATTEMPTS", 3),
+			batchTimeout:  time.Second * time.Duration(env.GetInt("INGESTION_BATCH_TIMEOUT_SECONDS", 120)),
+			pollInterval:  time.Second * 5,
+			leaseDuration: time.Minute * 2,
+		},
+
+		duplicates: duplicatesConfig{
+			policy:    store.DuplicatePolicy(env.GetString("DUPLICATE_POLICY", string(store.DuplicateFlag))),
+			threshold: float32(env.GetFloat("DUPLICATE_THRESHOLD", 0.95)),
+		},
+
+		analytics: analyticsConfig{
+			bufferSize:    env.GetInt("ANALYTICS_BUFFER_SIZE", 1000),
+			batchSize:     env.GetInt("ANALYTICS_BATCH_SIZE", 50),
+			flushInterval: time.Second * 5,
+		},
+
+		retrieval: retrievalConfig{
+			mode:       env.GetString("RETRIEVAL_MODE", store.SearchModeVector),
+			limit:      env.GetInt("RETRIEVAL_LIMIT", 5),
+			candidates: env.GetInt("RETRIEVAL_CANDIDATES", 20),
+			mmrLambda:  env.GetFloat("RETRIEVAL_MMR_LAMBDA", 0.7),
+		},
+
+		faq: faqConfig{
+			enabled:   env.GetString("FAQ_ENABLED", "false") == "true",
+			threshold: env.GetFloat("FAQ_MATCH_THRESHOLD", 0.92),
+		},
+
+		gapReport: gapReportConfig{
+			threshold: float32(env.GetFloat("GAP_REPORT_THRESHOLD", 0.8)),
+			interval:  time.Hour * 24 * 7,
+			// the last send time is in postgres, the instances check it often so that restarts do not delay the report
+			checkInterval: time.Minute * 10,
+			cacheTTL:      time.Minute * 10,
+		},
+
 		env: env.GetString("ENV", "development"),
 	}
+	if _, err := store.ParseDuplicatePolicy(string(cfg.duplicates.policy), store.DuplicateFlag); err != nil {
+		log.Fatalf("invalid DUPLICATE_POLICY: %s", err)
+	}
+	if _, err := store.ParseSearchMode(cfg.retrieval.mode, store.SearchModeVector); err != nil {
+		log.Fatalf("invalid RETRIEVAL_MODE: %s", err)
+	}
+	if cfg.retrieval.mmrLambda < 0 || cfg.retrieval.mmrLambda > 1 {
+		log.Fatalf("invalid RETRIEVAL_MMR_LAMBDA %v, it must be in [0, 1]", cfg.retrieval.mmrLambda)
+	}
+	if cfg.faq.threshold <= 0 || cfg.faq.threshold > 1 {
+		log.Fatalf("invalid FAQ_MATCH_THRESHOLD %v, it must be in ]0, 1]", cfg.faq.threshold)
+	}
 	var logger *zap.SugaredLogger
 
 	if env.GetString(cfg.env, "development") == "production" {
@@ -112,18 +188,27 @@ func main() {
 		}
 	}
 
-	weaviateClient, err := db.NewWeaviateClient(cfg.weaviateDB.host, cfg.weaviateDB.addr)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	redisClient, err := db.NewRedisClient(cfg.redisDB.host, cfg.redisDB.addr, cfg.redisDB.password)
-	if err != nil {
-		log.Fatal(err)
-	}
-	postgreClient, err := db.NewPostgreClient(cfg.postgresDB.addr, cfg.postgresDB.maxOpenConns, cfg.postgresDB.maxIdleConns, cfg.postgresDB.maxIdleTime)
-	if err != nil {
-		log.Fatal(err)
+	var redisStore store.RedisStorage
+	var postgreStore store.PostgreStorage
+	var postgreClient *sql.DB
+	if cfg.vectorBackend == store.VectorBackendMemory {
+		// the memory backend runs without any database, the other stores are kept in memory too
+		redisStore = store.NewMemoryRedisStorage()
+		postgreStore = store.NewMemoryPostgreStorage()
+	} else {
+		redisClient, err := db.NewRedisClient(cfg.redisDB.host, cfg.redisDB.addr, cfg.redisDB.password)
+		if err != nil {
+			log.Fatal(err)
+		}
+		postgreClient, err = db.NewPostgreClient(cfg.postgresDB.addr, cfg.postgresDB.maxOpenConns, cfg.postgresDB.maxIdleConns, cfg.postgresDB.maxIdleTime)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := db.RequirePgVector(postgreClient); err != nil {
+			log.Fatal(err)
+		}
+		redisStore = store.NewRedisStorage(redisClient)
+		postgreStore = store.NewPostgreStorage(postgreClient)
 	}
 
 	//mailer := mailer.NewSendgrind(cfg.mail.sendGrid.apiKey, cfg.mail.fromEmail)
@@ -140,9 +225,56 @@ func main() {
 
 	jwtAuthenticator := auth.NewJWTAuthenticator(cfg.authCredencials.token.secret, tokenHost, tokenHost)
 
-	weaviateStore := store.NewWeaviateStorage(weaviateClient)
-	redisStore := store.NewRedisStorage(redisClient)
-	postgreStore := store.NewPostgreStorage(postgreClient)
+	// the faq variants are compared with paraphrases of them, which only a model embeds close to each other
+	if cfg.faq.enabled && (cfg.embedding.provider == "" || cfg.embedding.provider == embedding.ProviderHashing) {
+		log.Fatalf("FAQ_ENABLED needs EMBEDDING_PROVIDER set to %s or %s", embedding.ProviderOpenAI, embedding.ProviderOpenAICompatible)
+	}
+	embedder, err := embedding.New(embedding.Config{
+		Provider:   cfg.embedding.provider,
+		Model:      cfg.embedding.model,
+		APIKey:     cfg.embedding.apiKey,
+		BaseURL:    cfg.embedding.baseURL,
+		Dimensions: cfg.embedding.dimensions,
+		CacheSize:  cfg.embedding.cacheSize,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	chunking := store.ChunkingConfig{
+		Size:    cfg.chunking.size,
+		Overlap: cfg.chunking.overlap,
+	}
+	retrieval := store.RetrievalConfig{
+		Limit:      cfg.retrieval.limit,
+		Candidates: cfg.retrieval.candidates,
+		MMRLambda:  cfg.retrieval.mmrLambda,
+	}
+	var weaviateStore store.WeaviateStorage
+	switch cfg.vectorBackend {
+	case store.VectorBackendWeaviate:
+		weaviateClient, err := db.NewWeaviateClient(cfg.weaviateDB.host, cfg.weaviateDB.addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		weaviateStore = store.NewWeaviateStorage(weaviateClient, chunking, retrieval, embedder)
+	case store.VectorBackendPgVector:
+		if embedder == nil {
+			log.Fatal("the pgvector backend needs an EMBEDDING_PROVIDER")
+		}
+		weaviateStore = store.NewPgVectorStorage(postgreClient, chunking, retrieval, embedder)
+	case store.VectorBackendMemory:
+		// without a provider the hashing embedder is used, so that nothing else has to run
+		if embedder == nil {
+			embedder = embedding.NewHashingEmbedder(cfg.embedding.dimensions)
+		}
+		weaviateStore, err = store.NewMemoryVectorStorage(chunking, retrieval, embedder, cfg.memoryDB.snapshotPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown VECTOR_BACKEND %s", cfg.vectorBackend)
+	}
 	app := &application{
 		config:        cfg,
 		weaviateStore: weaviateStore,
@@ -155,7 +287,21 @@ func main() {
 		logger:        logger,
 		authenticator: jwtAuthenticator,
 		mailer:        mailtrap,
+		embedder:      embedder,
+	}
+	// the questions are clustered with the hashing embedder when weaviate computes the vectors
+	if app.embedder == nil {
+		app.embedder = embedding.NewHashingEmbedder(cfg.embedding.dimensions)
 	}
+
+	// every knowledge base needs its weaviate classes before serving requests
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	err = app.ensureKnowledgeBaseCollections(ctx)
+	cancel()
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	mux := app.mount()
 	log.Fatal(app.Run(mux))
 }
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
 	"github.com/mik-dmi/rag_chatbot/backend/utils"
 )
 
@@ -41,6 +45,81 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// every request is scoped to the organization of the token
+		organization, _ := claims["org"].(string)
+		if organization == "" {
+			app.unauthorizedErrorResponse(w, r, ErrorMissingOrganizationClaim)
+			return
+		}
+		ctx := r.Context()
+		tenant, err := app.postgreStore.Tenants.GetByName(ctx, organization)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.unauthorizedErrorResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		if !tenant.IsActive {
+			app.forbiddenResponse(w, r, ErrorTenantNotActive)
+			return
+		}
+
+		ctx = context.WithValue(ctx, tenantCtx, tenant)
+		ctx = context.WithValue(ctx, principalCtx, principalFromClaims(claims))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// adminRole is the role of the tokens that manage a knowledge base, it is set by the client that asks for the token
+const adminRole = "admin"
+
+// requireAdminMiddleware only lets through the tokens with the admin role
+func (app *application) requireAdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(getPrincipalFromCtx(r)) {
+			app.forbiddenResponse(w, r, ErrorAdminRoleRequired)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+func isAdmin(principal *store.Principal) bool {
+	return principal != nil && slices.Contains(principal.Roles, adminRole)
+}
+
+type principalKey string
+
+const principalCtx principalKey = "principal"
+
+func getPrincipalFromCtx(r *http.Request) *store.Principal {
+	principal, _ := r.Context().Value(principalCtx).(*store.Principal)
+	return principal
+}
+
+// principalFromClaims reads the user, roles and groups of a token, they are checked against the access lists of the documents
+func principalFromClaims(claims jwt.MapClaims) *store.Principal {
+	userID, _ := claims["suv"].(string)
+	if userID == "" {
+		userID, _ = claims["sub"].(string)
+	}
+	return &store.Principal{
+		UserID: userID,
+		Roles:  claimStrings(claims["roles"]),
+		Groups: claimStrings(claims["groups"]),
+	}
+}
+
+func claimStrings(claim any) []string {
+	values, _ := claim.([]any)
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		if str, ok := value.(string); ok && str != "" {
+			strs = append(strs, str)
+		}
+	}
+	return strs
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	"log"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
 	"github.com/tmc/langchaingo/chains"
@@ -22,13 +27,21 @@ type UpdateDocumentsPayload struct {
 	Documents store.Document `json:"document" validate:"required"`
 }
 type UserQuery struct {
-	UserID      string `json:"user_id" validate:"required,max=50"`
-	UserMessage string `json:"user_message" validate:"required,max=500"`
+	UserID      string                `json:"user_id" validate:"required,max=50"`
+	UserMessage string                `json:"user_message" validate:"required,max=500"`
+	Filter      *store.MetadataFilter `json:"filter"` // only the documents matching it are used to answer
 }
 
+// createVectorHandler queues the documents for ingestion and returns the job that tracks it,
+// ?duplicates=off|flag|reject|merge decides what is done with the copies of chapters already indexed
 func (app *application) createVectorHandler(w http.ResponseWriter, r *http.Request) {
+	policy, err := app.duplicatePolicyFromQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
 	var documents CreateDocumentsPayload
-	var formatedDocuments *store.RagData
 	if err := readJSON(w, r, &documents); err != nil {
 		app.badRequestError(w, r, err)
 		return
@@ -36,35 +49,154 @@ func (app *application) createVectorHandler(w http.ResponseWriter, r *http.Reque
 	//validate the user input
 	if err := Validate.Struct(documents); err != nil {
 		app.badRequestError(w, r, err)
+		return
 	}
 
-	userId := "1"
+	userId := getPrincipalFromCtx(r).UserID
+	var formatedDocuments []store.Document
 	for _, document := range documents.Documents {
-		formatedDocuments = createFormatedDocument(document, userId)
+		formatedDocuments = append(formatedDocuments, createFormatedDocument(document, userId).Documents...)
 	}
 
 	ctx := r.Context()
 
-	vectorsCreated, err := app.weaviateStore.Vectors.CreateVectors(ctx, formatedDocuments)
+	job, err := app.enqueueIngestion(ctx, getKnowledgeBaseFromCtx(r), getTenantFromCtx(r), getPrincipalFromCtx(r), policy, formatedDocuments)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, job); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+}
+
+// UpsertVectorsResponse is the report of an upsert with the new chapters that copy others
+type UpsertVectorsResponse struct {
+	*store.UpsertReport
+	Duplicates []UpsertDuplicate `json:"duplicates"`
+}
+
+type UpsertDuplicate struct {
+	Chapter     string `json:"chapter"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	Indexed     bool   `json:"indexed"`
+	Error       string `json:"error,omitempty"`
+}
+
+// upsertVectorHandler indexes the documents again without failing on the chapters that already exist,
+// with ?full_sync=true the chapters that are not in the payload are deleted.
+// ?duplicates=off|flag|reject|merge decides what is done with the new chapters that copy chapters already indexed.
+func (app *application) upsertVectorHandler(w http.ResponseWriter, r *http.Request) {
+	policy, err := app.duplicatePolicyFromQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	fullSync := false
+	if value := r.URL.Query().Get("full_sync"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid full_sync value: %w", err))
+			return
+		}
+		fullSync = parsed
+	}
+
+	var documents CreateDocumentsPayload
+	if err := readJSON(w, r, &documents); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(documents); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	userId := "1"
+	var formatedDocuments []store.Document
+	for _, document := range documents.Documents {
+		formatedDocuments = append(formatedDocuments, createFormatedDocument(document, userId).Documents...)
+	}
+
+	ctx := r.Context()
+	collection := getCollectionFromCtx(r)
+	formatedDocuments, duplicates, err := app.screenUpsertDocuments(ctx, r, collection, policy, formatedDocuments)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	report, err := app.weaviateStore.Vectors.UpsertVectors(ctx, collection, &store.RagData{
+		UserID:    userId,
+		Documents: formatedDocuments,
+	}, fullSync)
 	if err != nil {
 		switch {
-		case errors.Is(err, store.ErrChapterAlreadyExists):
+		case errors.Is(err, store.ErrDuplicateChapter):
 			app.badRequestError(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
+	app.recordChapterChanges(ctx, versionScopeFromCtx(r), getPrincipalFromCtx(r).UserID, report.Changes)
+	if len(report.Updated) > 0 || len(report.Deleted) > 0 {
+		app.invalidateAllRelated(ctx, collection)
+	}
 
-	if err := app.jsonResponse(w, http.StatusCreated, vectorsCreated); err != nil {
+	if err := app.jsonResponse(w, http.StatusOK, UpsertVectorsResponse{UpsertReport: report, Duplicates: duplicates}); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+}
+
+// screenUpsertDocuments applies the duplicate policy to the chapters of an upsert that are not indexed yet,
+// the chapters indexed under the same name are updated by the upsert. It returns the documents to upsert.
+func (app *application) screenUpsertDocuments(ctx context.Context, r *http.Request, collection store.Collection, policy store.DuplicatePolicy, docs []store.Document) ([]store.Document, []UpsertDuplicate, error) {
+	duplicates := []UpsertDuplicate{}
+	if policy == store.DuplicateOff || policy == "" {
+		return docs, duplicates, nil
+	}
+
+	// the chapters the caller can not read are still updated, not screened
+	all := collection
+	all.Reader = nil
+	var upserted, screened []store.Document
+	for _, doc := range docs {
+		_, err := app.weaviateStore.Vectors.GetObjectIDByChapter(ctx, all, doc.Chapter)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			screened = append(screened, doc)
+		case err != nil:
+			return nil, nil, err
+		default:
+			upserted = append(upserted, doc)
+		}
+	}
 
+	decisions := app.screenDocuments(ctx, app.logger, collection, policy, versionScopeFromCtx(r), getPrincipalFromCtx(r).UserID, screened)
+	for i, doc := range screened {
+		decision := decisions[i]
+		if decision.indexed {
+			upserted = append(upserted, doc)
+		}
+		if decision.duplicateOf != "" || !decision.indexed {
+			duplicates = append(duplicates, UpsertDuplicate{
+				Chapter:     doc.Chapter,
+				DuplicateOf: decision.duplicateOf,
+				Indexed:     decision.indexed,
+				Error:       decision.err,
+			})
+		}
+	}
+	return upserted, duplicates, nil
 }
 
 func (app *application) userQuestionHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	started := time.Now()
 	var query UserQuery
 
 	if err := readJSON(w, r, &query); err != nil {
@@ -83,6 +215,7 @@ func (app *application) userQuestionHandler(w http.ResponseWriter, r *http.Reque
 
 	// Normalize the user's question (if needed)
 	questionUser := strings.ReplaceAll(strings.TrimSpace(query.UserMessage), "\n", " ")
+	originalQuestion := questionUser
 
 	//check if chat_history exists in redis, if it does the users question and history are to make a standalone question
 	if chatHist, ok := memory["chat_history"].(string); ok && chatHist != "" {
@@ -96,19 +229,31 @@ func (app *application) userQuestionHandler(w http.ResponseWriter, r *http.Reque
 
 	app.logger.Debugln("Question used for the main chain ", questionUser)
 
+	// the questions with an approved answer get it as it is, the documentation is not searched
+	match, err := app.matchFAQ(ctx, r, questionUser)
+	if err != nil {
+		app.logger.Errorw("error matching the question with the faq", "error", err)
+	}
+	if match != nil {
+		app.faqAnswerResponse(w, r, match, originalQuestion, questionUser, started)
+		return
+	}
+
 	//gets standalone question to get the date from the DB
-	similarDocs, err := app.weaviateStore.Vectors.GetClosestVectors(ctx, questionUser)
+	hits, err := app.weaviateStore.Vectors.GetClosestVectors(ctx, getCollectionFromCtx(r), questionUser, query.Filter)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
+			// the questions without any close chapter are the gaps of the documentation
+			app.recordQueryEvent(queryEvent(r, originalQuestion, questionUser, nil, "", started))
 			app.notFoundResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
-	// put all the docs in a array of string
-	// may in ht future change the GetClosestVectors return value
+	// put all the docs in a array of string, best first
+	similarDocs := store.HitDocuments(hits)
 	var docs []string
 	for _, doc := range similarDocs {
 		jsonData, err := json.Marshal(doc)
@@ -148,6 +293,19 @@ func (app *application) userQuestionHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// the model can only link to the documentation it was given, any other url is made up
+	if answer, ok := finalRagAnswer["text"].(string); ok {
+		sanitized, removed := sanitizeAnswerLinks(answer, similarDocs)
+		if len(removed) > 0 {
+			app.logger.Warnw("removed unknown links from the answer", "urls", removed)
+		}
+		finalRagAnswer["text"] = sanitized
+	}
+	finalRagAnswer["citations"] = citationsFromHits(hits)
+
+	answer, _ := finalRagAnswer["text"].(string)
+	app.recordQueryEvent(queryEvent(r, originalQuestion, questionUser, hits, answer, started))
+
 	if err := app.jsonResponse(w, http.StatusOK, finalRagAnswer); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -158,16 +316,30 @@ type GetChapterNameIDBody struct {
 	ChapterName string `json:"chapter_name" validate:"required,max=100"`
 }
 
+// getObjectIDByChapterHandler returns the id of a chapter from ?chapter_name=, the json body is still read
+// when the param is missing for the older clients
 func (app *application) getObjectIDByChapterHandler(w http.ResponseWriter, r *http.Request) {
 	var chapterName GetChapterNameIDBody
-	if err := readJSON(w, r, &chapterName); err != nil {
+	chapterName.ChapterName = r.URL.Query().Get("chapter_name")
+	if chapterName.ChapterName == "" {
+		if err := readJSON(w, r, &chapterName); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+	}
+	if err := Validate.Struct(chapterName); err != nil {
 		app.badRequestError(w, r, err)
 		return
 	}
 	ctx := r.Context()
-	objectIDRetrieved, err := app.weaviateStore.Vectors.GetObjectIDByChapter(ctx, chapterName.ChapterName)
+	objectIDRetrieved, err := app.weaviateStore.Vectors.GetObjectIDByChapter(ctx, getCollectionFromCtx(r), chapterName.ChapterName)
 	if err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 	if err := app.jsonResponse(w, http.StatusOK, objectIDRetrieved); err != nil {
@@ -181,7 +353,24 @@ func (app *application) deleteVectorObjectByIdHandler(w http.ResponseWriter, r *
 	//fmt.Print(r.PathValue(id))
 
 	ctx := r.Context()
-	response, err := app.weaviateStore.Vectors.DeleteObjectWithID(ctx, id)
+	collection := getCollectionFromCtx(r)
+
+	// the text of the chapter is kept in its versions, so that it can be restored
+	previous, err := app.weaviateStore.Vectors.GetObjectWithID(ctx, collection, id)
+	if err == nil {
+		err = app.ensureOriginalChapterVersion(ctx, versionScopeFromCtx(r), id, previous)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	response, err := app.weaviateStore.Vectors.DeleteObjectWithID(ctx, collection, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
@@ -192,6 +381,8 @@ func (app *application) deleteVectorObjectByIdHandler(w http.ResponseWriter, r *
 		}
 		return
 	}
+	app.recordChapterVersion(ctx, versionScopeFromCtx(r), id, store.VersionActionDelete, getPrincipalFromCtx(r).UserID, store.Document{}, *previous)
+	app.invalidateRelated(ctx, collection, id)
 
 	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
 		app.internalServerError(w, r, err)
@@ -211,6 +402,7 @@ func (app *application) updateVectorObjectByIdHandler(w http.ResponseWriter, r *
 	//validate the user input
 	if err := Validate.Struct(document); err != nil {
 		app.badRequestError(w, r, err)
+		return
 	}
 
 	userId := "1"
@@ -218,8 +410,34 @@ func (app *application) updateVectorObjectByIdHandler(w http.ResponseWriter, r *
 	formatedDocuments := createFormatedDocument(document.Documents, userId)
 
 	ctx := r.Context()
+	collection := getCollectionFromCtx(r)
+
+	previous, err := app.weaviateStore.Vectors.GetObjectWithID(ctx, collection, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the fields left out of the payload keep their value, an empty access must be sent to make a chapter public
+	updated := &formatedDocuments.Documents[0]
+	keepOmittedFields(updated, previous)
+	if !reflect.DeepEqual(updated.Access, previous.Access) && !isAdmin(getPrincipalFromCtx(r)) {
+		app.forbiddenResponse(w, r, ErrorAccessChangeForbidden)
+		return
+	}
+
+	if err := app.ensureOriginalChapterVersion(ctx, versionScopeFromCtx(r), id, previous); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	//it just updates one document (the position 0 of  formatedDocuments.Documents[0])
-	response, err := app.weaviateStore.Vectors.UpdateObjectWithID(ctx, formatedDocuments.Documents[0], id)
+	response, err := app.weaviateStore.Vectors.UpdateObjectWithID(ctx, collection, formatedDocuments.Documents[0], id)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
@@ -229,6 +447,8 @@ func (app *application) updateVectorObjectByIdHandler(w http.ResponseWriter, r *
 		}
 		return
 	}
+	app.recordChapterVersion(ctx, versionScopeFromCtx(r), id, store.VersionActionUpdate, getPrincipalFromCtx(r).UserID, *previous, formatedDocuments.Documents[0])
+	app.invalidateRelated(ctx, collection, id)
 
 	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
 		app.internalServerError(w, r, err)
@@ -236,6 +456,25 @@ func (app *application) updateVectorObjectByIdHandler(w http.ResponseWriter, r *
 	}
 }
 
+// keepOmittedFields sets the fields of the document that the payload left out to their previous value
+func keepOmittedFields(document *store.Document, previous *store.Document) {
+	if document.Source == "" {
+		document.Source = previous.Source
+	}
+	if document.Metadata == nil {
+		document.Metadata = previous.Metadata
+	}
+	if document.Access == nil {
+		document.Access = previous.Access
+	}
+	if document.URL == "" {
+		document.URL = previous.URL
+	}
+	if document.Breadcrumb == nil {
+		document.Breadcrumb = previous.Breadcrumb
+	}
+}
+
 func createFormatedDocument(documents store.Document, userId string) *store.RagData {
 	var aggregatedDocuments []store.Document
 
@@ -245,6 +484,8 @@ func createFormatedDocument(documents store.Document, userId string) *store.RagD
 		subsections = append(subsections, store.Subsection{
 			Title:   subsection.Title,
 			Content: subsection.Content,
+			Pages:   subsection.Pages,
+			Anchor:  subsection.Anchor,
 		})
 	}
 
@@ -252,6 +493,11 @@ func createFormatedDocument(documents store.Document, userId string) *store.RagD
 	aggregatedDocuments = append(aggregatedDocuments, store.Document{
 		Chapter:     documents.Chapter,
 		Subsections: subsections,
+		Source:      documents.Source,
+		Metadata:    documents.Metadata,
+		Access:      documents.Access,
+		URL:         documents.URL,
+		Breadcrumb:  documents.Breadcrumb,
 	})
 
 	formatedDocuments := &store.RagData{
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+// relatedChaptersHandler returns the chapters most similar to the chapter {id}, for the related topics panel of the docs pages.
+// ?limit= sets the number of chapters and the metadata query params filter them like the queries.
+// The lists are cached in redis until one of their chapters changes.
+func (app *application) relatedChaptersHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid limit value: %w", err))
+			return
+		}
+		limit = parsed
+	}
+	filter := metadataFilterFromQuery(r)
+
+	ctx := r.Context()
+	collection := getCollectionFromCtx(r)
+
+	// the cache only saves the search, the chapters are read from weaviate when it is down
+	related, err := app.redisStore.RelatedChapters.Get(ctx, collection, id, filter, limit)
+	if err != nil {
+		app.logger.Warnw("error reading cached related chapters", "id", id, "error", err)
+	}
+	if related == nil {
+		related, err = app.weaviateStore.Vectors.RelatedChapters(ctx, collection, id, filter, limit)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		if err := app.redisStore.RelatedChapters.Set(ctx, collection, id, filter, limit, related); err != nil {
+			app.logger.Warnw("error caching related chapters", "id", id, "error", err)
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, related); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// invalidateRelated drops the cached related chapters of the chapters and the lists they are part of
+func (app *application) invalidateRelated(ctx context.Context, collection store.Collection, ids ...string) {
+	if err := app.redisStore.RelatedChapters.Invalidate(ctx, collection, ids...); err != nil {
+		app.logger.Errorw("error invalidating cached related chapters", "class", collection.Class, "ids", ids, "error", err)
+	}
+}
+
+// invalidateAllRelated drops every cached list of the knowledge base, for the changes of many chapters at once
+func (app *application) invalidateAllRelated(ctx context.Context, collection store.Collection) {
+	if err := app.redisStore.RelatedChapters.InvalidateCollection(ctx, collection); err != nil {
+		app.logger.Errorw("error invalidating cached related chapters", "class", collection.Class, "error", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+// searchHandler returns the subsections matching ?q= without generating an answer, for the search box of the docs site.
+// ?mode=vector|hybrid|keyword overrides the RETRIEVAL_MODE of the config, ?limit= and ?offset= select the page
+// and the metadata query params filter the chapters like the queries.
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := store.SearchQuery{
+		Query:  params.Get("q"),
+		Filter: metadataFilterFromQuery(r),
+	}
+	if query.Query == "" {
+		app.badRequestError(w, r, ErrorMissingSearchQuery)
+		return
+	}
+	mode, err := store.ParseSearchMode(params.Get("mode"), app.config.retrieval.mode)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	query.Mode = mode
+	if value := params.Get("limit"); value != "" {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid limit value: %w", err))
+			return
+		}
+	}
+	if value := params.Get("offset"); value != "" {
+		query.Offset, err = strconv.Atoi(value)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid offset value: %w", err))
+			return
+		}
+	}
+
+	page, err := app.weaviateStore.Vectors.Search(r.Context(), getCollectionFromCtx(r), query)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrUnknownSearchMode):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+type tenantKey string
+
+const tenantCtx tenantKey = "tenant"
+
+// same rule as weaviate for the names of the tenants
+var tenantNameRegexp = regexp.MustCompile(`^[A-Za-z0-9\-_]+$`)
+
+type CreateTenantPayload struct {
+	Name            string   `json:"name" validate:"required,max=64"`
+	GapReportEmails []string `json:"gap_report_emails" validate:"max=20,dive,required,email"`
+}
+
+type GapReportEmailsPayload struct {
+	Emails []string `json:"emails" validate:"max=20,dive,required,email"`
+}
+
+func getTenantFromCtx(r *http.Request) *store.Tenant {
+	tenant, _ := r.Context().Value(tenantCtx).(*store.Tenant)
+	return tenant
+}
+
+// getCollectionFromCtx returns the classes of the knowledge base of the request scoped to the tenant of the caller,
+// the reads are limited to the documents the caller can access
+func getCollectionFromCtx(r *http.Request) store.Collection {
+	collection := getKnowledgeBaseFromCtx(r).Collection(getTenantFromCtx(r).Name)
+	collection.Reader = getPrincipalFromCtx(r)
+	return collection
+}
+
+// tenantNameMiddleware loads the tenant of the {tenantName} url param for the tenant management endpoints
+func (app *application) tenantNameMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tenant, err := app.postgreStore.Tenants.GetByName(ctx, chi.URLParam(r, "tenantName"))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, tenantCtx, tenant)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// createTenantHandler registers an organization and creates its tenant in every knowledge base
+func (app *application) createTenantHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateTenantPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if !tenantNameRegexp.MatchString(payload.Name) {
+		app.badRequestError(w, r, ErrorInvalidTenantName)
+		return
+	}
+
+	ctx := r.Context()
+	tenant := &store.Tenant{Name: payload.Name, GapReportEmails: payload.GapReportEmails}
+	if err := app.postgreStore.Tenants.Create(ctx, tenant); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateTenant):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	kbs, err := app.postgreStore.KnowledgeBases.List(ctx)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	for _, kb := range kbs {
+		if err := app.weaviateStore.Vectors.CreateTenant(ctx, kb.Collection(tenant.Name)); err != nil {
+			// the weaviate tenants already created are reused when the tenant is created again
+			if deleteErr := app.postgreStore.Tenants.Delete(ctx, tenant.ID); deleteErr != nil {
+				app.logger.Errorw("error removing tenant", "name", tenant.Name, "error", deleteErr)
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tenant); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) listTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	tenants, err := app.postgreStore.Tenants.List(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tenants); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) activateTenantHandler(w http.ResponseWriter, r *http.Request) {
+	app.setTenantActive(w, r, true)
+}
+
+// deactivateTenantHandler blocks the tokens of the organization and offloads its objects, they are kept until the tenant is deleted
+func (app *application) deactivateTenantHandler(w http.ResponseWriter, r *http.Request) {
+	app.setTenantActive(w, r, false)
+}
+
+func (app *application) setTenantActive(w http.ResponseWriter, r *http.Request, active bool) {
+	tenant := getTenantFromCtx(r)
+	ctx := r.Context()
+
+	kbs, err := app.postgreStore.KnowledgeBases.List(ctx)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	for _, kb := range kbs {
+		if err := app.weaviateStore.Vectors.SetTenantActive(ctx, kb.Collection(tenant.Name), active); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	tenant.IsActive = active
+	if err := app.postgreStore.Tenants.SetActive(ctx, tenant); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tenant); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// setGapReportEmailsHandler replaces the emails that get the knowledge gap reports of the tenant,
+// no report is sent for a tenant without emails
+func (app *application) setGapReportEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	var payload GapReportEmailsPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	tenant := getTenantFromCtx(r)
+	tenant.GapReportEmails = payload.Emails
+	if err := app.postgreStore.Tenants.SetGapReportEmails(r.Context(), tenant); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tenant); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteTenantHandler deletes an organization with all its objects in every knowledge base
+func (app *application) deleteTenantHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := getTenantFromCtx(r)
+	ctx := r.Context()
+
+	kbs, err := app.postgreStore.KnowledgeBases.List(ctx)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	for _, kb := range kbs {
+		if err := app.weaviateStore.Vectors.DeleteTenant(ctx, kb.Collection(tenant.Name)); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.postgreStore.Tenants.Delete(ctx, tenant.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createKnowledgeBaseTenants creates in the classes of a knowledge base the tenants of all the organizations
+func (app *application) createKnowledgeBaseTenants(ctx context.Context, kb *store.KnowledgeBase) error {
+	tenants, err := app.postgreStore.Tenants.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		collection := kb.Collection(tenant.Name)
+		if err := app.weaviateStore.Vectors.CreateTenant(ctx, collection); err != nil {
+			return err
+		}
+		if !tenant.IsActive {
+			if err := app.weaviateStore.Vectors.SetTenantActive(ctx, collection, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/importer"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+const maxUploadSize = 32 << 20 // 32mb for all the files of a request
+
+type ParsedDocumentsResponse struct {
+	Documents []store.Document `json:"documents"`
+}
+
+// uploadDocumentsHandler parses the files of a multipart form (field "files") into documents and queues them for ingestion.
+// The fields product, version, language, audience and tags (comma separated) are set as metadata of every document,
+// allowed_roles, allowed_groups and allowed_users (comma separated) restrict who can read them and url is the
+// page of the published documentation the file is rendered at.
+// With ?dry_run=true the parsed documents are returned without being indexed, ?duplicates= is the duplicate policy of the job.
+func (app *application) uploadDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("invalid dry_run value: %w", err))
+			return
+		}
+		dryRun = parsed
+	}
+	policy, err := app.duplicatePolicyFromQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	files := r.MultipartForm.File["files"]
+	if len(files) == 0 {
+		app.badRequestError(w, r, ErrorMissingUploadedFiles)
+		return
+	}
+
+	var documents []store.Document
+	for _, fileHeader := range files {
+		docs, err := parseUploadedFile(fileHeader)
+		if err != nil {
+			app.badRequestError(w, r, fmt.Errorf("error parsing file %s: %w", fileHeader.Filename, err))
+			return
+		}
+		documents = append(documents, docs...)
+	}
+
+	metadata := uploadedMetadata(r)
+	access := uploadedAccess(r)
+	for i := range documents {
+		documents[i].Metadata = metadata
+		documents[i].Access = access
+		documents[i].URL = strings.TrimSpace(r.FormValue("url"))
+	}
+
+	if dryRun {
+		if err := app.jsonResponse(w, http.StatusOK, ParsedDocumentsResponse{Documents: documents}); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	ctx := r.Context()
+
+	job, err := app.enqueueIngestion(ctx, getKnowledgeBaseFromCtx(r), getTenantFromCtx(r), getPrincipalFromCtx(r), policy, documents)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, job); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// uploadedMetadata reads the metadata fields of the form, nil when none is set
+func uploadedMetadata(r *http.Request) *store.Metadata {
+	metadata := &store.Metadata{
+		Product:  strings.TrimSpace(r.FormValue("product")),
+		Version:  strings.TrimSpace(r.FormValue("version")),
+		Language: strings.TrimSpace(r.FormValue("language")),
+		Audience: strings.TrimSpace(r.FormValue("audience")),
+	}
+	metadata.Tags = formList(r, "tags")
+	if metadata.IsEmpty() {
+		return nil
+	}
+	return metadata
+}
+
+// uploadedAccess reads the access lists of the form, nil when the documents are not restricted
+func uploadedAccess(r *http.Request) *store.Access {
+	access := &store.Access{
+		Roles:  formList(r, "allowed_roles"),
+		Groups: formList(r, "allowed_groups"),
+		Users:  formList(r, "allowed_users"),
+	}
+	if !access.IsRestricted() {
+		return nil
+	}
+	return access
+}
+
+// formList splits a comma separated form field
+func formList(r *http.Request, field string) []string {
+	return splitList(r.FormValue(field))
+}
+
+// splitList returns the non empty values of a comma separated list
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func parseUploadedFile(fileHeader *multipart.FileHeader) ([]store.Document, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".md", ".markdown":
+		return importer.ParseMarkdown(file, fileHeader.Filename)
+	case ".pdf":
+		return importer.ParsePDF(file, fileHeader.Size, fileHeader.Filename)
+	case ".docx":
+		return importer.ParseDOCX(file, fileHeader.Size, fileHeader.Filename)
+	default:
+		return nil, ErrorUnsupportedFileType
+	}
+}
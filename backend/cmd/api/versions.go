@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+type ChapterVersionsDiffResponse struct {
+	From int                 `json:"from"`
+	To   int                 `json:"to"`
+	Diff *store.DocumentDiff `json:"diff"`
+}
+
+// versionScope is the knowledge base and the tenant the versions of a chapter are saved in
+type versionScope struct {
+	knowledgeBase string
+	tenant        string
+}
+
+func versionScopeFromCtx(r *http.Request) versionScope {
+	return versionScope{knowledgeBase: getKnowledgeBaseFromCtx(r).Name, tenant: getTenantFromCtx(r).Name}
+}
+
+// chapters get their first version on their first change, so before it the text they had is saved as the original version
+func (app *application) ensureOriginalChapterVersion(ctx context.Context, scope versionScope, objectID string, document *store.Document) error {
+	versions, err := app.postgreStore.Versions.List(ctx, scope.knowledgeBase, scope.tenant, objectID)
+	if err != nil {
+		return err
+	}
+	if len(versions) > 0 {
+		return nil
+	}
+	return app.postgreStore.Versions.Create(ctx, &store.ChapterVersion{
+		KnowledgeBase: scope.knowledgeBase,
+		Tenant:        scope.tenant,
+		ObjectID:      objectID,
+		Action:        store.VersionActionOriginal,
+		Document:      *document,
+	})
+}
+
+// recordChapterVersion saves the new text of a chapter with what changed from the previous one.
+// The chapter is already changed in weaviate, so an error is only logged.
+func (app *application) recordChapterVersion(ctx context.Context, scope versionScope, objectID string, action string, userID string, previous store.Document, current store.Document) {
+	diff := store.DiffDocuments(previous, current)
+	if action == store.VersionActionDelete {
+		// a delete version keeps the deleted text, every subsection of it is removed
+		diff = store.DiffDocuments(current, store.Document{})
+	}
+
+	err := app.postgreStore.Versions.Create(ctx, &store.ChapterVersion{
+		KnowledgeBase: scope.knowledgeBase,
+		Tenant:        scope.tenant,
+		ObjectID:      objectID,
+		Action:        action,
+		UserID:        userID,
+		Document:      current,
+		Diff:          diff,
+	})
+	if err != nil {
+		app.logger.Errorw("error saving chapter version", "object_id", objectID, "action", action, "error", err)
+	}
+}
+
+// recordChapterChanges saves the versions of the chapters updated or deleted by an upsert or an import
+func (app *application) recordChapterChanges(ctx context.Context, scope versionScope, userID string, changes []store.ChapterChange) {
+	for _, change := range changes {
+		if err := app.ensureOriginalChapterVersion(ctx, scope, change.ID, &change.Previous); err != nil {
+			app.logger.Errorw("error saving chapter version", "object_id", change.ID, "action", store.VersionActionOriginal, "error", err)
+			continue
+		}
+		if change.Current == nil {
+			app.recordChapterVersion(ctx, scope, change.ID, store.VersionActionDelete, userID, store.Document{}, change.Previous)
+			continue
+		}
+		app.recordChapterVersion(ctx, scope, change.ID, store.VersionActionUpdate, userID, change.Previous, *change.Current)
+	}
+}
+
+func (app *application) listChapterVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	ctx := r.Context()
+
+	versions, err := app.postgreStore.Versions.List(ctx, getKnowledgeBaseFromCtx(r).Name, getTenantFromCtx(r).Name, id)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	// the versions the caller can not read are left out, like the documents themselves
+	principal := getPrincipalFromCtx(r)
+	versions = slices.DeleteFunc(versions, func(version *store.ChapterVersion) bool {
+		return !version.Document.Access.Allows(principal)
+	})
+	if len(versions) == 0 {
+		app.notFoundResponse(w, r, fmt.Errorf("no versions for object with id %s: %w", id, store.ErrNotFound))
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, versions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// diffChapterVersionsHandler compares two versions of a chapter, ?from=1&to=3
+func (app *application) diffChapterVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		app.badRequestError(w, r, fmt.Errorf("invalid from version: %w", err))
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		app.badRequestError(w, r, fmt.Errorf("invalid to version: %w", err))
+		return
+	}
+
+	fromVersion, ok := app.getChapterVersion(w, r, from)
+	if !ok {
+		return
+	}
+	toVersion, ok := app.getChapterVersion(w, r, to)
+	if !ok {
+		return
+	}
+
+	response := ChapterVersionsDiffResponse{
+		From: from,
+		To:   to,
+		Diff: store.DiffDocuments(fromVersion.Document, toVersion.Document),
+	}
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// rollbackChapterHandler writes back the text of an earlier version and re-indexes its chunks.
+// A deleted chapter is created again with the same id.
+func (app *application) rollbackChapterHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		app.badRequestError(w, r, fmt.Errorf("invalid version: %w", err))
+		return
+	}
+
+	target, ok := app.getChapterVersion(w, r, version)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	collection := getCollectionFromCtx(r)
+
+	var previous store.Document
+	current, err := app.weaviateStore.Vectors.GetObjectWithID(ctx, collection, id)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		objects := []store.ExportedObject{{ID: id, Document: target.Document}}
+		if _, err := app.weaviateStore.Vectors.ImportObjects(ctx, collection, objects, store.ConflictFail); err != nil {
+			switch {
+			case errors.Is(err, store.ErrImportConflict):
+				app.conflictResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	case err != nil:
+		app.internalServerError(w, r, err)
+		return
+	default:
+		previous = *current
+		if _, err := app.weaviateStore.Vectors.UpdateObjectWithID(ctx, collection, target.Document, id); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	app.recordChapterVersion(ctx, versionScopeFromCtx(r), id, store.VersionActionRollback, getPrincipalFromCtx(r).UserID, previous, target.Document)
+	app.invalidateRelated(ctx, collection, id)
+
+	response := &store.SuccessfullyAPIOperation{
+		Message: fmt.Sprintf("Object rolled back to version %d", version),
+	}
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getChapterVersion(w http.ResponseWriter, r *http.Request, version int) (*store.ChapterVersion, bool) {
+	chapterVersion, err := app.postgreStore.Versions.GetByVersion(r.Context(), getKnowledgeBaseFromCtx(r).Name, getTenantFromCtx(r).Name, r.PathValue("id"), version)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, fmt.Errorf("version %d: %w", version, err))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+	if !chapterVersion.Document.Access.Allows(getPrincipalFromCtx(r)) {
+		app.notFoundResponse(w, r, fmt.Errorf("version %d: %w", version, store.ErrNotFound))
+		return nil, false
+	}
+	return chapterVersion, true
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ingestion_job_chapters;
+DROP TABLE IF EXISTS ingestion_jobs;
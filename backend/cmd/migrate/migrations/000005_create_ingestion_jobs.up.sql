@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS ingestion_jobs (
+    job_id bigserial PRIMARY KEY,
+    user_id varchar(50) NOT NULL,
+    status varchar(30) NOT NULL DEFAULT 'queued',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    started_at timestamp(0) with time zone,
+    finished_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingestion_jobs_status ON ingestion_jobs (status, created_at);
+
+CREATE TABLE IF NOT EXISTS ingestion_job_chapters (
+    id bigserial PRIMARY KEY,
+    job_id bigint NOT NULL REFERENCES ingestion_jobs (job_id) ON DELETE CASCADE,
+    position int NOT NULL,
+    chapter text NOT NULL,
+    document jsonb NOT NULL,
+    status varchar(20) NOT NULL DEFAULT 'pending',
+    attempts int NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT '',
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingestion_job_chapters_job_id ON ingestion_job_chapters (job_id, position);
@@ -0,0 +1,2 @@
+ALTER TABLE ingestion_jobs DROP COLUMN IF EXISTS knowledge_base;
+DROP TABLE IF EXISTS knowledge_bases;
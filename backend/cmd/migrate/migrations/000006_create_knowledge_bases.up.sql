@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS knowledge_bases (
+    kb_id bigserial PRIMARY KEY,
+    name varchar(50) UNIQUE NOT NULL,
+    description text NOT NULL DEFAULT '',
+    class_name varchar(100) UNIQUE NOT NULL,
+    vectorizer varchar(100) NOT NULL,
+    vectorizer_config jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+-- the corpus that lived in the hard coded Book class becomes the default knowledge base
+INSERT INTO knowledge_bases (name, description, class_name, vectorizer)
+VALUES ('default', 'default knowledge base', 'Book', 'text2vec-transformers')
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE ingestion_jobs ADD COLUMN IF NOT EXISTS knowledge_base varchar(50) NOT NULL DEFAULT 'default';
@@ -0,0 +1,2 @@
+ALTER TABLE ingestion_jobs DROP COLUMN IF EXISTS tenant;
+DROP TABLE IF EXISTS tenants;
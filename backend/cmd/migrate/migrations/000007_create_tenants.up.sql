@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS tenants (
+    tenant_id bigserial PRIMARY KEY,
+    name varchar(64) UNIQUE NOT NULL,
+    is_active boolean NOT NULL DEFAULT TRUE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE ingestion_jobs ADD COLUMN IF NOT EXISTS tenant varchar(64) NOT NULL DEFAULT '';
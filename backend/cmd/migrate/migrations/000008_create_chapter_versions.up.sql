@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS chapter_versions (
+    id bigserial PRIMARY KEY,
+    knowledge_base varchar(50) NOT NULL,
+    tenant varchar(64) NOT NULL,
+    object_id varchar(36) NOT NULL,
+    version int NOT NULL,
+    action varchar(20) NOT NULL,
+    user_id varchar(50) NOT NULL,
+    document jsonb NOT NULL,
+    diff jsonb,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (knowledge_base, tenant, object_id, version)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS vector_chunks;
+DROP TABLE IF EXISTS vector_chapters;
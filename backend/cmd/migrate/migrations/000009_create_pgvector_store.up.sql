@@ -0,0 +1,45 @@
+-- the database needs the pgvector extension whatever the VECTOR_BACKEND is, the faq questions are stored with it too
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'vector') THEN
+        RAISE EXCEPTION 'the pgvector extension is required, use a postgres with pgvector installed like the pgvector/pgvector image of docker/docker-compose.yml';
+    END IF;
+END
+$$;
+
+CREATE EXTENSION IF NOT EXISTS vector;
+
+-- used when VECTOR_BACKEND=pgvector, a knowledge base is identified by its class name like in weaviate
+CREATE TABLE IF NOT EXISTS vector_chapters (
+    id uuid PRIMARY KEY,
+    collection varchar(100) NOT NULL,
+    tenant varchar(64) NOT NULL,
+    chapter text NOT NULL,
+    subsections jsonb NOT NULL DEFAULT '[]',
+    source text NOT NULL DEFAULT '',
+    content_hash varchar(64) NOT NULL DEFAULT '',
+    subsection_hashes text[] NOT NULL DEFAULT '{}',
+    vector vector NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (collection, tenant, chapter)
+);
+
+-- the vectors have the dimensions of the configured embedder, so the column has no fixed size and is scanned without an index
+CREATE TABLE IF NOT EXISTS vector_chunks (
+    id bigserial PRIMARY KEY,
+    chapter_id uuid NOT NULL REFERENCES vector_chapters (id) ON DELETE CASCADE,
+    collection varchar(100) NOT NULL,
+    tenant varchar(64) NOT NULL,
+    chapter text NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    subsection_index int NOT NULL,
+    chunk_index int NOT NULL,
+    source text NOT NULL DEFAULT '',
+    pages int[] NOT NULL DEFAULT '{}',
+    vector vector NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_vector_chunks_collection ON vector_chunks (collection, tenant);
+CREATE INDEX IF NOT EXISTS idx_vector_chunks_chapter_id ON vector_chunks (chapter_id, subsection_index);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_vector_chunks_metadata;
+
+ALTER TABLE vector_chunks DROP COLUMN IF EXISTS metadata;
+ALTER TABLE vector_chapters DROP COLUMN IF EXISTS metadata;
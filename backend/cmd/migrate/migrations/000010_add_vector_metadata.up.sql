@@ -0,0 +1,4 @@
+ALTER TABLE vector_chapters ADD COLUMN IF NOT EXISTS metadata jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE vector_chunks ADD COLUMN IF NOT EXISTS metadata jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_vector_chunks_metadata ON vector_chunks USING gin (metadata);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_vector_chunks_acl_principals;
+
+ALTER TABLE vector_chunks DROP COLUMN IF EXISTS acl_principals;
+ALTER TABLE vector_chunks DROP COLUMN IF EXISTS acl_restricted;
+ALTER TABLE vector_chapters DROP COLUMN IF EXISTS acl_principals;
+ALTER TABLE vector_chapters DROP COLUMN IF EXISTS acl_restricted;
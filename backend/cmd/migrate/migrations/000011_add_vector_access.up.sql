@@ -0,0 +1,6 @@
+ALTER TABLE vector_chapters ADD COLUMN IF NOT EXISTS acl_restricted boolean NOT NULL DEFAULT false;
+ALTER TABLE vector_chapters ADD COLUMN IF NOT EXISTS acl_principals text[] NOT NULL DEFAULT '{}';
+ALTER TABLE vector_chunks ADD COLUMN IF NOT EXISTS acl_restricted boolean NOT NULL DEFAULT false;
+ALTER TABLE vector_chunks ADD COLUMN IF NOT EXISTS acl_principals text[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_vector_chunks_acl_principals ON vector_chunks USING gin (acl_principals);
@@ -0,0 +1,5 @@
+ALTER TABLE vector_chunks DROP COLUMN IF EXISTS breadcrumb;
+ALTER TABLE vector_chunks DROP COLUMN IF EXISTS anchor;
+ALTER TABLE vector_chunks DROP COLUMN IF EXISTS url;
+ALTER TABLE vector_chapters DROP COLUMN IF EXISTS breadcrumb;
+ALTER TABLE vector_chapters DROP COLUMN IF EXISTS url;
@@ -0,0 +1,5 @@
+ALTER TABLE vector_chapters ADD COLUMN IF NOT EXISTS url text NOT NULL DEFAULT '';
+ALTER TABLE vector_chapters ADD COLUMN IF NOT EXISTS breadcrumb text[] NOT NULL DEFAULT '{}';
+ALTER TABLE vector_chunks ADD COLUMN IF NOT EXISTS url text NOT NULL DEFAULT '';
+ALTER TABLE vector_chunks ADD COLUMN IF NOT EXISTS anchor text NOT NULL DEFAULT '';
+ALTER TABLE vector_chunks ADD COLUMN IF NOT EXISTS breadcrumb text[] NOT NULL DEFAULT '{}';
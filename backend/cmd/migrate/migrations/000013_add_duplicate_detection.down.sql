@@ -0,0 +1,6 @@
+ALTER TABLE ingestion_job_chapters DROP COLUMN IF EXISTS duplicate_of;
+ALTER TABLE ingestion_jobs DROP COLUMN IF EXISTS duplicate_policy;
+
+DROP INDEX IF EXISTS idx_vector_chapters_text_hash;
+
+ALTER TABLE vector_chapters DROP COLUMN IF EXISTS text_hash;
@@ -0,0 +1,6 @@
+ALTER TABLE vector_chapters ADD COLUMN IF NOT EXISTS text_hash varchar(64) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_vector_chapters_text_hash ON vector_chapters (collection, tenant, text_hash);
+
+ALTER TABLE ingestion_jobs ADD COLUMN IF NOT EXISTS duplicate_policy varchar(10) NOT NULL DEFAULT 'off';
+ALTER TABLE ingestion_job_chapters ADD COLUMN IF NOT EXISTS duplicate_of text NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS query_events (
+    id bigserial PRIMARY KEY,
+    knowledge_base varchar(50) NOT NULL,
+    tenant varchar(64) NOT NULL,
+    user_id varchar(50) NOT NULL DEFAULT '',
+    conversation_id varchar(100) NOT NULL DEFAULT '',
+    question text NOT NULL,
+    standalone_question text NOT NULL DEFAULT '',
+    retrieved jsonb NOT NULL DEFAULT '[]',
+    insufficient_info boolean NOT NULL DEFAULT false,
+    latency_ms int NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_query_events_created_at ON query_events (knowledge_base, tenant, created_at);
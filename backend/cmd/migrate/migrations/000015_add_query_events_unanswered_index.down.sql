@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_query_events_unanswered;
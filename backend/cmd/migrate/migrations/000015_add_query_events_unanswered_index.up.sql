@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_query_events_unanswered ON query_events (knowledge_base, tenant, created_at) WHERE insufficient_info;
@@ -0,0 +1,3 @@
+ALTER TABLE query_events DROP COLUMN IF EXISTS faq_id;
+DROP TABLE IF EXISTS faq_questions;
+DROP TABLE IF EXISTS faq_entries;
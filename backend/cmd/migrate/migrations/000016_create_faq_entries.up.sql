@@ -0,0 +1,25 @@
+-- approved answers returned as they are for the questions close enough to one of their variants
+CREATE TABLE IF NOT EXISTS faq_entries (
+    id bigserial PRIMARY KEY,
+    knowledge_base varchar(50) NOT NULL,
+    tenant varchar(64) NOT NULL,
+    answer text NOT NULL,
+    links jsonb NOT NULL DEFAULT '[]',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_faq_entries_scope ON faq_entries (knowledge_base, tenant);
+
+-- the vectors have the dimensions of the app embedder, like the ones of vector_chunks
+CREATE TABLE IF NOT EXISTS faq_questions (
+    id bigserial PRIMARY KEY,
+    faq_id bigint NOT NULL REFERENCES faq_entries (id) ON DELETE CASCADE,
+    position int NOT NULL,
+    question text NOT NULL,
+    vector vector NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_faq_questions_faq_id ON faq_questions (faq_id);
+
+ALTER TABLE query_events ADD COLUMN IF NOT EXISTS faq_id bigint;
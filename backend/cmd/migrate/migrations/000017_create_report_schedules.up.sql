@@ -0,0 +1,8 @@
+-- when the scheduled reports were last sent, shared by every instance of the api so that a report is sent once
+-- per interval even when the instances restart more often than that
+CREATE TABLE IF NOT EXISTS report_schedules (
+    name varchar(50) PRIMARY KEY,
+    last_sent_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO report_schedules (name) VALUES ('knowledge_gaps') ON CONFLICT DO NOTHING;
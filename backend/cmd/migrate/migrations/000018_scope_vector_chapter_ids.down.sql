@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_vector_chunks_chapter_id;
+CREATE INDEX IF NOT EXISTS idx_vector_chunks_chapter_id ON vector_chunks (chapter_id, subsection_index);
+
+ALTER TABLE vector_chunks DROP CONSTRAINT IF EXISTS vector_chunks_chapter_id_fkey;
+ALTER TABLE vector_chapters DROP CONSTRAINT IF EXISTS vector_chapters_pkey;
+ALTER TABLE vector_chapters ADD CONSTRAINT vector_chapters_pkey PRIMARY KEY (id);
+ALTER TABLE vector_chunks ADD CONSTRAINT vector_chunks_chapter_id_fkey FOREIGN KEY (chapter_id)
+    REFERENCES vector_chapters (id) ON DELETE CASCADE;
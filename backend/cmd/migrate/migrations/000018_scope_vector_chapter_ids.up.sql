@@ -0,0 +1,10 @@
+-- the ids of the chapters are unique in their knowledge base and tenant only, like in weaviate, so that an export
+-- can be imported in another tenant or knowledge base with the same ids
+ALTER TABLE vector_chunks DROP CONSTRAINT IF EXISTS vector_chunks_chapter_id_fkey;
+ALTER TABLE vector_chapters DROP CONSTRAINT IF EXISTS vector_chapters_pkey;
+ALTER TABLE vector_chapters ADD CONSTRAINT vector_chapters_pkey PRIMARY KEY (collection, tenant, id);
+ALTER TABLE vector_chunks ADD CONSTRAINT vector_chunks_chapter_id_fkey FOREIGN KEY (collection, tenant, chapter_id)
+    REFERENCES vector_chapters (collection, tenant, id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS idx_vector_chunks_chapter_id;
+CREATE INDEX IF NOT EXISTS idx_vector_chunks_chapter_id ON vector_chunks (collection, tenant, chapter_id, subsection_index);
@@ -0,0 +1,2 @@
+ALTER TABLE ingestion_jobs DROP COLUMN IF EXISTS error;
+ALTER TABLE ingestion_jobs DROP COLUMN IF EXISTS lease_expires_at;
@@ -0,0 +1,5 @@
+-- the instance running a job renews its lease while it works on it, the jobs whose lease expired were left by an
+-- instance that stopped and are queued again
+ALTER TABLE ingestion_jobs ADD COLUMN IF NOT EXISTS lease_expires_at timestamp(0) with time zone;
+-- why a job failed before any of its chapters could be indexed
+ALTER TABLE ingestion_jobs ADD COLUMN IF NOT EXISTS error text NOT NULL DEFAULT '';
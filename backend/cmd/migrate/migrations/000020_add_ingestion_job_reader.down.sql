@@ -0,0 +1,2 @@
+ALTER TABLE ingestion_jobs DROP COLUMN IF EXISTS user_groups;
+ALTER TABLE ingestion_jobs DROP COLUMN IF EXISTS user_roles;
@@ -0,0 +1,3 @@
+-- the roles and groups of the user who queued the job, the chapters they can not read are not screened against
+ALTER TABLE ingestion_jobs ADD COLUMN IF NOT EXISTS user_roles text[] NOT NULL DEFAULT '{}';
+ALTER TABLE ingestion_jobs ADD COLUMN IF NOT EXISTS user_groups text[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,2 @@
+-- the emails of the organization that get the knowledge gap reports of its own questions
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS gap_report_emails text[] NOT NULL DEFAULT '{}';
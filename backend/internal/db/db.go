@@ -10,7 +10,6 @@ import (
 
 	"github.com/redis/go-redis/v9"
 	"github.com/weaviate/weaviate-go-client/v4/weaviate"
-	"github.com/weaviate/weaviate/entities/models"
 )
 
 func NewWeaviateClient(host string, addr string) (*weaviate.Client, error) {
@@ -34,17 +33,6 @@ func NewWeaviateClient(host string, addr string) (*weaviate.Client, error) {
 		return nil, fmt.Errorf("weaviate is not live: status=%t", liveStatus)
 	}
 
-	// creating a Book Class if it does not exist yet
-	classObj := &models.Class{
-		Class:      "Book",
-		Vectorizer: "text2vec-transformers",
-	}
-	if err := client.Schema().ClassCreator().WithClass(classObj).Do(ctx); err != nil {
-		// Depending on your needs, you might want to check if the class already exists
-		// and ignore the error if so.
-		fmt.Println("failed to create class:", err)
-	}
-
 	fmt.Println("weaviate is running at ", addr)
 	return client, nil
 
@@ -100,3 +88,20 @@ func NewPostgreClient(addr string, maxOpenConns, maxIdleConns int, maxIdleTime s
 
 	return db, nil
 }
+
+// RequirePgVector returns an error when the pgvector extension is not created in the database,
+// the chapters of the pgvector backend and the faq questions are stored with it
+func RequirePgVector(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var installed bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'vector')`).Scan(&installed)
+	if err != nil {
+		return err
+	}
+	if !installed {
+		return fmt.Errorf("the pgvector extension is not installed in postgres, run the migrations on a postgres with pgvector")
+	}
+	return nil
+}
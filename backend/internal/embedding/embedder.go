@@ -0,0 +1,148 @@
+package embedding
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	ProviderOpenAI           = "openai"
+	ProviderOpenAICompatible = "openai-compatible"
+	ProviderHashing          = "hashing"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown embedding provider, use openai, openai-compatible or hashing")
+)
+
+// Embedder turns texts into vectors, so that the app and not weaviate decides which model is used
+type Embedder interface {
+	EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error)
+	EmbedQuery(ctx context.Context, text string) ([]float32, error)
+}
+
+type Config struct {
+	Provider   string
+	Model      string
+	APIKey     string
+	BaseURL    string // only for openai-compatible servers
+	Dimensions int    // only for the hashing embedder
+	CacheSize  int    // number of vectors kept in memory, 0 to disable the cache
+}
+
+// New returns the embedder of the provider of the config, nil when no provider is set
+func New(cfg Config) (Embedder, error) {
+	var embedder Embedder
+	var err error
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case ProviderOpenAI:
+		embedder, err = NewOpenAIEmbedder(cfg.APIKey, cfg.Model, "")
+	case ProviderOpenAICompatible:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("a base url is needed for the %s embedder", cfg.Provider)
+		}
+		embedder, err = NewOpenAIEmbedder(cfg.APIKey, cfg.Model, cfg.BaseURL)
+	case ProviderHashing:
+		embedder = NewHashingEmbedder(cfg.Dimensions)
+	default:
+		return nil, ErrUnknownProvider
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CacheSize > 0 {
+		embedder = NewCachedEmbedder(embedder, cfg.CacheSize)
+	}
+	return embedder, nil
+}
+
+// CachedEmbedder keeps the vectors of the last texts it embedded, so that the same chunk or
+// question is not sent to the model twice
+type CachedEmbedder struct {
+	embedder Embedder
+	size     int
+
+	mu      sync.Mutex
+	vectors map[[32]byte][]float32
+	order   [][32]byte // keys in insertion order, the oldest one is evicted first
+}
+
+func NewCachedEmbedder(embedder Embedder, size int) *CachedEmbedder {
+	return &CachedEmbedder{
+		embedder: embedder,
+		size:     size,
+		vectors:  make(map[[32]byte][]float32, size),
+	}
+}
+
+func (c *CachedEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	var missing []string
+	var missingIndexes []int
+	for i, text := range texts {
+		if vector, ok := c.get(text); ok {
+			vectors[i] = vector
+			continue
+		}
+		missing = append(missing, text)
+		missingIndexes = append(missingIndexes, i)
+	}
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := c.embedder.EmbedDocuments(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedded) != len(missing) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(embedded), len(missing))
+	}
+	for i, vector := range embedded {
+		vectors[missingIndexes[i]] = vector
+		c.put(missing[i], vector)
+	}
+	return vectors, nil
+}
+
+func (c *CachedEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	if vector, ok := c.get(text); ok {
+		return vector, nil
+	}
+	vector, err := c.embedder.EmbedQuery(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	c.put(text, vector)
+	return vector, nil
+}
+
+func (c *CachedEmbedder) get(text string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vector, ok := c.vectors[sha256.Sum256([]byte(text))]
+	return vector, ok
+}
+
+func (c *CachedEmbedder) put(text string, vector []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := sha256.Sum256([]byte(text))
+	if _, ok := c.vectors[key]; ok {
+		return
+	}
+	if len(c.order) >= c.size {
+		delete(c.vectors, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.vectors[key] = vector
+	c.order = append(c.order, key)
+}
@@ -0,0 +1,125 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// countingEmbedder records the texts sent to it, the vector of a text is its length
+type countingEmbedder struct {
+	embedded []string
+	err      error
+}
+
+func (c *countingEmbedder) EmbedDocuments(_ context.Context, texts []string) ([][]float32, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.embedded = append(c.embedded, texts...)
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vectors = append(vectors, []float32{float32(len(text))})
+	}
+	return vectors, nil
+}
+
+func (c *countingEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := c.EmbedDocuments(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    string
+		wantErr bool
+	}{
+		{name: "no provider", cfg: Config{}, want: "<nil>"},
+		{name: "hashing", cfg: Config{Provider: ProviderHashing}, want: "*embedding.HashingEmbedder"},
+		{name: "openai", cfg: Config{Provider: ProviderOpenAI, APIKey: "key"}, want: "*embedding.OpenAIEmbedder"},
+		{name: "openai compatible", cfg: Config{Provider: ProviderOpenAICompatible, APIKey: "key", BaseURL: "http://localhost:8000/v1"}, want: "*embedding.OpenAIEmbedder"},
+		{name: "openai compatible without a base url", cfg: Config{Provider: ProviderOpenAICompatible}, wantErr: true},
+		{name: "cached", cfg: Config{Provider: ProviderHashing, CacheSize: 10}, want: "*embedding.CachedEmbedder"},
+		{name: "unknown provider", cfg: Config{Provider: "word2vec"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedder, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := "<nil>"
+			if embedder != nil {
+				got = reflect.TypeOf(embedder).String()
+			}
+			if got != tt.want {
+				t.Errorf("New() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachedEmbedder(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingEmbedder{}
+	cached := NewCachedEmbedder(inner, 2)
+
+	vectors, err := cached.EmbedDocuments(ctx, []string{"a", "bb"})
+	if err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	if !reflect.DeepEqual(vectors, [][]float32{{1}, {2}}) {
+		t.Errorf("EmbedDocuments() = %v", vectors)
+	}
+
+	// only the text that is not cached is embedded, the vectors keep the order of the texts
+	vectors, err = cached.EmbedDocuments(ctx, []string{"bb", "ccc", "a"})
+	if err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	if !reflect.DeepEqual(vectors, [][]float32{{2}, {3}, {1}}) {
+		t.Errorf("EmbedDocuments() = %v", vectors)
+	}
+	if want := []string{"a", "bb", "ccc"}; !reflect.DeepEqual(inner.embedded, want) {
+		t.Errorf("embedded %q, want %q", inner.embedded, want)
+	}
+
+	// "a" was the oldest vector when "ccc" was added, so it is embedded again
+	if _, err := cached.EmbedQuery(ctx, "ccc"); err != nil {
+		t.Fatalf("EmbedQuery() error = %v", err)
+	}
+	if _, err := cached.EmbedQuery(ctx, "a"); err != nil {
+		t.Fatalf("EmbedQuery() error = %v", err)
+	}
+	if want := []string{"a", "bb", "ccc", "a"}; !reflect.DeepEqual(inner.embedded, want) {
+		t.Errorf("embedded %q, want %q", inner.embedded, want)
+	}
+}
+
+func TestCachedEmbedderError(t *testing.T) {
+	errEmbedding := errors.New("model unavailable")
+	inner := &countingEmbedder{err: errEmbedding}
+	cached := NewCachedEmbedder(inner, 2)
+
+	if _, err := cached.EmbedQuery(context.Background(), "a"); !errors.Is(err, errEmbedding) {
+		t.Errorf("EmbedQuery() error = %v, want %v", err, errEmbedding)
+	}
+
+	// the failed text is not cached
+	inner.err = nil
+	if _, err := cached.EmbedQuery(context.Background(), "a"); err != nil {
+		t.Fatalf("EmbedQuery() error = %v", err)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(inner.embedded, want) {
+		t.Errorf("embedded %q, want %q", inner.embedded, want)
+	}
+}
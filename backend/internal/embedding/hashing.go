@@ -0,0 +1,67 @@
+package embedding
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const defaultHashingDimensions = 256
+
+// HashingEmbedder maps the words of a text to the dimensions of a vector with a hash function.
+// The vectors are deterministic and need no model, it is meant for tests and local development.
+type HashingEmbedder struct {
+	dimensions int
+}
+
+func NewHashingEmbedder(dimensions int) *HashingEmbedder {
+	if dimensions <= 0 {
+		dimensions = defaultHashingDimensions
+	}
+	return &HashingEmbedder{dimensions: dimensions}
+}
+
+func (e *HashingEmbedder) EmbedDocuments(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vectors = append(vectors, e.embed(text))
+	}
+	return vectors, nil
+}
+
+func (e *HashingEmbedder) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	return e.embed(text), nil
+}
+
+func (e *HashingEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dimensions)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		hash := fnv.New64a()
+		hash.Write([]byte(word))
+		sum := hash.Sum64()
+		// the sign bit spreads the collisions around zero
+		if sum&(1<<63) != 0 {
+			vector[sum%uint64(e.dimensions)] -= 1
+		} else {
+			vector[sum%uint64(e.dimensions)] += 1
+		}
+	}
+
+	var norm float64
+	for _, value := range vector {
+		norm += float64(value) * float64(value)
+	}
+	if norm == 0 {
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
@@ -0,0 +1,86 @@
+package embedding
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func TestHashingEmbedder(t *testing.T) {
+	ctx := context.Background()
+	embedder := NewHashingEmbedder(64)
+
+	tests := []struct {
+		name       string
+		a          string
+		b          string
+		wantEqual  bool
+		wantCosine func(float64) bool
+	}{
+		{
+			name:      "case and punctuation are ignored",
+			a:         "Restart the server!",
+			b:         "restart, the SERVER",
+			wantEqual: true,
+		},
+		{
+			name:      "the order of the words is ignored",
+			a:         "restart the server",
+			b:         "server the restart",
+			wantEqual: true,
+		},
+		{
+			name:       "texts sharing words are close",
+			a:          "restart the web server",
+			b:          "restart the database server",
+			wantCosine: func(c float64) bool { return c > 0.5 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := embedder.EmbedQuery(ctx, tt.a)
+			b, _ := embedder.EmbedQuery(ctx, tt.b)
+			if equal := reflect.DeepEqual(a, b); equal != tt.wantEqual {
+				t.Errorf("vectors equal = %v, want %v", equal, tt.wantEqual)
+			}
+			if tt.wantCosine != nil && !tt.wantCosine(cosine(a, b)) {
+				t.Errorf("cosine = %v", cosine(a, b))
+			}
+		})
+	}
+}
+
+func TestHashingEmbedderVectors(t *testing.T) {
+	ctx := context.Background()
+
+	if got := len(NewHashingEmbedder(0).embed("text")); got != defaultHashingDimensions {
+		t.Errorf("default dimensions = %d, want %d", got, defaultHashingDimensions)
+	}
+
+	embedder := NewHashingEmbedder(32)
+	vectors, err := embedder.EmbedDocuments(ctx, []string{"install the agent", "", "install the agent"})
+	if err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	if len(vectors) != 3 {
+		t.Fatalf("EmbedDocuments() returned %d vectors, want 3", len(vectors))
+	}
+	if norm := math.Sqrt(cosine(vectors[0], vectors[0])); math.Abs(norm-1) > 1e-6 {
+		t.Errorf("norm of a vector = %v, want 1", norm)
+	}
+	if norm := cosine(vectors[1], vectors[1]); norm != 0 {
+		t.Errorf("norm of the vector of an empty text = %v, want 0", norm)
+	}
+	if !reflect.DeepEqual(vectors[0], vectors[2]) {
+		t.Error("the same text has different vectors")
+	}
+}
@@ -0,0 +1,61 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+const defaultOpenAIModel = "text-embedding-3-small"
+
+// the openai api accepts at most 2048 inputs per request
+const openAIBatchSize = 512
+
+// OpenAIEmbedder calls the embeddings endpoint of openai, or of a local server with the same api when baseURL is set
+type OpenAIEmbedder struct {
+	client *openai.LLM
+}
+
+func NewOpenAIEmbedder(apiKey string, model string, baseURL string) (*OpenAIEmbedder, error) {
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+	options := []openai.Option{
+		openai.WithToken(apiKey),
+		openai.WithEmbeddingModel(model),
+	}
+	if baseURL != "" {
+		options = append(options, openai.WithBaseURL(baseURL))
+	}
+
+	client, err := openai.New(options...)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAIEmbedder{client: client}, nil
+}
+
+func (e *OpenAIEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += openAIBatchSize {
+		end := min(start+openAIBatchSize, len(texts))
+		batch, err := e.client.CreateEmbedding(ctx, texts[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("error creating embeddings: %w", err)
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (e *OpenAIEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	vectors, err := e.EmbedDocuments(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("no embedding returned for the query")
+	}
+	return vectors[0], nil
+}
@@ -0,0 +1,147 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type embeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// newEmbeddingsServer serves the embeddings endpoint of the openai api, the vector of an input is its index
+// in the whole list of texts, so that the tests can check the order of the vectors across the batches
+func newEmbeddingsServer(t *testing.T, status int) (*httptest.Server, *[]embeddingsRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []embeddingsRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.Error(w, `{"error":{"message":"unexpected request"}}`, http.StatusBadRequest)
+			return
+		}
+		var request embeddingsRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		offset := 0
+		for _, previous := range requests {
+			offset += len(previous.Input)
+		}
+		requests = append(requests, request)
+		mu.Unlock()
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"error":{"message":"rate limited"}}`)
+			return
+		}
+		data := make([]map[string]any, 0, len(request.Input))
+		for i := range request.Input {
+			data = append(data, map[string]any{"object": "embedding", "index": i, "embedding": []float32{float32(offset + i), 1}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data, "model": request.Model})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	tests := []struct {
+		name        string
+		model       string
+		texts       int
+		wantModel   string
+		wantBatches []int
+	}{
+		{
+			name:        "the default model is used without a model",
+			texts:       3,
+			wantModel:   defaultOpenAIModel,
+			wantBatches: []int{3},
+		},
+		{
+			name:        "the texts are sent in batches",
+			model:       "local-model",
+			texts:       openAIBatchSize + 10,
+			wantModel:   "local-model",
+			wantBatches: []int{openAIBatchSize, 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newEmbeddingsServer(t, http.StatusOK)
+			embedder, err := NewOpenAIEmbedder("test-key", tt.model, server.URL)
+			if err != nil {
+				t.Fatalf("NewOpenAIEmbedder() error = %v", err)
+			}
+
+			texts := make([]string, tt.texts)
+			for i := range texts {
+				texts[i] = fmt.Sprintf("text %d", i)
+			}
+			vectors, err := embedder.EmbedDocuments(context.Background(), texts)
+			if err != nil {
+				t.Fatalf("EmbedDocuments() error = %v", err)
+			}
+			if len(vectors) != len(texts) {
+				t.Fatalf("EmbedDocuments() returned %d vectors, want %d", len(vectors), len(texts))
+			}
+			for i, vector := range vectors {
+				if vector[0] != float32(i) {
+					t.Fatalf("vector %d is the one of text %v", i, vector[0])
+				}
+			}
+
+			if len(*requests) != len(tt.wantBatches) {
+				t.Fatalf("sent %d requests, want %d", len(*requests), len(tt.wantBatches))
+			}
+			for i, request := range *requests {
+				if len(request.Input) != tt.wantBatches[i] || request.Model != tt.wantModel {
+					t.Errorf("request %d has %d texts for %q, want %d for %q", i, len(request.Input), request.Model, tt.wantBatches[i], tt.wantModel)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAIEmbedderQuery(t *testing.T) {
+	server, requests := newEmbeddingsServer(t, http.StatusOK)
+	embedder, err := NewOpenAIEmbedder("test-key", "", server.URL)
+	if err != nil {
+		t.Fatalf("NewOpenAIEmbedder() error = %v", err)
+	}
+
+	vector, err := embedder.EmbedQuery(context.Background(), "how do I restart the server")
+	if err != nil {
+		t.Fatalf("EmbedQuery() error = %v", err)
+	}
+	if len(vector) != 2 || len(*requests) != 1 || (*requests)[0].Input[0] != "how do I restart the server" {
+		t.Errorf("EmbedQuery() = %v after requests %+v", vector, *requests)
+	}
+}
+
+func TestOpenAIEmbedderError(t *testing.T) {
+	server, _ := newEmbeddingsServer(t, http.StatusTooManyRequests)
+	embedder, err := NewOpenAIEmbedder("test-key", "", server.URL)
+	if err != nil {
+		t.Fatalf("NewOpenAIEmbedder() error = %v", err)
+	}
+
+	if _, err := embedder.EmbedDocuments(context.Background(), []string{"a"}); err == nil {
+		t.Error("EmbedDocuments() error = nil, want the error of the api")
+	}
+	if _, err := embedder.EmbedQuery(context.Background(), "a"); err == nil {
+		t.Error("EmbedQuery() error = nil, want the error of the api")
+	}
+}
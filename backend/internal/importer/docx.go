@@ -0,0 +1,176 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+// matches the style names word uses for headings: "heading 1", "Heading 2", ...
+var docxHeadingStyleRegex = regexp.MustCompile(`(?i)^heading\s*([1-6])$`)
+
+// ParseDOCX maps a word file onto store documents, using its heading styles as chapters and subsections.
+// Word does not store the page layout, so pages are counted from the page breaks word saved in the file
+// when it last rendered it, or from the manual page breaks otherwise.
+func ParseDOCX(r io.ReaderAt, size int64, filename string) ([]store.Document, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docx file: %w", err)
+	}
+
+	headingStyles, err := readDOCXHeadingStyles(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := archive.Open("word/document.xml")
+	if err != nil {
+		return nil, fmt.Errorf("invalid docx file: %w", err)
+	}
+	defer document.Close()
+
+	lines, err := readDOCXLines(document, headingStyles)
+	if err != nil {
+		return nil, err
+	}
+	return buildDocuments(lines, filename)
+}
+
+// readDOCXHeadingStyles maps the style ids of the file to a heading level.
+// Style ids are localized in some languages but the style names are not.
+func readDOCXHeadingStyles(archive *zip.Reader) (map[string]int, error) {
+	headingStyles := map[string]int{"Title": 1}
+	for i := 1; i <= 6; i++ {
+		headingStyles["Heading"+strconv.Itoa(i)] = i
+	}
+
+	stylesFile, err := archive.Open("word/styles.xml")
+	if err != nil {
+		// styles are optional, the default ids are used
+		return headingStyles, nil
+	}
+	defer stylesFile.Close()
+
+	var styles struct {
+		Styles []struct {
+			ID   string `xml:"styleId,attr"`
+			Name struct {
+				Val string `xml:"val,attr"`
+			} `xml:"name"`
+		} `xml:"style"`
+	}
+	if err := xml.NewDecoder(stylesFile).Decode(&styles); err != nil {
+		return nil, fmt.Errorf("invalid docx styles: %w", err)
+	}
+	for _, style := range styles.Styles {
+		if match := docxHeadingStyleRegex.FindStringSubmatch(style.Name.Val); match != nil {
+			level, _ := strconv.Atoi(match[1])
+			headingStyles[style.ID] = level
+		}
+		if strings.EqualFold(style.Name.Val, "title") {
+			headingStyles[style.ID] = 1
+		}
+	}
+	return headingStyles, nil
+}
+
+// readDOCXLines walks the paragraphs of word/document.xml, table rows are written as "| cell | cell |"
+func readDOCXLines(r io.Reader, headingStyles map[string]int) ([]line, error) {
+	decoder := xml.NewDecoder(r)
+
+	var lines []line
+	// page of every line counted from the manual page breaks and from the rendered page breaks
+	var breakPages, renderedPages []int
+	breakPage, renderedPage := 1, 1
+	var paragraph strings.Builder
+	var style string
+	var cells []string
+	inTable := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid docx document: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				paragraph.Reset()
+				style = ""
+			case "pStyle":
+				style = docxAttr(t, "val")
+			case "t":
+				var text string
+				if err := decoder.DecodeElement(&text, &t); err != nil {
+					return nil, fmt.Errorf("invalid docx document: %w", err)
+				}
+				paragraph.WriteString(text)
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br":
+				if docxAttr(t, "type") == "page" {
+					breakPage++
+				} else {
+					paragraph.WriteString("\n")
+				}
+			case "lastRenderedPageBreak":
+				renderedPage++
+			case "tbl":
+				inTable++
+			case "tr":
+				cells = nil
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				if inTable > 0 {
+					cells = append(cells, text)
+					continue
+				}
+				if level, ok := headingStyles[style]; ok && text != "" {
+					lines = append(lines, line{text: text, level: level, heading: text})
+				} else {
+					lines = append(lines, line{text: text})
+				}
+				breakPages = append(breakPages, breakPage)
+				renderedPages = append(renderedPages, renderedPage)
+			case "tr":
+				lines = append(lines, line{text: "| " + strings.Join(cells, " | ") + " |"})
+				breakPages = append(breakPages, breakPage)
+				renderedPages = append(renderedPages, renderedPage)
+			case "tbl":
+				inTable--
+			}
+		}
+	}
+
+	pages := breakPages
+	if renderedPage > 1 {
+		pages = renderedPages
+	}
+	for i := range lines {
+		lines[i].page = pages[i]
+	}
+	return lines, nil
+}
+
+func docxAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+var (
+	ErrEmptyDocument = errors.New("no content found in the document")
+)
+
+// line is a line of text extracted from a file, the level is 0 when the line is not a heading
+type line struct {
+	text    string
+	level   int
+	heading string
+	anchor  string // fragment of the heading in the rendered file, only for the formats that have one
+	page    int    // 0 when the format has no pages
+}
+
+// buildDocuments maps the lines of a file onto store documents.
+// The highest heading level found in the file starts a new chapter and every deeper heading starts
+// a new subsection, titled with the path of headings above it ("Install > Linux").
+func buildDocuments(lines []line, filename string) ([]store.Document, error) {
+	chapterLevel := 0
+	for _, l := range lines {
+		if l.level > 0 && (chapterLevel == 0 || l.level < chapterLevel) {
+			chapterLevel = l.level
+		}
+	}
+
+	b := newDocumentBuilder(titleFromFilename(filename), filepath.Base(filename))
+	// headings between the chapter level and the current line, used to build subsection titles
+	var headingPath [6]string
+	for _, l := range lines {
+		switch {
+		case l.level == 0:
+			b.addLine(l.text, l.page)
+		case l.level == chapterLevel:
+			b.startChapter(l.heading, l.anchor)
+			headingPath = [6]string{}
+		default:
+			headingPath[l.level-1] = l.heading
+			for i := l.level; i < len(headingPath); i++ {
+				headingPath[i] = ""
+			}
+			var titles []string
+			for _, title := range headingPath[chapterLevel:l.level] {
+				if title != "" {
+					titles = append(titles, title)
+				}
+			}
+			b.startSubsection(strings.Join(titles, " > "), l.anchor)
+		}
+	}
+
+	documents := b.documents()
+	if len(documents) == 0 {
+		return nil, ErrEmptyDocument
+	}
+	return documents, nil
+}
+
+// documentBuilder accumulates lines into chapters and subsections while a file is parsed
+type documentBuilder struct {
+	defaultChapter string
+	source         string
+	docs           []store.Document
+	current        *store.Document
+	chapterAnchor  string
+	subTitle       string
+	subAnchor      string
+	lines          []string
+	pages          map[int]bool
+}
+
+func newDocumentBuilder(defaultChapter, source string) *documentBuilder {
+	return &documentBuilder{
+		defaultChapter: defaultChapter,
+		source:         source,
+		pages:          make(map[int]bool),
+	}
+}
+
+func (b *documentBuilder) startChapter(title string, anchor string) {
+	b.flushChapter()
+	b.current = &store.Document{Chapter: title, Source: b.source}
+	b.chapterAnchor = anchor
+}
+
+func (b *documentBuilder) startSubsection(title string, anchor string) {
+	b.flushSubsection()
+	b.subTitle = title
+	b.subAnchor = anchor
+}
+
+func (b *documentBuilder) addLine(text string, page int) {
+	b.lines = append(b.lines, text)
+	if page > 0 && strings.TrimSpace(text) != "" {
+		b.pages[page] = true
+	}
+}
+
+func (b *documentBuilder) flushSubsection() {
+	content := strings.TrimSpace(strings.Join(b.lines, "\n"))
+	title := b.subTitle
+	anchor := b.subAnchor
+	var pages []int
+	for page := range b.pages {
+		pages = append(pages, page)
+	}
+	sort.Ints(pages)
+
+	b.lines = nil
+	b.subTitle = ""
+	b.subAnchor = ""
+	b.pages = make(map[int]bool)
+	if content == "" {
+		return
+	}
+
+	// text found before the first chapter heading belongs to a chapter named after the file
+	if b.current == nil {
+		b.current = &store.Document{Chapter: b.defaultChapter, Source: b.source}
+	}
+	// text right below a chapter heading is an introduction named after the chapter
+	if title == "" {
+		title = b.current.Chapter
+		anchor = b.chapterAnchor
+	}
+	b.current.Subsections = append(b.current.Subsections, store.Subsection{
+		Title:   title,
+		Content: content,
+		Pages:   pages,
+		Anchor:  anchor,
+	})
+}
+
+func (b *documentBuilder) flushChapter() {
+	b.flushSubsection()
+	if b.current != nil && len(b.current.Subsections) > 0 {
+		b.docs = append(b.docs, *b.current)
+	}
+	b.current = nil
+}
+
+func (b *documentBuilder) documents() []store.Document {
+	b.flushChapter()
+	return b.docs
+}
+
+// titleFromFilename turns "getting-started_guide.md" into "getting started guide"
+func titleFromFilename(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	name = strings.NewReplacer("-", " ", "_", " ").Replace(name)
+	return strings.TrimSpace(name)
+}
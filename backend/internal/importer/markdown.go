@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+var headingRegex = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+
+// characters dropped from the headings to build their anchors, like the markdown renderers of github and gitlab
+var anchorRemoveRegex = regexp.MustCompile(`[^\p{L}\p{N}\s_-]`)
+
+// ParseMarkdown maps a markdown file onto store documents, using its headings as chapters and subsections.
+// Code blocks, tables and links are kept untouched in the subsection content.
+func ParseMarkdown(r io.Reader, filename string) ([]store.Document, error) {
+	lines, err := readMarkdownLines(r)
+	if err != nil {
+		return nil, err
+	}
+	return buildDocuments(lines, filename)
+}
+
+// readMarkdownLines splits the file into lines, marking which ones are headings.
+// Lines inside fenced code blocks are never headings and front matter is dropped.
+func readMarkdownLines(r io.Reader) ([]line, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []line
+	var fence string
+	anchors := make(map[string]int) // the repeated headings get a -1, -2... suffix
+	inFrontMatter := false
+	first := true
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+
+		if first {
+			first = false
+			if strings.TrimSpace(text) == "---" {
+				inFrontMatter = true
+				continue
+			}
+		}
+		if inFrontMatter {
+			if strings.TrimSpace(text) == "---" {
+				inFrontMatter = false
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(text)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			lines = append(lines, line{text: text})
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			lines = append(lines, line{text: text})
+			continue
+		}
+
+		// headings indented by four spaces or more are code blocks
+		if match := headingRegex.FindStringSubmatch(text); match != nil && match[2] != "" {
+			lines = append(lines, line{text: text, level: len(match[1]), heading: match[2], anchor: headingAnchor(match[2], anchors)})
+			continue
+		}
+		lines = append(lines, line{text: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// headingAnchor returns the anchor of a heading: "Install on Linux!" is "install-on-linux"
+func headingAnchor(heading string, seen map[string]int) string {
+	anchor := strings.ToLower(strings.TrimSpace(heading))
+	anchor = anchorRemoveRegex.ReplaceAllString(anchor, "")
+	anchor = strings.Join(strings.Fields(anchor), "-")
+	count := seen[anchor]
+	seen[anchor] = count + 1
+	if count > 0 {
+		return fmt.Sprintf("%s-%d", anchor, count)
+	}
+	return anchor
+}
@@ -0,0 +1,100 @@
+package importer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		markdown string
+		want     []store.Document
+	}{
+		{
+			name:     "headings are chapters and subsections",
+			filename: "guide.md",
+			markdown: "# Install\nIntro text.\n## On Linux\nRun the script.\n### Debian\nUse apt.\n# Upgrade\nStop first.\n",
+			want: []store.Document{
+				{Chapter: "Install", Source: "guide.md", Subsections: []store.Subsection{
+					{Title: "Install", Content: "Intro text.", Anchor: "install"},
+					{Title: "On Linux", Content: "Run the script.", Anchor: "on-linux"},
+					{Title: "On Linux > Debian", Content: "Use apt.", Anchor: "debian"},
+				}},
+				{Chapter: "Upgrade", Source: "guide.md", Subsections: []store.Subsection{
+					{Title: "Upgrade", Content: "Stop first.", Anchor: "upgrade"},
+				}},
+			},
+		},
+		{
+			name:     "text before the first heading is named after the file",
+			filename: "docs/getting-started_guide.md",
+			markdown: "Welcome.\n# Setup\nDo it.\n",
+			want: []store.Document{
+				{Chapter: "getting started guide", Source: "getting-started_guide.md", Subsections: []store.Subsection{
+					{Title: "getting started guide", Content: "Welcome."},
+				}},
+				{Chapter: "Setup", Source: "getting-started_guide.md", Subsections: []store.Subsection{
+					{Title: "Setup", Content: "Do it.", Anchor: "setup"},
+				}},
+			},
+		},
+		{
+			name:     "closing hashes are removed but a trailing # of a word is kept",
+			filename: "lang.md",
+			markdown: "## Using C#\nIt compiles.\n## Closed ##\nText.\n",
+			want: []store.Document{
+				{Chapter: "Using C#", Source: "lang.md", Subsections: []store.Subsection{
+					{Title: "Using C#", Content: "It compiles.", Anchor: "using-c"},
+				}},
+				{Chapter: "Closed", Source: "lang.md", Subsections: []store.Subsection{
+					{Title: "Closed", Content: "Text.", Anchor: "closed"},
+				}},
+			},
+		},
+		{
+			name:     "headings in code blocks and front matter are ignored",
+			filename: "code.md",
+			markdown: "---\ntitle: # not a heading\n---\n# Script\n```sh\n# a comment\necho hi\n```\n",
+			want: []store.Document{
+				{Chapter: "Script", Source: "code.md", Subsections: []store.Subsection{
+					{Title: "Script", Content: "```sh\n# a comment\necho hi\n```", Anchor: "script"},
+				}},
+			},
+		},
+		{
+			name:     "repeated headings get numbered anchors",
+			filename: "faq.md",
+			markdown: "# FAQ\n## Example\nOne.\n## Example\nTwo.\n",
+			want: []store.Document{
+				{Chapter: "FAQ", Source: "faq.md", Subsections: []store.Subsection{
+					{Title: "Example", Content: "One.", Anchor: "example"},
+					{Title: "Example", Content: "Two.", Anchor: "example-1"},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMarkdown(strings.NewReader(tt.markdown), tt.filename)
+			if err != nil {
+				t.Fatalf("ParseMarkdown() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMarkdown() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMarkdownEmpty(t *testing.T) {
+	_, err := ParseMarkdown(strings.NewReader("# Title only\n\n"), "empty.md")
+	if !errors.Is(err, ErrEmptyDocument) {
+		t.Errorf("ParseMarkdown() error = %v, want %v", err, ErrEmptyDocument)
+	}
+}
@@ -0,0 +1,157 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/store"
+)
+
+// a line is a heading when its font is this much bigger than the body text
+const pdfHeadingRatio = 1.15
+
+type pdfLine struct {
+	text     string
+	fontSize float64
+	page     int
+}
+
+// ParsePDF maps a pdf file onto store documents.
+// Pdf files have no heading markup, so lines written with a font bigger than the body text are headings:
+// the biggest font starts a chapter and the other heading fonts start subsections.
+// Every subsection keeps the pages its text was found on.
+func ParsePDF(r io.ReaderAt, size int64, filename string) ([]store.Document, error) {
+	reader, err := pdf.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var pdfLines []pdfLine
+	for pageNumber := 1; pageNumber <= reader.NumPage(); pageNumber++ {
+		page := reader.Page(pageNumber)
+		if page.V.IsNull() {
+			continue
+		}
+		pageLines, err := readPDFPage(page, pageNumber)
+		if err != nil {
+			return nil, fmt.Errorf("error reading page %d: %w", pageNumber, err)
+		}
+		pdfLines = append(pdfLines, pageLines...)
+	}
+
+	bodySize := pdfBodyFontSize(pdfLines)
+
+	// the distinct heading font sizes, biggest first, give the heading levels
+	var headingSizes []float64
+	for _, l := range pdfLines {
+		if l.fontSize >= bodySize*pdfHeadingRatio && !containsSize(headingSizes, l.fontSize) {
+			headingSizes = append(headingSizes, l.fontSize)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(headingSizes)))
+
+	lines := make([]line, 0, len(pdfLines))
+	for _, l := range pdfLines {
+		level := 0
+		for i, size := range headingSizes {
+			if math.Abs(l.fontSize-size) < 0.5 {
+				level = i + 1
+				break
+			}
+		}
+		if level > 6 {
+			level = 6
+		}
+		if level > 0 {
+			lines = append(lines, line{text: l.text, level: level, heading: l.text, page: l.page})
+			continue
+		}
+		lines = append(lines, line{text: l.text, page: l.page})
+	}
+
+	return buildDocuments(lines, filename)
+}
+
+// readPDFPage rebuilds the lines of a page from its positioned text, top to bottom
+func readPDFPage(page pdf.Page, pageNumber int) (lines []pdfLine, err error) {
+	// the pdf library panics on malformed content streams
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed pdf content: %v", r)
+		}
+	}()
+
+	type row struct {
+		y     float64
+		texts []pdf.Text
+	}
+	var rows []*row
+	for _, text := range page.Content().Text {
+		var current *row
+		for _, r := range rows {
+			if math.Abs(r.y-text.Y) < 2 {
+				current = r
+				break
+			}
+		}
+		if current == nil {
+			current = &row{y: text.Y}
+			rows = append(rows, current)
+		}
+		current.texts = append(current.texts, text)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].y > rows[j].y })
+
+	for _, r := range rows {
+		sort.SliceStable(r.texts, func(i, j int) bool { return r.texts[i].X < r.texts[j].X })
+
+		var builder strings.Builder
+		var fontSize float64
+		for i, text := range r.texts {
+			if i > 0 {
+				previous := r.texts[i-1]
+				// a gap between two pieces of text is a space that was not drawn
+				if text.X-(previous.X+previous.W) > text.FontSize*0.2 && !strings.HasSuffix(previous.S, " ") {
+					builder.WriteString(" ")
+				}
+			}
+			builder.WriteString(text.S)
+			fontSize = math.Max(fontSize, text.FontSize)
+		}
+
+		text := strings.TrimSpace(builder.String())
+		if text == "" {
+			continue
+		}
+		lines = append(lines, pdfLine{text: text, fontSize: fontSize, page: pageNumber})
+	}
+	return lines, nil
+}
+
+// pdfBodyFontSize is the font size used by most of the characters of the file
+func pdfBodyFontSize(lines []pdfLine) float64 {
+	counts := make(map[float64]int)
+	for _, l := range lines {
+		counts[math.Round(l.fontSize)] += len(l.text)
+	}
+	bodySize, max := 0.0, 0
+	for size, count := range counts {
+		if count > max || (count == max && size < bodySize) {
+			bodySize, max = size, count
+		}
+	}
+	return bodySize
+}
+
+func containsSize(sizes []float64, size float64) bool {
+	for _, s := range sizes {
+		if math.Abs(s-size) < 0.5 {
+			return true
+		}
+	}
+	return false
+}
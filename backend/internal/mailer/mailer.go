@@ -6,6 +6,8 @@ const (
 	FromName            = "RagSystem Team"
 	maxRetries          = 3
 	UserWelcomeTemplate = "user_invitation.tmpl"
+	// KnowledgeGapTemplate is the weekly report of the questions the documentation does not answer
+	KnowledgeGapTemplate = "knowledge_gaps.tmpl"
 )
 
 //go:embed "templates"
@@ -29,7 +29,7 @@ func NewMailTrapClient(apiKey, fromEmail string) (MailtrapClient, error) {
 
 func (m MailtrapClient) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
 
-	tmpl, err := template.ParseFS(FS, "template/"+templateFile)
+	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
 	if err != nil {
 		return -1, err
 	}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/filters"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+)
+
+// Access lists who can read a document, a document without any entry can be read by every user of its organization.
+// A user can read a restricted document when one of its roles, groups or its id is in the lists.
+type Access struct {
+	Roles  []string `json:"roles,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	Users  []string `json:"users,omitempty"`
+}
+
+// Principal is the authenticated user a read is done for, taken from the claims of its token
+type Principal struct {
+	UserID string   `json:"user_id"`
+	Roles  []string `json:"roles,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+const (
+	principalUser  = "user:"
+	principalRole  = "role:"
+	principalGroup = "group:"
+)
+
+func (a *Access) IsRestricted() bool {
+	return a != nil && (len(a.Roles) > 0 || len(a.Groups) > 0 || len(a.Users) > 0)
+}
+
+// principals returns the entries of the access as they are stored in the objects: user:42, role:admin, group:support
+func (a *Access) principals() []string {
+	if !a.IsRestricted() {
+		return []string{}
+	}
+	var principals []string
+	for _, user := range a.Users {
+		principals = append(principals, principalUser+user)
+	}
+	for _, role := range a.Roles {
+		principals = append(principals, principalRole+role)
+	}
+	for _, group := range a.Groups {
+		principals = append(principals, principalGroup+group)
+	}
+	return principals
+}
+
+func accessFromPrincipals(principals []string) *Access {
+	access := &Access{}
+	for _, principal := range principals {
+		switch {
+		case strings.HasPrefix(principal, principalUser):
+			access.Users = append(access.Users, strings.TrimPrefix(principal, principalUser))
+		case strings.HasPrefix(principal, principalRole):
+			access.Roles = append(access.Roles, strings.TrimPrefix(principal, principalRole))
+		case strings.HasPrefix(principal, principalGroup):
+			access.Groups = append(access.Groups, strings.TrimPrefix(principal, principalGroup))
+		}
+	}
+	if !access.IsRestricted() {
+		return nil
+	}
+	return access
+}
+
+// Allows tells if the principal can read a document with this access, a nil principal is the app itself
+func (a *Access) Allows(principal *Principal) bool {
+	if principal == nil || !a.IsRestricted() {
+		return true
+	}
+	return slices.ContainsFunc(principal.principals(), func(p string) bool {
+		return slices.Contains(a.principals(), p)
+	})
+}
+
+func (p *Principal) principals() []string {
+	var principals []string
+	if p.UserID != "" {
+		principals = append(principals, principalUser+p.UserID)
+	}
+	for _, role := range p.Roles {
+		principals = append(principals, principalRole+role)
+	}
+	for _, group := range p.Groups {
+		principals = append(principals, principalGroup+group)
+	}
+	return principals
+}
+
+// setAccessProperties adds the access to the properties of a weaviate object. aclRestricted is always set,
+// the objects indexed before the access lists have none and are filtered as not restricted.
+func setAccessProperties(properties map[string]interface{}, access *Access) {
+	properties["aclRestricted"] = access.IsRestricted()
+	properties["aclPrincipals"] = access.principals()
+}
+
+// accessFromProperties reads the access of a weaviate object
+func accessFromProperties(properties map[string]interface{}) *Access {
+	raw, _ := properties["aclPrincipals"].([]interface{})
+	principals := make([]string, 0, len(raw))
+	for _, principal := range raw {
+		if value, ok := principal.(string); ok {
+			principals = append(principals, value)
+		}
+	}
+	return accessFromPrincipals(principals)
+}
+
+func accessGraphQLFields() []graphql.Field {
+	return []graphql.Field{{Name: "aclPrincipals"}}
+}
+
+// accessWhere returns the weaviate filter of the objects the principal can read, nil when it can read everything
+func accessWhere(principal *Principal) *filters.WhereBuilder {
+	if principal == nil {
+		return nil
+	}
+	// NotEqual also matches the objects without the property
+	return filters.Where().
+		WithOperator(filters.Or).
+		WithOperands([]*filters.WhereBuilder{
+			filters.Where().
+				WithPath([]string{"aclRestricted"}).
+				WithOperator(filters.NotEqual).
+				WithValueBoolean(true),
+			filters.Where().
+				WithPath([]string{"aclPrincipals"}).
+				WithOperator(filters.ContainsAny).
+				WithValueText(principal.principals()...),
+		})
+}
+
+// accessSQLWhere returns the condition on the acl columns of the rows the principal can read
+func accessSQLWhere(principal *Principal, args []any) (string, []any) {
+	if principal == nil {
+		return "", args
+	}
+	args = append(args, pq.Array(principal.principals()))
+	return fmt.Sprintf("(NOT acl_restricted OR acl_principals && $%d)", len(args)), args
+}
+
+// andWhere joins the filters that are not nil
+func andWhere(wheres ...*filters.WhereBuilder) *filters.WhereBuilder {
+	var operands []*filters.WhereBuilder
+	for _, where := range wheres {
+		if where != nil {
+			operands = append(operands, where)
+		}
+	}
+	switch len(operands) {
+	case 0:
+		return nil
+	case 1:
+		return operands[0]
+	default:
+		return filters.Where().WithOperator(filters.And).WithOperands(operands)
+	}
+}
@@ -0,0 +1,315 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultAnalyticsLimit = 20
+	MaxAnalyticsLimit     = 200
+)
+
+type AnalyticsStore struct {
+	client *sql.DB
+}
+
+// QueryEvent is a question asked to a knowledge base and what was retrieved to answer it
+type QueryEvent struct {
+	KnowledgeBase      string            `json:"knowledge_base"`
+	Tenant             string            `json:"-"`
+	UserID             string            `json:"user_id"`
+	ConversationID     string            `json:"conversation_id"`
+	Question           string            `json:"question"`
+	StandaloneQuestion string            `json:"standalone_question"` // question rewritten with the chat history, the one searched
+	Retrieved          []RetrievedObject `json:"retrieved"`
+	InsufficientInfo   bool              `json:"insufficient_info"` // the bot answered that the documentation was not enough
+	FAQID              string            `json:"faq_id,omitempty"`  // the approved answer returned instead of a generated one
+	LatencyMs          int64             `json:"latency_ms"`
+	CreatedAt          time.Time         `json:"created_at"`
+}
+
+type RetrievedObject struct {
+	ID       string  `json:"id"`
+	Chapter  string  `json:"chapter"`
+	Rank     int     `json:"rank"`
+	Score    float64 `json:"score"`
+	Distance float64 `json:"distance"`
+}
+
+// AnalyticsRange selects the events of a knowledge base between two times
+type AnalyticsRange struct {
+	KnowledgeBase string
+	Tenant        string
+	From          time.Time
+	To            time.Time
+	Limit         int
+}
+
+func (r AnalyticsRange) limit() int {
+	switch {
+	case r.Limit <= 0:
+		return DefaultAnalyticsLimit
+	case r.Limit > MaxAnalyticsLimit:
+		return MaxAnalyticsLimit
+	default:
+		return r.Limit
+	}
+}
+
+type QuestionCount struct {
+	Question         string `json:"question"`
+	Count            int    `json:"count"`
+	InsufficientInfo int    `json:"insufficient_info"` // times the bot could not answer it
+	LastAskedAt      string `json:"last_asked_at"`
+}
+
+type ChapterCount struct {
+	ID          string  `json:"id"`
+	Chapter     string  `json:"chapter"`
+	Count       int     `json:"count"`
+	AvgDistance float64 `json:"avg_distance"`
+}
+
+// CreateBatch stores several events in one statement, they are written by the buffered writer of the api
+func (s *AnalyticsStore) CreateBatch(ctx context.Context, events []*QueryEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	const columns = 11
+	values := make([]string, 0, len(events))
+	args := make([]any, 0, len(events)*columns)
+	for i, event := range events {
+		retrieved := event.Retrieved
+		if retrieved == nil {
+			retrieved = []RetrievedObject{}
+		}
+		retrievedJSON, err := json.Marshal(retrieved)
+		if err != nil {
+			return err
+		}
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = time.Now()
+		}
+
+		placeholders := make([]string, columns)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", i*columns+j+1)
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+		args = append(args,
+			event.KnowledgeBase,
+			event.Tenant,
+			event.UserID,
+			event.ConversationID,
+			event.Question,
+			event.StandaloneQuestion,
+			retrievedJSON,
+			event.InsufficientInfo,
+			event.LatencyMs,
+			event.CreatedAt,
+			sql.NullString{String: event.FAQID, Valid: event.FAQID != ""},
+		)
+	}
+	query := `
+	INSERT INTO query_events (knowledge_base, tenant, user_id, conversation_id, question, standalone_question,
+		retrieved, insufficient_info, latency_ms, created_at, faq_id)
+	VALUES ` + strings.Join(values, ", ")
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.client.ExecContext(ctx, query, args...)
+	return err
+}
+
+// TopQuestions returns the questions asked the most, the case and the spaces around them are ignored
+func (s *AnalyticsStore) TopQuestions(ctx context.Context, r AnalyticsRange) ([]QuestionCount, error) {
+	query := `
+	SELECT MIN(question), COUNT(*), COUNT(*) FILTER (WHERE insufficient_info), MAX(created_at)
+	FROM query_events
+	WHERE knowledge_base = $1 AND tenant = $2 AND created_at >= $3 AND created_at < $4
+	GROUP BY LOWER(TRIM(question))
+	ORDER BY COUNT(*) DESC, MAX(created_at) DESC
+	LIMIT $5
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.client.QueryContext(ctx, query, r.KnowledgeBase, r.Tenant, r.From, r.To, r.limit())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	questions := []QuestionCount{}
+	for rows.Next() {
+		var question QuestionCount
+		if err := rows.Scan(&question.Question, &question.Count, &question.InsufficientInfo, &question.LastAskedAt); err != nil {
+			return nil, err
+		}
+		questions = append(questions, question)
+	}
+	return questions, rows.Err()
+}
+
+// TopChapters returns the chapters retrieved the most to answer the questions, except the hidden ones
+// that the reader of the report can not read
+func (s *AnalyticsStore) TopChapters(ctx context.Context, r AnalyticsRange, hidden []string) ([]ChapterCount, error) {
+	query := `
+	SELECT object->>'id', MAX(object->>'chapter'), COUNT(*), AVG((object->>'distance')::float8)
+	FROM query_events, jsonb_array_elements(retrieved) AS object
+	WHERE knowledge_base = $1 AND tenant = $2 AND created_at >= $3 AND created_at < $4
+		AND NOT object->>'id' = ANY($6)
+	GROUP BY object->>'id'
+	ORDER BY COUNT(*) DESC, object->>'id'
+	LIMIT $5
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if hidden == nil {
+		hidden = []string{}
+	}
+	rows, err := s.client.QueryContext(ctx, query, r.KnowledgeBase, r.Tenant, r.From, r.To, r.limit(), pq.Array(hidden))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chapters := []ChapterCount{}
+	for rows.Next() {
+		var chapter ChapterCount
+		if err := rows.Scan(&chapter.ID, &chapter.Chapter, &chapter.Count, &chapter.AvgDistance); err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters, rows.Err()
+}
+
+// RetrievedChapterIDs returns the ids of every chapter retrieved at least once in the range, the limit is not used
+func (s *AnalyticsStore) RetrievedChapterIDs(ctx context.Context, r AnalyticsRange) (map[string]bool, error) {
+	query := `
+	SELECT DISTINCT object->>'id'
+	FROM query_events, jsonb_array_elements(retrieved) AS object
+	WHERE knowledge_base = $1 AND tenant = $2 AND created_at >= $3 AND created_at < $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.client.QueryContext(ctx, query, r.KnowledgeBase, r.Tenant, r.From, r.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// UnansweredQuestions returns the questions of the range that found no chapter or that the bot could not answer,
+// the newest first and at most maxUnansweredQuestions of them
+func (s *AnalyticsStore) UnansweredQuestions(ctx context.Context, r AnalyticsRange) ([]UnansweredQuestion, error) {
+	query := `
+	SELECT question, standalone_question, user_id, jsonb_array_length(retrieved) = 0, created_at
+	FROM query_events
+	WHERE knowledge_base = $1 AND tenant = $2 AND created_at >= $3 AND created_at < $4 AND insufficient_info
+	ORDER BY created_at DESC
+	LIMIT $5
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.client.QueryContext(ctx, query, r.KnowledgeBase, r.Tenant, r.From, r.To, maxUnansweredQuestions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []UnansweredQuestion
+	for rows.Next() {
+		var question UnansweredQuestion
+		if err := rows.Scan(
+			&question.Question,
+			&question.StandaloneQuestion,
+			&question.UserID,
+			&question.NoResults,
+			&question.AskedAt,
+		); err != nil {
+			return nil, err
+		}
+		questions = append(questions, question)
+	}
+	return questions, rows.Err()
+}
+
+// ClaimReport marks the report as sent at now when it was last sent at least interval before, and returns that time.
+// The row of a report claimed by another instance is skipped, so only one of them sends it.
+func (s *AnalyticsStore) ClaimReport(ctx context.Context, name string, now time.Time, interval time.Duration) (time.Time, bool, error) {
+	query := `
+	WITH previous AS (
+		SELECT name, last_sent_at FROM report_schedules WHERE name = $1 FOR UPDATE SKIP LOCKED
+	)
+	UPDATE report_schedules r SET last_sent_at = $2
+	FROM previous
+	WHERE r.name = previous.name AND previous.last_sent_at <= $3
+	RETURNING previous.last_sent_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var lastSentAt time.Time
+	err := s.client.QueryRowContext(ctx, query, name, now, now.Add(-interval)).Scan(&lastSentAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return time.Time{}, false, nil
+		default:
+			return time.Time{}, false, err
+		}
+	}
+	return lastSentAt, true, nil
+}
+
+// UnansweredScopes returns the knowledge bases and tenants with unanswered questions in the range
+func (s *AnalyticsStore) UnansweredScopes(ctx context.Context, from time.Time, to time.Time) ([]AnalyticsRange, error) {
+	query := `
+	SELECT DISTINCT knowledge_base, tenant
+	FROM query_events
+	WHERE created_at >= $1 AND created_at < $2 AND insufficient_info
+	ORDER BY knowledge_base, tenant
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.client.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scopes []AnalyticsRange
+	for rows.Next() {
+		scope := AnalyticsRange{From: from, To: to}
+		if err := rows.Scan(&scope.KnowledgeBase, &scope.Tenant); err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, rows.Err()
+}
@@ -0,0 +1,412 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+)
+
+var (
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrOffsetPaging    = errors.New("the chapters of the weaviate backend are paged with offset, not cursor")
+	ErrCursorPaging    = errors.New("the chapters of this vector backend are paged with cursor, not offset")
+	ErrUnknownSortName = errors.New("unknown sort, use chapter, created_at or updated_at")
+)
+
+// sorts of the chapter lists
+const (
+	ChapterSortName    = "chapter"
+	ChapterSortCreated = "created_at"
+	ChapterSortUpdated = "updated_at"
+)
+
+const (
+	DefaultChapterPageSize = 20
+	MaxChapterPageSize     = 100
+	maxFacetValues         = 100
+)
+
+// ChapterListQuery is a page of the chapters of a collection. The memory and pgvector stores take the
+// NextCursor of the previous page as cursor, the weaviate store takes its NextOffset as offset.
+type ChapterListQuery struct {
+	Limit      int
+	Cursor     string
+	Offset     int
+	Sort       string
+	Descending bool
+	Filter     *MetadataFilter
+}
+
+// ChapterSummary is a chapter without the content of its subsections
+type ChapterSummary struct {
+	ID        string    `json:"id"`
+	Chapter   string    `json:"chapter"`
+	Titles    []string  `json:"titles"` // titles of the subsections
+	Source    string    `json:"source,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Metadata  *Metadata `json:"metadata,omitempty"`
+	CreatedAt string    `json:"created_at,omitempty"` // unix milliseconds like in the exports
+	UpdatedAt string    `json:"updated_at,omitempty"`
+}
+
+type ChapterPage struct {
+	Chapters   []*ChapterSummary `json:"chapters"`
+	NextCursor string            `json:"next_cursor,omitempty"` // empty on the last page
+	NextOffset int               `json:"next_offset,omitempty"` // weaviate only, zero on the last page
+}
+
+// TitleMatch is a chapter or a subsection whose title matches a keyword search
+type TitleMatch struct {
+	ID              string `json:"id"` // id of the chapter object
+	Chapter         string `json:"chapter"`
+	Title           string `json:"title"`
+	SubsectionIndex int    `json:"subsection_index"`
+	URL             string `json:"url,omitempty"` // deep link to the subsection
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// MetadataFacets counts the chapters of a collection for every value of its metadata fields
+type MetadataFacets struct {
+	Chapters int                     `json:"chapters"`
+	Fields   map[string][]FacetCount `json:"fields"`
+}
+
+// normalized checks the sort and sets the default limit
+func (q ChapterListQuery) normalized() (ChapterListQuery, error) {
+	switch q.Sort {
+	case "":
+		q.Sort = ChapterSortName
+	case ChapterSortName, ChapterSortCreated, ChapterSortUpdated:
+	default:
+		return q, ErrUnknownSortName
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultChapterPageSize
+	}
+	if q.Limit > MaxChapterPageSize {
+		q.Limit = MaxChapterPageSize
+	}
+	q.Offset = max(q.Offset, 0)
+	return q, nil
+}
+
+// keysetNormalized is normalized for the stores that resume after the cursor and take no offset
+func (q ChapterListQuery) keysetNormalized() (ChapterListQuery, error) {
+	if q.Offset != 0 {
+		return q, ErrCursorPaging
+	}
+	return q.normalized()
+}
+
+// chapterCursor is where a page of chapters ends, the sql and memory stores resume after the sort value and
+// the id of the last chapter
+type chapterCursor struct {
+	Value string `json:"v,omitempty"`
+	ID    string `json:"i,omitempty"`
+}
+
+func (c chapterCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeChapterCursor(cursor string) (*chapterCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	decoded := &chapterCursor{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return decoded, nil
+}
+
+// sortFacetCounts puts the most used values first
+func sortFacetCounts(counts map[string]int) []FacetCount {
+	facets := make([]FacetCount, 0, len(counts))
+	for value, count := range counts {
+		facets = append(facets, FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+	if len(facets) > maxFacetValues {
+		facets = facets[:maxFacetValues]
+	}
+	return facets
+}
+
+// ListChapters returns a page of the chapters the reader can access, from the offset of the query.
+// There is no keyset cursor: weaviate sorts the text case-insensitively but compares it byte by byte in the
+// filters, and the timestamps can only be filtered with IndexTimestamps, which the classes don't set. So a
+// chapter added or deleted before the offset between two pages shifts the next page by one, and the offset
+// plus the limit can't go past the QUERY_MAXIMUM_RESULTS of the weaviate server.
+func (d *VectorsStore) ListChapters(ctx context.Context, collection Collection, query ChapterListQuery) (*ChapterPage, error) {
+	if query.Cursor != "" {
+		return nil, ErrOffsetPaging
+	}
+	query, err := query.normalized()
+	if err != nil {
+		return nil, err
+	}
+	offset := query.Offset
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	path := map[string]string{
+		ChapterSortName:    "chapter",
+		ChapterSortCreated: "_creationTimeUnix",
+		ChapterSortUpdated: "_lastUpdateTimeUnix",
+	}[query.Sort]
+	order := graphql.Asc
+	if query.Descending {
+		order = graphql.Desc
+	}
+
+	fields := append([]graphql.Field{
+		{Name: "chapter"},
+		{Name: "subsections", Fields: []graphql.Field{{Name: "title"}}},
+		{Name: "source"},
+		{Name: "url"},
+		{Name: "_additional", Fields: []graphql.Field{
+			{Name: "id"},
+			{Name: "creationTimeUnix"},
+			{Name: "lastUpdateTimeUnix"},
+		}},
+	}, metadataGraphQLFields()...)
+	// one more chapter than the page tells if there is a next page
+	get := d.client.GraphQL().Get().
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
+		WithFields(fields...).
+		WithSort(graphql.Sort{Path: []string{path}, Order: order}).
+		WithOffset(offset).
+		WithLimit(query.Limit + 1)
+	if where := andWhere(query.Filter.where(), accessWhere(collection.Reader)); where != nil {
+		get = get.WithWhere(where)
+	}
+	response, err := get.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing chapters: %w", err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL response error: %s", response.Errors[0].Message)
+	}
+
+	getData, ok := response.Data["Get"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid response structure: missing 'Get' key")
+	}
+	rawChapters, _ := getData[collection.Class].([]any)
+
+	page := &ChapterPage{Chapters: []*ChapterSummary{}}
+	for i, item := range rawChapters {
+		if i == query.Limit {
+			page.NextOffset = offset + query.Limit
+			break
+		}
+		itemJSON, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var raw struct {
+			Chapter     string       `json:"chapter"`
+			Subsections []Subsection `json:"subsections"`
+			Source      string       `json:"source"`
+			URL         string       `json:"url"`
+			Additional  struct {
+				ID                 string `json:"id"`
+				CreationTimeUnix   string `json:"creationTimeUnix"`
+				LastUpdateTimeUnix string `json:"lastUpdateTimeUnix"`
+			} `json:"_additional"`
+		}
+		if err := json.Unmarshal(itemJSON, &raw); err != nil {
+			return nil, err
+		}
+		metadata, err := metadataFromJSON(itemJSON)
+		if err != nil {
+			return nil, err
+		}
+		summary := &ChapterSummary{
+			ID:        raw.Additional.ID,
+			Chapter:   raw.Chapter,
+			Titles:    make([]string, 0, len(raw.Subsections)),
+			Source:    raw.Source,
+			URL:       raw.URL,
+			Metadata:  metadata,
+			CreatedAt: raw.Additional.CreationTimeUnix,
+			UpdatedAt: raw.Additional.LastUpdateTimeUnix,
+		}
+		for _, subsection := range raw.Subsections {
+			summary.Titles = append(summary.Titles, subsection.Title)
+		}
+		page.Chapters = append(page.Chapters, summary)
+	}
+	return page, nil
+}
+
+// SearchTitles returns the chapters and subsections whose titles match the keywords, best matches first
+func (d *VectorsStore) SearchTitles(ctx context.Context, collection Collection, keywords string, limit int) ([]*TitleMatch, error) {
+	if limit <= 0 || limit > MaxChapterPageSize {
+		limit = DefaultChapterPageSize
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	// the chunks of a subsection all match the same titles, a few more are fetched to fill the limit
+	get := d.client.GraphQL().Get().
+		WithClassName(collection.ChunkClass()).
+		WithTenant(collection.Tenant).
+		WithFields(
+			graphql.Field{Name: "chapterId"},
+			graphql.Field{Name: "chapter"},
+			graphql.Field{Name: "title"},
+			graphql.Field{Name: "subsectionIndex"},
+			graphql.Field{Name: "url"},
+			graphql.Field{Name: "anchor"},
+		).
+		WithBM25(d.client.GraphQL().Bm25ArgBuilder().
+			WithQuery(keywords).
+			WithProperties("title", "chapter")).
+		WithLimit(limit * 4)
+	if where := accessWhere(collection.Reader); where != nil {
+		get = get.WithWhere(where)
+	}
+	response, err := get.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error searching titles: %w", err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL response error: %s", response.Errors[0].Message)
+	}
+
+	getData, ok := response.Data["Get"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid response structure: missing 'Get' key")
+	}
+	rawChunks, _ := getData[collection.ChunkClass()].([]any)
+
+	matches := []*TitleMatch{}
+	seen := make(map[string]bool)
+	for _, item := range rawChunks {
+		itemMap, _ := item.(map[string]any)
+		chapterID, _ := itemMap["chapterId"].(string)
+		subsectionIndex := toInt(itemMap["subsectionIndex"])
+		key := fmt.Sprintf("%s/%d", chapterID, subsectionIndex)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		chapter, _ := itemMap["chapter"].(string)
+		title, _ := itemMap["title"].(string)
+		url, _ := itemMap["url"].(string)
+		anchor, _ := itemMap["anchor"].(string)
+		matches = append(matches, &TitleMatch{
+			ID:              chapterID,
+			Chapter:         chapter,
+			Title:           title,
+			SubsectionIndex: subsectionIndex,
+			URL:             deepLink(url, anchor),
+		})
+		if len(matches) == limit {
+			break
+		}
+	}
+	return matches, nil
+}
+
+// CountFacets counts the chapters the reader can access for every value of the metadata fields
+func (d *VectorsStore) CountFacets(ctx context.Context, collection Collection) (*MetadataFacets, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	fields := []graphql.Field{{Name: "meta", Fields: []graphql.Field{{Name: "count"}}}}
+	for _, field := range metadataFields {
+		fields = append(fields, graphql.Field{
+			Name: field,
+			Fields: []graphql.Field{{
+				Name:   fmt.Sprintf("topOccurrences(limit: %d)", maxFacetValues),
+				Fields: []graphql.Field{{Name: "value"}, {Name: "occurs"}},
+			}},
+		})
+	}
+	aggregate := d.client.GraphQL().Aggregate().
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
+		WithFields(fields...)
+	if where := accessWhere(collection.Reader); where != nil {
+		aggregate = aggregate.WithWhere(where)
+	}
+	response, err := aggregate.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error counting facets: %w", err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL response error: %s", response.Errors[0].Message)
+	}
+
+	aggregateData, ok := response.Data["Aggregate"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid response structure: missing 'Aggregate' key")
+	}
+	results, _ := aggregateData[collection.Class].([]any)
+
+	facets := &MetadataFacets{Fields: make(map[string][]FacetCount, len(metadataFields))}
+	var result map[string]any
+	if len(results) > 0 {
+		result, _ = results[0].(map[string]any)
+	}
+	meta, _ := result["meta"].(map[string]any)
+	facets.Chapters = toInt(meta["count"])
+	for _, field := range metadataFields {
+		counts := make(map[string]int)
+		fieldData, _ := result[field].(map[string]any)
+		occurrences, _ := fieldData["topOccurrences"].([]any)
+		for _, occurrence := range occurrences {
+			occurrenceMap, _ := occurrence.(map[string]any)
+			if value, _ := occurrenceMap["value"].(string); value != "" {
+				counts[value] = toInt(occurrenceMap["occurs"])
+			}
+		}
+		facets.Fields[field] = sortFacetCounts(counts)
+	}
+	return facets, nil
+}
+
+// facetValues returns the values of the metadata of a chapter for every field
+func facetValues(metadata *Metadata) map[string][]string {
+	if metadata == nil {
+		return nil
+	}
+	values := map[string][]string{"tags": metadata.Tags}
+	for field, value := range map[string]string{
+		"product":  metadata.Product,
+		"version":  metadata.Version,
+		"language": metadata.Language,
+		"audience": metadata.Audience,
+	} {
+		if value != "" {
+			values[field] = []string{value}
+		}
+	}
+	return values
+}
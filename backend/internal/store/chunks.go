@@ -0,0 +1,259 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// ChunkingConfig controls how subsections are split into chunk objects.
+// Size and Overlap are expressed in tokens (whitespace separated words).
+type ChunkingConfig struct {
+	Size    int
+	Overlap int
+}
+
+// Chunk is a piece of a subsection stored as its own object in weaviate,
+// pointing back to the object of its chapter
+type Chunk struct {
+	ChapterID       string    `json:"chapterId"`
+	Chapter         string    `json:"chapter"`
+	Title           string    `json:"title"`
+	Content         string    `json:"content"`
+	SubsectionIndex int       `json:"subsectionIndex"`
+	ChunkIndex      int       `json:"chunkIndex"`
+	Source          string    `json:"source"`
+	Pages           []int     `json:"pages"`
+	Metadata        *Metadata `json:"metadata,omitempty"` // stored as properties of the chunk
+	Access          *Access   `json:"access,omitempty"`
+	URL             string    `json:"url,omitempty"` // url of the chapter
+	Anchor          string    `json:"anchor,omitempty"`
+	Breadcrumb      []string  `json:"breadcrumb,omitempty"`
+	// set on the retrieved chunks only, see setDistance
+	Distance     float64 `json:"-"`
+	Certainty    float64 `json:"-"`
+	Score        float64 `json:"-"`
+	ExplainScore string  `json:"-"`
+}
+
+// setDistance sets the scores of a chunk retrieved with a vector search from its cosine distance to the query,
+// the certainty is computed like weaviate does
+func (c *Chunk) setDistance(distance float64) {
+	c.Distance = distance
+	c.Certainty = 1 - distance/2
+	c.Score = 1 - distance
+}
+
+func (c ChunkingConfig) normalized() ChunkingConfig {
+	if c.Size <= 0 {
+		c.Size = 200
+	}
+	if c.Overlap < 0 || c.Overlap >= c.Size {
+		c.Overlap = 0
+	}
+	return c
+}
+
+// splitIntoChunks splits a text into windows of at most Size tokens,
+// each one repeating the last Overlap tokens of the previous window
+func (c ChunkingConfig) splitIntoChunks(text string) []string {
+	c = c.normalized()
+
+	tokens := strings.Fields(text)
+	if len(tokens) == 0 {
+		return nil
+	}
+	if len(tokens) <= c.Size {
+		return []string{strings.Join(tokens, " ")}
+	}
+
+	var chunks []string
+	step := c.Size - c.Overlap
+	for start := 0; start < len(tokens); start += step {
+		end := start + c.Size
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		chunks = append(chunks, strings.Join(tokens[start:end], " "))
+		if end == len(tokens) {
+			break
+		}
+	}
+	return chunks
+}
+
+// chunkDocument turns every subsection of a document into one or more chunks
+func (c ChunkingConfig) chunkDocument(chapterID string, doc Document) []Chunk {
+	var chunks []Chunk
+	for subIndex, subsection := range doc.Subsections {
+		for chunkIndex, content := range c.splitIntoChunks(subsection.Content) {
+			chunks = append(chunks, Chunk{
+				ChapterID:       chapterID,
+				Chapter:         doc.Chapter,
+				Title:           subsection.Title,
+				Content:         content,
+				SubsectionIndex: subIndex,
+				ChunkIndex:      chunkIndex,
+				Source:          doc.Source,
+				Pages:           subsection.Pages,
+				Metadata:        doc.Metadata,
+				Access:          doc.Access,
+				URL:             doc.URL,
+				Anchor:          subsection.Anchor,
+				Breadcrumb:      doc.Breadcrumb,
+			})
+		}
+	}
+	return chunks
+}
+
+func chunkToObject(chunk Chunk, collection Collection) *models.Object {
+	properties := map[string]interface{}{
+		"chapterId":       chunk.ChapterID,
+		"chapter":         chunk.Chapter,
+		"title":           chunk.Title,
+		"content":         chunk.Content,
+		"subsectionIndex": chunk.SubsectionIndex,
+		"chunkIndex":      chunk.ChunkIndex,
+		"source":          chunk.Source,
+		"pages":           chunk.Pages,
+		"ofChapter": []map[string]string{
+			{"beacon": fmt.Sprintf("weaviate://localhost/%s/%s", collection.Class, chunk.ChapterID)},
+		},
+	}
+	if chunk.URL != "" {
+		properties["url"] = chunk.URL
+	}
+	if chunk.Anchor != "" {
+		properties["anchor"] = chunk.Anchor
+	}
+	if len(chunk.Breadcrumb) > 0 {
+		properties["breadcrumb"] = chunk.Breadcrumb
+	}
+	setMetadataProperties(properties, chunk.Metadata)
+	setAccessProperties(properties, chunk.Access)
+
+	return &models.Object{
+		Class:      collection.ChunkClass(),
+		Tenant:     collection.Tenant,
+		Properties: properties,
+	}
+}
+
+// chunksToHits groups the retrieved chunks by chapter and rebuilds the subsections of each chapter.
+// The chapters are ranked in the order of their first chunk, the chunks are expected best first.
+func (c ChunkingConfig) chunksToHits(chunks []Chunk) []*RetrievalHit {
+	var order []string
+	chapterChunks := make(map[string][]Chunk)
+	for _, chunk := range chunks {
+		if _, ok := chapterChunks[chunk.ChapterID]; !ok {
+			order = append(order, chunk.ChapterID)
+		}
+		chapterChunks[chunk.ChapterID] = append(chapterChunks[chunk.ChapterID], chunk)
+	}
+
+	hits := make([]*RetrievalHit, 0, len(order))
+	for i, chapterID := range order {
+		grouped := chapterChunks[chapterID]
+		best := grouped[0]
+		for _, chunk := range grouped[1:] {
+			if chunk.Score > best.Score {
+				best = chunk
+			}
+		}
+		// the subsections of the document are the retrieved ones, in the order of their index
+		before := make(map[int]bool)
+		for _, chunk := range grouped {
+			if chunk.SubsectionIndex < best.SubsectionIndex {
+				before[chunk.SubsectionIndex] = true
+			}
+		}
+		hits = append(hits, &RetrievalHit{
+			ID:                chapterID,
+			Rank:              i + 1,
+			Score:             best.Score,
+			Distance:          best.Distance,
+			Certainty:         best.Certainty,
+			ExplainScore:      best.ExplainScore,
+			MatchedSubsection: len(before),
+			MatchedTitle:      best.Title,
+			Document: &Document{
+				Chapter:     best.Chapter,
+				Subsections: c.mergeChunks(grouped),
+				Source:      best.Source,
+				Metadata:    best.Metadata,
+				URL:         best.URL,
+				Breadcrumb:  best.Breadcrumb,
+			},
+		})
+	}
+	return hits
+}
+
+// mergeChunks rebuilds the subsections of a chapter from the chunks that were retrieved,
+// removing the overlap between consecutive chunks of the same subsection
+func (c ChunkingConfig) mergeChunks(chunks []Chunk) []Subsection {
+	c = c.normalized()
+
+	type group struct {
+		index  int
+		title  string
+		anchor string
+		pages  []int
+		chunks []Chunk
+	}
+	groups := make(map[int]*group)
+	for _, chunk := range chunks {
+		g, ok := groups[chunk.SubsectionIndex]
+		if !ok {
+			g = &group{index: chunk.SubsectionIndex, title: chunk.Title, anchor: chunk.Anchor}
+			groups[chunk.SubsectionIndex] = g
+		}
+		g.chunks = append(g.chunks, chunk)
+		for _, page := range chunk.Pages {
+			if !slices.Contains(g.pages, page) {
+				g.pages = append(g.pages, page)
+			}
+		}
+	}
+
+	ordered := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		ordered = append(ordered, g)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].index < ordered[j].index })
+
+	subsections := make([]Subsection, 0, len(ordered))
+	for _, g := range ordered {
+		sort.Slice(g.chunks, func(i, j int) bool { return g.chunks[i].ChunkIndex < g.chunks[j].ChunkIndex })
+
+		var content strings.Builder
+		for i, chunk := range g.chunks {
+			text := chunk.Content
+			if i > 0 {
+				if chunk.ChunkIndex == g.chunks[i-1].ChunkIndex+1 {
+					tokens := strings.Fields(text)
+					if len(tokens) > c.Overlap {
+						tokens = tokens[c.Overlap:]
+					}
+					text = " " + strings.Join(tokens, " ")
+				} else {
+					text = " ... " + text
+				}
+			}
+			content.WriteString(text)
+		}
+
+		sort.Ints(g.pages)
+		subsections = append(subsections, Subsection{
+			Title:   g.title,
+			Content: content.String(),
+			Pages:   g.pages,
+			Anchor:  g.anchor,
+		})
+	}
+	return subsections
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitIntoChunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ChunkingConfig
+		text   string
+		want   []string
+	}{
+		{
+			name:   "empty text",
+			config: ChunkingConfig{Size: 3},
+			text:   " \n\t ",
+			want:   nil,
+		},
+		{
+			name:   "text shorter than a chunk",
+			config: ChunkingConfig{Size: 5},
+			text:   "one  two\nthree",
+			want:   []string{"one two three"},
+		},
+		{
+			name:   "windows without overlap",
+			config: ChunkingConfig{Size: 2},
+			text:   "a b c d e",
+			want:   []string{"a b", "c d", "e"},
+		},
+		{
+			name:   "windows repeat the overlap",
+			config: ChunkingConfig{Size: 3, Overlap: 1},
+			text:   "a b c d e f g",
+			want:   []string{"a b c", "c d e", "e f g"},
+		},
+		{
+			name:   "last window ends the text",
+			config: ChunkingConfig{Size: 4, Overlap: 2},
+			text:   "a b c d e f",
+			want:   []string{"a b c d", "c d e f"},
+		},
+		{
+			name:   "overlap as large as the size is ignored",
+			config: ChunkingConfig{Size: 2, Overlap: 2},
+			text:   "a b c",
+			want:   []string{"a b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.config.splitIntoChunks(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitIntoChunks(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeChunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ChunkingConfig
+		chunks []Chunk
+		want   []Subsection
+	}{
+		{
+			name:   "consecutive chunks lose their overlap",
+			config: ChunkingConfig{Size: 3, Overlap: 1},
+			chunks: []Chunk{
+				{Title: "Install", Content: "c d e", ChunkIndex: 1, Pages: []int{2}},
+				{Title: "Install", Content: "a b c", ChunkIndex: 0, Pages: []int{1, 2}},
+			},
+			want: []Subsection{{Title: "Install", Content: "a b c d e", Pages: []int{1, 2}}},
+		},
+		{
+			name:   "a gap between chunks is marked",
+			config: ChunkingConfig{Size: 2},
+			chunks: []Chunk{
+				{Title: "Install", Content: "a b", ChunkIndex: 0},
+				{Title: "Install", Content: "e f", ChunkIndex: 2},
+			},
+			want: []Subsection{{Title: "Install", Content: "a b ... e f"}},
+		},
+		{
+			name:   "subsections are ordered by their index",
+			config: ChunkingConfig{Size: 10},
+			chunks: []Chunk{
+				{Title: "Upgrade", Content: "run the upgrade", SubsectionIndex: 2, Anchor: "upgrade"},
+				{Title: "Install", Content: "run the installer", SubsectionIndex: 0, Anchor: "install"},
+			},
+			want: []Subsection{
+				{Title: "Install", Content: "run the installer", Anchor: "install"},
+				{Title: "Upgrade", Content: "run the upgrade", Anchor: "upgrade"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.config.mergeChunks(tt.chunks)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeChunks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitAndMergeChunks(t *testing.T) {
+	config := ChunkingConfig{Size: 4, Overlap: 2}
+	text := strings.Repeat("word ", 9) + "last"
+
+	var chunks []Chunk
+	for i, content := range config.splitIntoChunks(text) {
+		chunks = append(chunks, Chunk{Title: "All", Content: content, ChunkIndex: i})
+	}
+	subsections := config.mergeChunks(chunks)
+	if len(subsections) != 1 {
+		t.Fatalf("mergeChunks() returned %d subsections, want 1", len(subsections))
+	}
+	if got, want := subsections[0].Content, strings.Join(strings.Fields(text), " "); got != want {
+		t.Errorf("merged content = %q, want %q", got, want)
+	}
+}
+
+func TestChunksToHits(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []Chunk
+		wantIDs       []string
+		wantScores    []float64
+		wantMatched   []string
+		wantSubsIndex []int
+	}{
+		{
+			name: "chapters are ranked by their first chunk",
+			chunks: []Chunk{
+				{ChapterID: "b", Title: "B1", Content: "b one", Score: 0.9},
+				{ChapterID: "a", Title: "A1", Content: "a one", Score: 0.8},
+				{ChapterID: "b", Title: "B2", Content: "b two", SubsectionIndex: 1, Score: 0.7},
+				{ChapterID: "c", Title: "C1", Content: "c one", Score: 0.6},
+			},
+			wantIDs:       []string{"b", "a", "c"},
+			wantScores:    []float64{0.9, 0.8, 0.6},
+			wantMatched:   []string{"B1", "A1", "C1"},
+			wantSubsIndex: []int{0, 0, 0},
+		},
+		{
+			name: "the best chunk of a chapter sets its score and matched subsection",
+			chunks: []Chunk{
+				{ChapterID: "a", Title: "A1", Content: "a one", Score: 0.5},
+				{ChapterID: "a", Title: "A2", Content: "a two", SubsectionIndex: 1, Score: 0.9},
+			},
+			wantIDs:       []string{"a"},
+			wantScores:    []float64{0.9},
+			wantMatched:   []string{"A2"},
+			wantSubsIndex: []int{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := ChunkingConfig{}.chunksToHits(tt.chunks)
+			if len(hits) != len(tt.wantIDs) {
+				t.Fatalf("chunksToHits() returned %d hits, want %d", len(hits), len(tt.wantIDs))
+			}
+			for i, hit := range hits {
+				if hit.ID != tt.wantIDs[i] || hit.Rank != i+1 {
+					t.Errorf("hit %d = %s with rank %d, want %s with rank %d", i, hit.ID, hit.Rank, tt.wantIDs[i], i+1)
+				}
+				if hit.Score != tt.wantScores[i] {
+					t.Errorf("hit %d score = %v, want %v", i, hit.Score, tt.wantScores[i])
+				}
+				if hit.MatchedTitle != tt.wantMatched[i] || hit.MatchedSubsection != tt.wantSubsIndex[i] {
+					t.Errorf("hit %d matched %q at %d, want %q at %d", i, hit.MatchedTitle, hit.MatchedSubsection, tt.wantMatched[i], tt.wantSubsIndex[i])
+				}
+			}
+		})
+	}
+}
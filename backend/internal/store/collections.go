@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+var ErrCollectionNotMultiTenant = errors.New("class was created without multi-tenancy, export it with the kb cli, delete it and import it again with a tenant")
+
+// Collection is the pair of weaviate classes holding a knowledge base:
+// one object per chapter in Class and its chunks in ChunkClass.
+// Tenant is the organization the objects belong to, every read and write is scoped to it.
+// Reader is the user the reads are done for, they only return the documents it can access.
+type Collection struct {
+	Class      string
+	Tenant     string
+	Vectorizer string     // VectorizerNone when the vectors are written by the app embedder
+	Reader     *Principal // nil for the reads of the app itself, which see every document
+}
+
+func (c Collection) ChunkClass() string {
+	return c.Class + "Chunk"
+}
+
+// unrestricted returns the collection for the reads of the app itself, which see every document
+func (c Collection) unrestricted() Collection {
+	c.Reader = nil
+	return c
+}
+
+// CreateCollection creates the weaviate classes of a knowledge base, the classes that already exist are migrated
+// to the schema of schema.go. The classes are multi-tenant so that the documents of an organization are never
+// returned to another one.
+func (d *VectorsStore) CreateCollection(ctx context.Context, kb *KnowledgeBase) error {
+	plan, err := d.MigrateSchema(ctx, kb, true)
+	if err != nil {
+		return err
+	}
+	return plan.Err()
+}
+
+// DeleteCollection deletes the weaviate classes of a knowledge base with all their objects
+func (d *VectorsStore) DeleteCollection(ctx context.Context, collection Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	for _, className := range []string{collection.ChunkClass(), collection.Class} {
+		exists, err := d.client.Schema().ClassExistenceChecker().WithClassName(className).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("error checking if class %s exists: %w", className, err)
+		}
+		if !exists {
+			continue
+		}
+		if err := d.client.Schema().ClassDeleter().WithClassName(className).Do(ctx); err != nil {
+			return fmt.Errorf("error deleting class %s: %w", className, err)
+		}
+	}
+	return nil
+}
+
+// CreateTenant adds the tenant of the collection to its classes, nothing is done when it already exists
+func (d *VectorsStore) CreateTenant(ctx context.Context, collection Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	for _, className := range []string{collection.Class, collection.ChunkClass()} {
+		exists, err := d.client.Schema().TenantsExists().WithClassName(className).WithTenant(collection.Tenant).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("error checking if tenant %s of class %s exists: %w", collection.Tenant, className, err)
+		}
+		if exists {
+			continue
+		}
+		err = d.client.Schema().TenantsCreator().
+			WithClassName(className).
+			WithTenants(models.Tenant{Name: collection.Tenant, ActivityStatus: models.TenantActivityStatusHOT}).
+			Do(ctx)
+		if err != nil {
+			return fmt.Errorf("error creating tenant %s of class %s: %w", collection.Tenant, className, err)
+		}
+	}
+	return nil
+}
+
+// SetTenantActive loads (HOT) or offloads (COLD) the tenant of the collection, an inactive tenant can not be read or written
+func (d *VectorsStore) SetTenantActive(ctx context.Context, collection Collection, active bool) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	status := models.TenantActivityStatusCOLD
+	if active {
+		status = models.TenantActivityStatusHOT
+	}
+	for _, className := range []string{collection.Class, collection.ChunkClass()} {
+		err := d.client.Schema().TenantsUpdater().
+			WithClassName(className).
+			WithTenants(models.Tenant{Name: collection.Tenant, ActivityStatus: status}).
+			Do(ctx)
+		if err != nil {
+			return fmt.Errorf("error updating tenant %s of class %s: %w", collection.Tenant, className, err)
+		}
+	}
+	return nil
+}
+
+// DeleteTenant deletes the tenant of the collection with all its objects
+func (d *VectorsStore) DeleteTenant(ctx context.Context, collection Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	for _, className := range []string{collection.ChunkClass(), collection.Class} {
+		err := d.client.Schema().TenantsDeleter().WithClassName(className).WithTenants(collection.Tenant).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("error deleting tenant %s of class %s: %w", collection.Tenant, className, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/filters"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+var (
+	ErrDuplicateDocument      = errors.New("document is a copy of a chapter already indexed")
+	ErrUnknownDuplicatePolicy = errors.New("unknown duplicate policy, use off, flag, reject or merge")
+)
+
+// DuplicatePolicy decides what the ingestion does with a document that has the same text as a chapter already
+// indexed, or a vector closer to it than the duplicate threshold
+type DuplicatePolicy string
+
+const (
+	DuplicateOff    DuplicatePolicy = "off"
+	DuplicateFlag   DuplicatePolicy = "flag"   // the document is indexed and the chapter it copies is reported on the job
+	DuplicateReject DuplicatePolicy = "reject" // the document is not indexed and its chapter of the job fails
+	DuplicateMerge  DuplicatePolicy = "merge"  // the document is not indexed, its tags are added to the chapter it copies
+)
+
+// duplicateLimit is the number of similar chapters looked up for a document
+const duplicateLimit = 5
+
+func ParseDuplicatePolicy(value string, fallback DuplicatePolicy) (DuplicatePolicy, error) {
+	switch policy := DuplicatePolicy(value); policy {
+	case DuplicateOff, DuplicateFlag, DuplicateReject, DuplicateMerge:
+		return policy, nil
+	case "":
+		return fallback, nil
+	default:
+		return "", ErrUnknownDuplicatePolicy
+	}
+}
+
+// DuplicateMatch is a chapter already indexed that a document copies
+type DuplicateMatch struct {
+	ID         string  `json:"id"`
+	Chapter    string  `json:"chapter"`
+	Similarity float32 `json:"similarity"` // cosine similarity of the vectors, 1 for the exact copies
+	Exact      bool    `json:"exact"`      // same text once the case and the spaces are normalized
+}
+
+// DuplicateCluster is a group of chapters that copy each other
+type DuplicateCluster struct {
+	Chapters      []ChapterRef `json:"chapters"`
+	Exact         bool         `json:"exact"`          // every chapter has the same text
+	MinSimilarity float32      `json:"min_similarity"` // lowest similarity of the pairs that link the chapters
+}
+
+// ChapterRef identifies a chapter in the reports
+type ChapterRef struct {
+	ID        string `json:"id"`
+	Chapter   string `json:"chapter"`
+	Source    string `json:"source,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// TextHash is the hash of the text of the subsections of a document, without the chapter name, titles or metadata,
+// so that the copies of a page uploaded by different teams have the same hash. It is "" for a document without text.
+func TextHash(doc Document) string {
+	var texts []string
+	for _, subsection := range doc.Subsections {
+		if text := strings.Join(strings.Fields(strings.ToLower(subsection.Content)), " "); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(strings.Join(texts, "\n")))
+	return hex.EncodeToString(hash[:])
+}
+
+// sortDuplicateMatches puts the exact copies first, then the most similar chapters, and keeps duplicateLimit of them
+func sortDuplicateMatches(matches map[string]*DuplicateMatch) []DuplicateMatch {
+	sorted := make([]DuplicateMatch, 0, len(matches))
+	for _, match := range matches {
+		sorted = append(sorted, *match)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Exact != sorted[j].Exact {
+			return sorted[i].Exact
+		}
+		if sorted[i].Similarity != sorted[j].Similarity {
+			return sorted[i].Similarity > sorted[j].Similarity
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	if len(sorted) > duplicateLimit {
+		sorted = sorted[:duplicateLimit]
+	}
+	return sorted
+}
+
+// FindDuplicates returns the chapters of the collection that the reader can access with the same text as the document,
+// or whose vector has a cosine similarity of at least threshold with it
+func (d *VectorsStore) FindDuplicates(ctx context.Context, collection Collection, doc Document, threshold float32) ([]DuplicateMatch, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	fields := []graphql.Field{
+		{Name: "chapter"},
+		{Name: "_additional", Fields: []graphql.Field{{Name: "id"}, {Name: "distance"}}},
+	}
+	matches := make(map[string]*DuplicateMatch)
+
+	if hash := TextHash(doc); hash != "" {
+		response, err := d.client.GraphQL().Get().
+			WithClassName(collection.Class).
+			WithTenant(collection.Tenant).
+			WithWhere(andWhere(
+				filters.Where().
+					WithPath([]string{"textHash"}).
+					WithOperator(filters.Equal).
+					WithValueText(hash),
+				accessWhere(collection.Reader),
+			)).
+			WithFields(fields[0], graphql.Field{Name: "_additional", Fields: []graphql.Field{{Name: "id"}}}).
+			WithLimit(duplicateLimit).
+			Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up copies of chapter %s: %w", doc.Chapter, err)
+		}
+		err = parseDuplicateMatches(response, collection.Class, func(match *DuplicateMatch) {
+			match.Exact = true
+			match.Similarity = 1
+			matches[match.ID] = match
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the vectors are compared with the cosine distance, 1 - similarity
+	text := objectText(chapterProperties(doc))
+	maxDistance := 1 - threshold
+	nearVector, err := d.nearVector(ctx, collection, text, maxDistance)
+	if err != nil {
+		return nil, err
+	}
+	get := d.client.GraphQL().Get().
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
+		WithFields(fields...).
+		WithLimit(duplicateLimit)
+	if where := accessWhere(collection.Reader); where != nil {
+		get = get.WithWhere(where)
+	}
+	if nearVector != nil {
+		get = get.WithNearVector(nearVector)
+	} else {
+		get = get.WithNearText(d.client.GraphQL().NearTextArgBuilder().
+			WithConcepts([]string{text}).
+			WithDistance(maxDistance))
+	}
+	response, err := get.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up chapters similar to %s: %w", doc.Chapter, err)
+	}
+	err = parseDuplicateMatches(response, collection.Class, func(match *DuplicateMatch) {
+		if _, ok := matches[match.ID]; !ok {
+			matches[match.ID] = match
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sortDuplicateMatches(matches), nil
+}
+
+func parseDuplicateMatches(response *models.GraphQLResponse, className string, fn func(*DuplicateMatch)) error {
+	if len(response.Errors) > 0 {
+		return fmt.Errorf("GraphQL response error: %s", response.Errors[0].Message)
+	}
+	getData, ok := response.Data["Get"].(map[string]any)
+	if !ok {
+		return fmt.Errorf("invalid response structure: missing 'Get' key")
+	}
+	rawChapters, _ := getData[className].([]any)
+	for _, item := range rawChapters {
+		itemMap, _ := item.(map[string]any)
+		additional, _ := itemMap["_additional"].(map[string]any)
+		match := &DuplicateMatch{}
+		match.ID, _ = additional["id"].(string)
+		match.Chapter, _ = itemMap["chapter"].(string)
+		if distance, ok := additional["distance"].(float64); ok {
+			match.Similarity = float32(1 - distance)
+		}
+		fn(match)
+	}
+	return nil
+}
+
+// FindDuplicateClusters groups the chapters of a collection that the reader can access and that have the
+// same text, or vectors with a cosine similarity of at least threshold. The chapters without a copy are left out.
+func FindDuplicateClusters(ctx context.Context, exporter interface {
+	ExportObjects(context.Context, Collection, bool, func(*ExportedObject) error) error
+}, collection Collection, threshold float32) ([]*DuplicateCluster, error) {
+	var objects []*ExportedObject
+	err := exporter.ExportObjects(ctx, collection, true, func(obj *ExportedObject) error {
+		if obj.Access.Allows(collection.Reader) {
+			objects = append(objects, obj)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(objects))
+	for i, obj := range objects {
+		hashes[i] = TextHash(obj.Document)
+	}
+
+	// union find of the pairs of copies, the root of a cluster keeps its lowest similarity and if it is exact
+	parents := make([]int, len(objects))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+	minSimilarity := make(map[int]float32)
+	inexact := make(map[int]bool)
+	for i := range objects {
+		for j := i + 1; j < len(objects); j++ {
+			exact := hashes[i] != "" && hashes[i] == hashes[j]
+			similarity := float32(1)
+			if !exact {
+				if len(objects[i].Vector) == 0 || len(objects[i].Vector) != len(objects[j].Vector) {
+					continue
+				}
+				similarity = float32(1 - cosineDistance(objects[i].Vector, objects[j].Vector))
+				if similarity < threshold {
+					continue
+				}
+			}
+
+			rootI, rootJ := find(i), find(j)
+			lowest := similarity
+			for _, root := range []int{rootI, rootJ} {
+				if value, ok := minSimilarity[root]; ok && value < lowest {
+					lowest = value
+				}
+			}
+			isInexact := !exact || inexact[rootI] || inexact[rootJ]
+			parents[rootJ] = rootI
+			minSimilarity[rootI] = lowest
+			inexact[rootI] = isInexact
+		}
+	}
+
+	byRoot := make(map[int]*DuplicateCluster)
+	var clusters []*DuplicateCluster
+	for i, obj := range objects {
+		root := find(i)
+		if _, linked := minSimilarity[root]; !linked {
+			continue
+		}
+		cluster, ok := byRoot[root]
+		if !ok {
+			cluster = &DuplicateCluster{Exact: !inexact[root], MinSimilarity: minSimilarity[root]}
+			byRoot[root] = cluster
+			clusters = append(clusters, cluster)
+		}
+		cluster.Chapters = append(cluster.Chapters, ChapterRef{
+			ID:        obj.ID,
+			Chapter:   obj.Chapter,
+			Source:    obj.Source,
+			CreatedAt: obj.CreatedAt,
+		})
+	}
+	// the biggest clusters crowd the results the most
+	sort.SliceStable(clusters, func(i, j int) bool { return len(clusters[i].Chapters) > len(clusters[j].Chapters) })
+	if clusters == nil {
+		clusters = []*DuplicateCluster{}
+	}
+	return clusters, nil
+}
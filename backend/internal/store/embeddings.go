@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+var (
+	ErrNoEmbedder = errors.New("the knowledge base has no weaviate vectorizer and no embedder is configured")
+)
+
+func (c Collection) clientEmbeddings() bool {
+	return c.Vectorizer == VectorizerNone
+}
+
+// embedObjects sets the vectors of the objects that do not have one yet, when the app computes the embeddings of the collection
+func (d *VectorsStore) embedObjects(ctx context.Context, collection Collection, objects []*models.Object) error {
+	if !collection.clientEmbeddings() {
+		return nil
+	}
+	if d.embedder == nil {
+		return ErrNoEmbedder
+	}
+
+	var texts []string
+	var missing []*models.Object
+	for _, obj := range objects {
+		if len(obj.Vector) > 0 {
+			continue
+		}
+		properties, _ := obj.Properties.(map[string]interface{})
+		texts = append(texts, objectText(properties))
+		missing = append(missing, obj)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	vectors, err := d.embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return err
+	}
+	if len(vectors) != len(missing) {
+		return fmt.Errorf("embedder returned %d vectors for %d objects", len(vectors), len(missing))
+	}
+	for i, obj := range missing {
+		obj.Vector = vectors[i]
+	}
+	return nil
+}
+
+// propertiesVector returns the vector of an object that is updated, nil when weaviate vectorizes the collection
+func (d *VectorsStore) propertiesVector(ctx context.Context, collection Collection, properties map[string]interface{}) ([]float32, error) {
+	if !collection.clientEmbeddings() {
+		return nil, nil
+	}
+	if d.embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	vectors, err := d.embedder.EmbedDocuments(ctx, []string{objectText(properties)})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// nearVector embeds a query for the collections without a weaviate vectorizer, nil means nearText can be used
+func (d *VectorsStore) nearVector(ctx context.Context, collection Collection, query string, distance float32) (*graphql.NearVectorArgumentBuilder, error) {
+	if !collection.clientEmbeddings() {
+		return nil, nil
+	}
+	if d.embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	vector, err := d.embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return d.client.GraphQL().NearVectorArgBuilder().WithVector(vector).WithDistance(distance), nil
+}
+
+// objectText is the text that is embedded for an object: the title and content of a chunk,
+// or the titles and contents of the subsections of a chapter
+func objectText(properties map[string]interface{}) string {
+	var builder strings.Builder
+	if chapter, ok := properties["chapter"].(string); ok {
+		builder.WriteString(chapter)
+	}
+	if content, ok := properties["content"].(string); ok {
+		title, _ := properties["title"].(string)
+		builder.WriteString("\n" + title + "\n" + content)
+		return builder.String()
+	}
+	subsections, _ := properties["subsections"].([]Subsection)
+	for _, subsection := range subsections {
+		builder.WriteString("\n" + subsection.Title + "\n" + subsection.Content)
+	}
+	return builder.String()
+}
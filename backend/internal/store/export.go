@@ -0,0 +1,354 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+const exportPageSize = 100
+
+var (
+	ErrImportConflict      = errors.New("object already exists")
+	ErrInvalidImportLine   = errors.New("invalid jsonl line")
+	ErrUnknownImportPolicy = errors.New("unknown conflict policy, use skip, overwrite or fail")
+)
+
+// ConflictPolicy decides what an import does with an object whose id or chapter already exists
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictFail      ConflictPolicy = "fail"
+)
+
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(value); policy {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return policy, nil
+	case "":
+		return ConflictSkip, nil
+	default:
+		return "", ErrUnknownImportPolicy
+	}
+}
+
+// ExportedObject is one line of a knowledge base export
+type ExportedObject struct {
+	ID string `json:"id"`
+	Document
+	CreatedAt string    `json:"created_at,omitempty"`
+	UpdatedAt string    `json:"updated_at,omitempty"`
+	Vector    []float32 `json:"vector,omitempty"`
+}
+
+type ImportReport struct {
+	Imported    int `json:"imported"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
+	// the overwritten chapters, for their versions
+	Changes []ChapterChange `json:"-"`
+}
+
+// overwriteChange returns the change of the chapter id overwritten by obj, the other chapter with the name of obj is deleted
+func overwriteChange(id string, previous Document, obj ExportedObject) ChapterChange {
+	change := ChapterChange{ID: id, Previous: previous}
+	if id == obj.ID {
+		change.Current = &obj.Document
+	}
+	return change
+}
+
+// ExportObjects walks every chapter object with the cursor api and calls fn for each of the ones the reader
+// of the collection can access
+func (d *VectorsStore) ExportObjects(ctx context.Context, collection Collection, withVectors bool, fn func(*ExportedObject) error) error {
+	additional := []graphql.Field{
+		{Name: "id"},
+		{Name: "creationTimeUnix"},
+		{Name: "lastUpdateTimeUnix"},
+	}
+	if withVectors {
+		additional = append(additional, graphql.Field{Name: "vector"})
+	}
+
+	after := ""
+	for {
+		objects, err := d.exportPage(ctx, collection, after, additional)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			// the cursor api takes no where filter, the access is checked on the page
+			if !obj.Access.Allows(collection.Reader) {
+				continue
+			}
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+		if len(objects) < exportPageSize {
+			return nil
+		}
+		after = objects[len(objects)-1].ID
+	}
+}
+
+func (d *VectorsStore) exportPage(ctx context.Context, collection Collection, after string, additional []graphql.Field) ([]*ExportedObject, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	fields := append([]graphql.Field{
+		{Name: "chapter"},
+		{
+			Name: "subsections",
+			Fields: []graphql.Field{
+				{Name: "title"},
+				{Name: "content"},
+				{Name: "pages"},
+			},
+		},
+		{Name: "source"},
+		{Name: "subsectionAnchors"},
+		{Name: "_additional", Fields: additional},
+	}, append(linkGraphQLFields(), append(metadataGraphQLFields(), accessGraphQLFields()...)...)...)
+	query := d.client.GraphQL().Get().
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
+		WithFields(fields...).
+		WithLimit(exportPageSize)
+	if after != "" {
+		query = query.WithAfter(after)
+	}
+
+	response, err := query.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL response error: %s", response.Errors[0].Message)
+	}
+
+	getData, ok := response.Data["Get"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid response structure: missing 'Get' key")
+	}
+	rawBooks, _ := getData[collection.Class].([]any)
+
+	objects := make([]*ExportedObject, 0, len(rawBooks))
+	for _, item := range rawBooks {
+		// the graphql fields have the same names as the json fields of the objects
+		itemJSON, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var raw struct {
+			Document
+			SubsectionAnchors []string `json:"subsectionAnchors"`
+			Additional        struct {
+				ID                 string    `json:"id"`
+				CreationTimeUnix   string    `json:"creationTimeUnix"`
+				LastUpdateTimeUnix string    `json:"lastUpdateTimeUnix"`
+				Vector             []float32 `json:"vector"`
+			} `json:"_additional"`
+		}
+		if err := json.Unmarshal(itemJSON, &raw); err != nil {
+			return nil, err
+		}
+		raw.Document.Metadata, err = metadataFromJSON(itemJSON)
+		if err != nil {
+			return nil, err
+		}
+		itemMap, _ := item.(map[string]interface{})
+		raw.Document.Access = accessFromProperties(itemMap)
+		setSubsectionAnchors(&raw.Document, raw.SubsectionAnchors)
+		objects = append(objects, &ExportedObject{
+			ID:        raw.Additional.ID,
+			Document:  raw.Document,
+			CreatedAt: raw.Additional.CreationTimeUnix,
+			UpdatedAt: raw.Additional.LastUpdateTimeUnix,
+			Vector:    raw.Additional.Vector,
+		})
+	}
+	return objects, nil
+}
+
+// ImportObjects writes exported objects back, keeping their ids and vectors.
+// With ConflictFail nothing of the batch is written when any of its objects already exists.
+func (d *VectorsStore) ImportObjects(ctx context.Context, collection Collection, objects []ExportedObject, policy ConflictPolicy) (*ImportReport, error) {
+	report := &ImportReport{}
+
+	conflicts := make([][]string, len(objects))
+	for i := range objects {
+		if objects[i].ID == "" {
+			objects[i].ID = uuid.New().String()
+		}
+		if _, err := uuid.Parse(objects[i].ID); err != nil {
+			return nil, fmt.Errorf("object %q of chapter %s: %w", objects[i].ID, objects[i].Chapter, ErrInvalidImportLine)
+		}
+
+		ids, err := d.conflictingObjectIDs(ctx, collection, objects[i])
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) > 0 && policy == ConflictFail {
+			return nil, fmt.Errorf("chapter %s (%s): %w", objects[i].Chapter, objects[i].ID, ErrImportConflict)
+		}
+		conflicts[i] = ids
+	}
+
+	var bookObjects []*models.Object
+	var chunkObjects []*models.Object
+	// the overwritten chapters, written back when the import of the batch fails
+	var replaced []ExportedObject
+	for i, obj := range objects {
+		if len(conflicts[i]) > 0 {
+			if policy == ConflictSkip {
+				report.Skipped++
+				continue
+			}
+			for _, id := range conflicts[i] {
+				previous, err := d.GetObjectWithID(ctx, collection.unrestricted(), id)
+				if err != nil {
+					return nil, err
+				}
+				if _, err := d.DeleteObjectWithID(ctx, collection, id); err != nil {
+					return nil, err
+				}
+				report.Changes = append(report.Changes, overwriteChange(id, *previous, obj))
+				replaced = append(replaced, ExportedObject{ID: id, Document: *previous})
+			}
+			report.Overwritten++
+		} else {
+			report.Imported++
+		}
+
+		bookObjects = append(bookObjects, &models.Object{
+			Class:      collection.Class,
+			ID:         strfmt.UUID(obj.ID),
+			Tenant:     collection.Tenant,
+			Vector:     obj.Vector,
+			Properties: chapterProperties(obj.Document),
+		})
+		for _, chunk := range d.chunking.chunkDocument(obj.ID, obj.Document) {
+			chunkObjects = append(chunkObjects, chunkToObject(chunk, collection))
+		}
+	}
+
+	ctx, cancel := writeContext(ctx)
+	defer cancel()
+
+	err := d.batchInsert(ctx, collection, bookObjects)
+	if err == nil {
+		err = d.batchInsert(ctx, collection, chunkObjects)
+	}
+	if err != nil {
+		if restoreErr := d.restoreChapters(ctx, collection, bookObjects, replaced); restoreErr != nil {
+			return nil, errors.Join(err, restoreErr)
+		}
+		return nil, err
+	}
+	return report, nil
+}
+
+// restoreChapters removes the chapters of a failed import and writes back the chapters it overwrote
+func (d *VectorsStore) restoreChapters(ctx context.Context, collection Collection, imported []*models.Object, replaced []ExportedObject) error {
+	if err := d.rollbackChapters(ctx, collection, imported); err != nil {
+		return err
+	}
+	if len(replaced) == 0 {
+		return nil
+	}
+
+	ctx, cancel := writeContext(context.WithoutCancel(ctx))
+	defer cancel()
+
+	var bookObjects []*models.Object
+	var chunkObjects []*models.Object
+	for _, obj := range replaced {
+		bookObjects = append(bookObjects, &models.Object{
+			Class:      collection.Class,
+			ID:         strfmt.UUID(obj.ID),
+			Tenant:     collection.Tenant,
+			Properties: chapterProperties(obj.Document),
+		})
+		for _, chunk := range d.chunking.chunkDocument(obj.ID, obj.Document) {
+			chunkObjects = append(chunkObjects, chunkToObject(chunk, collection))
+		}
+	}
+	if err := d.batchInsert(ctx, collection, bookObjects); err != nil {
+		return fmt.Errorf("error restoring overwritten chapters: %w", err)
+	}
+	if err := d.batchInsert(ctx, collection, chunkObjects); err != nil {
+		return fmt.Errorf("error restoring chunks of overwritten chapters: %w", err)
+	}
+	return nil
+}
+
+// conflictingObjectIDs returns the ids of the chapter objects that have the id or the chapter of obj
+func (d *VectorsStore) conflictingObjectIDs(ctx context.Context, collection Collection, obj ExportedObject) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var ids []string
+	exists, err := d.client.Data().Checker().WithClassName(collection.Class).WithTenant(collection.Tenant).WithID(obj.ID).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		ids = append(ids, obj.ID)
+	}
+
+	// the chapters the caller can not read also conflict, an import must not add a second chapter with their name
+	idResponse, err := d.GetObjectIDByChapter(ctx, collection.unrestricted(), obj.Chapter)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return nil, err
+	case idResponse.Id != obj.ID:
+		ids = append(ids, idResponse.Id)
+	}
+	return ids, nil
+}
+
+// DecodeExportedObjects reads a jsonl export and calls fn with batches of at most batchSize objects
+func DecodeExportedObjects(r io.Reader, batchSize int, fn func([]ExportedObject) error) error {
+	scanner := bufio.NewScanner(r)
+	// lines with vectors and long chapters are bigger than the default 64kb buffer
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+
+	var batch []ExportedObject
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var obj ExportedObject
+		if err := json.Unmarshal(scanner.Bytes(), &obj); err != nil {
+			return fmt.Errorf("line %d: %w: %s", lineNumber, ErrInvalidImportLine, err.Error())
+		}
+		batch = append(batch, obj)
+		if len(batch) == batchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+type FAQsStore struct {
+	client *sql.DB
+}
+
+// FAQEntry is an answer approved for some questions, like the ones on pricing or refunds.
+// It is returned as it is, instead of a generated answer, to the questions close enough to one of its variants.
+type FAQEntry struct {
+	ID            string    `json:"id"`
+	KnowledgeBase string    `json:"knowledge_base"`
+	Tenant        string    `json:"-"`
+	Questions     []string  `json:"questions"` // variants of the question, each one is embedded
+	Answer        string    `json:"answer"`
+	Links         []FAQLink `json:"links"`
+	CreatedAt     string    `json:"created_at"`
+	UpdatedAt     string    `json:"updated_at"`
+}
+
+type FAQLink struct {
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url"`
+}
+
+// FAQMatch is the entry with the variant closest to a question
+type FAQMatch struct {
+	Entry      *FAQEntry
+	Question   string  // the variant that matched
+	Similarity float64 // cosine similarity of the question and the variant
+}
+
+const faqEntryColumns = `e.id, e.knowledge_base, e.tenant, e.answer, e.links, e.created_at, e.updated_at,
+	ARRAY(SELECT question FROM faq_questions WHERE faq_id = e.id ORDER BY position)`
+
+// Create stores the entry with the vectors of its questions, in the same order
+func (s *FAQsStore) Create(ctx context.Context, entry *FAQEntry, vectors [][]float32) error {
+	links, err := faqLinksColumn(entry.Links)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO faq_entries (knowledge_base, tenant, answer, links)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.client, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, entry.KnowledgeBase, entry.Tenant, entry.Answer, links).Scan(
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		return insertFAQQuestions(ctx, tx, entry, vectors)
+	})
+}
+
+func (s *FAQsStore) GetByID(ctx context.Context, knowledgeBase string, tenant string, id string) (*FAQEntry, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, fmt.Errorf("faq %s: %w", id, ErrNotFound)
+	}
+	query := `
+	SELECT ` + faqEntryColumns + `
+	FROM faq_entries e
+	WHERE e.knowledge_base = $1 AND e.tenant = $2 AND e.id = $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	entry, err := scanFAQEntry(s.client.QueryRowContext(ctx, query, knowledgeBase, tenant, id))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, fmt.Errorf("faq %s: %w", id, ErrNotFound)
+		default:
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+func (s *FAQsStore) List(ctx context.Context, knowledgeBase string, tenant string) ([]*FAQEntry, error) {
+	query := `
+	SELECT ` + faqEntryColumns + `
+	FROM faq_entries e
+	WHERE e.knowledge_base = $1 AND e.tenant = $2
+	ORDER BY e.id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.client.QueryContext(ctx, query, knowledgeBase, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*FAQEntry{}
+	for rows.Next() {
+		entry, err := scanFAQEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Update replaces the questions, the answer and the links of the entry, the questions are embedded again
+func (s *FAQsStore) Update(ctx context.Context, entry *FAQEntry, vectors [][]float32) error {
+	if _, err := strconv.ParseInt(entry.ID, 10, 64); err != nil {
+		return fmt.Errorf("faq %s: %w", entry.ID, ErrNotFound)
+	}
+	links, err := faqLinksColumn(entry.Links)
+	if err != nil {
+		return err
+	}
+	query := `
+	UPDATE faq_entries
+	SET answer = $1, links = $2, updated_at = NOW()
+	WHERE knowledge_base = $3 AND tenant = $4 AND id = $5
+	RETURNING created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.client, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, entry.Answer, links, entry.KnowledgeBase, entry.Tenant, entry.ID).Scan(
+			&entry.CreatedAt,
+			&entry.UpdatedAt,
+		)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return fmt.Errorf("faq %s: %w", entry.ID, ErrNotFound)
+			default:
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM faq_questions WHERE faq_id = $1`, entry.ID); err != nil {
+			return err
+		}
+		return insertFAQQuestions(ctx, tx, entry, vectors)
+	})
+}
+
+func (s *FAQsStore) Delete(ctx context.Context, knowledgeBase string, tenant string, id string) error {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return fmt.Errorf("faq %s: %w", id, ErrNotFound)
+	}
+	query := `DELETE FROM faq_entries WHERE knowledge_base = $1 AND tenant = $2 AND id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.client.ExecContext(ctx, query, knowledgeBase, tenant, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("faq %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// Match returns the entry with the variant closest to the vector of a question when their cosine similarity
+// is at least threshold, ErrNotFound otherwise. The variants embedded with other dimensions are ignored.
+func (s *FAQsStore) Match(ctx context.Context, knowledgeBase string, tenant string, vector []float32, threshold float64) (*FAQMatch, error) {
+	query := `
+	SELECT ` + faqEntryColumns + `, q.question, 1 - (q.vector <=> $3::vector)
+	FROM faq_questions q
+	JOIN faq_entries e ON e.id = q.faq_id
+	WHERE e.knowledge_base = $1 AND e.tenant = $2
+		AND vector_dims(q.vector) = vector_dims($3::vector) AND q.vector <=> $3::vector <= $4
+	ORDER BY q.vector <=> $3::vector
+	LIMIT 1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	match := &FAQMatch{Entry: &FAQEntry{}}
+	var links []byte
+	err := s.client.QueryRowContext(ctx, query, knowledgeBase, tenant, vectorLiteral(vector), 1-threshold).Scan(
+		&match.Entry.ID,
+		&match.Entry.KnowledgeBase,
+		&match.Entry.Tenant,
+		&match.Entry.Answer,
+		&links,
+		&match.Entry.CreatedAt,
+		&match.Entry.UpdatedAt,
+		pq.Array(&match.Entry.Questions),
+		&match.Question,
+		&match.Similarity,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(links, &match.Entry.Links); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+func insertFAQQuestions(ctx context.Context, tx *sql.Tx, entry *FAQEntry, vectors [][]float32) error {
+	if len(vectors) != len(entry.Questions) {
+		return fmt.Errorf("got %d vectors for the %d questions of faq %s", len(vectors), len(entry.Questions), entry.ID)
+	}
+	query := `INSERT INTO faq_questions (faq_id, position, question, vector) VALUES ($1, $2, $3, $4::vector)`
+	for i, question := range entry.Questions {
+		if _, err := tx.ExecContext(ctx, query, entry.ID, i, question, vectorLiteral(vectors[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func faqLinksColumn(links []FAQLink) ([]byte, error) {
+	if links == nil {
+		links = []FAQLink{}
+	}
+	return json.Marshal(links)
+}
+
+func scanFAQEntry(row rowScanner) (*FAQEntry, error) {
+	entry := &FAQEntry{}
+	var links []byte
+	err := row.Scan(
+		&entry.ID,
+		&entry.KnowledgeBase,
+		&entry.Tenant,
+		&entry.Answer,
+		&links,
+		&entry.CreatedAt,
+		&entry.UpdatedAt,
+		pq.Array(&entry.Questions),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(links, &entry.Links); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	maxUnansweredQuestions = 2000 // questions clustered by a report, the newest ones
+	maxGapExamples         = 5
+)
+
+// UnansweredQuestion is a question that found no chapter, or that the bot answered with the fallback answer
+type UnansweredQuestion struct {
+	Question           string `json:"question"`
+	StandaloneQuestion string `json:"standalone_question"`
+	UserID             string `json:"user_id"`
+	NoResults          bool   `json:"no_results"` // no chapter was close enough to the question
+	AskedAt            string `json:"asked_at"`
+}
+
+// SearchText is the text embedded to cluster the question, the standalone question does not depend on the chat history
+func (q UnansweredQuestion) SearchText() string {
+	if q.StandaloneQuestion != "" {
+		return q.StandaloneQuestion
+	}
+	return q.Question
+}
+
+// GapCluster is a group of similar questions the documentation does not answer
+type GapCluster struct {
+	Count        int      `json:"count"`
+	NoResults    int      `json:"no_results"` // questions of the cluster that found no chapter at all
+	Examples     []string `json:"examples"`   // the most recent distinct questions
+	FirstAskedAt string   `json:"first_asked_at"`
+	LastAskedAt  string   `json:"last_asked_at"`
+	centroid     []float32
+}
+
+// KnowledgeGapReport lists the clusters of unanswered questions of a knowledge base, the biggest first
+type KnowledgeGapReport struct {
+	KnowledgeBase string        `json:"knowledge_base"`
+	Tenant        string        `json:"-"`
+	From          string        `json:"from"`
+	To            string        `json:"to"`
+	Threshold     float32       `json:"threshold"`
+	Unanswered    int           `json:"unanswered"`
+	Clusters      []*GapCluster `json:"clusters"`
+}
+
+// ClusterQuestions groups the questions whose vectors have a cosine similarity of at least threshold with the
+// centroid of a cluster. The questions are expected newest first, like UnansweredQuestions returns them.
+func ClusterQuestions(questions []UnansweredQuestion, vectors [][]float32, threshold float32) []*GapCluster {
+	clusters := []*GapCluster{}
+	for i, question := range questions {
+		if i >= len(vectors) {
+			break
+		}
+		vector := vectors[i]
+
+		var best *GapCluster
+		bestSimilarity := threshold
+		for _, cluster := range clusters {
+			if len(cluster.centroid) != len(vector) {
+				continue
+			}
+			if similarity := float32(1 - cosineDistance(cluster.centroid, vector)); similarity >= bestSimilarity {
+				best, bestSimilarity = cluster, similarity
+			}
+		}
+		if best == nil {
+			best = &GapCluster{
+				Examples:    []string{},
+				LastAskedAt: question.AskedAt,
+				centroid:    make([]float32, len(vector)),
+			}
+			clusters = append(clusters, best)
+		}
+
+		// the centroid is the sum of the vectors, the cosine distance does not depend on its length
+		for j := range vector {
+			best.centroid[j] += vector[j]
+		}
+		best.Count++
+		if question.NoResults {
+			best.NoResults++
+		}
+		best.FirstAskedAt = question.AskedAt
+		example := strings.TrimSpace(question.Question)
+		if len(best.Examples) < maxGapExamples && !slices.ContainsFunc(best.Examples, func(e string) bool { return strings.EqualFold(e, example) }) {
+			best.Examples = append(best.Examples, example)
+		}
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Count > clusters[j].Count })
+	return clusters
+}
@@ -0,0 +1,356 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	JobStatusQueued              = "queued"
+	JobStatusRunning             = "running"
+	JobStatusCompleted           = "completed"
+	JobStatusCompletedWithErrors = "completed_with_errors"
+	JobStatusFailed              = "failed"
+
+	JobChapterStatusPending = "pending"
+	JobChapterStatusDone    = "done"
+	JobChapterStatusFailed  = "failed"
+)
+
+type JobsStore struct {
+	client *sql.DB
+}
+
+type IngestionJob struct {
+	JobID             string                `json:"job_id"`
+	UserID            string                `json:"user_id"`
+	UserRoles         []string              `json:"-"`
+	UserGroups        []string              `json:"-"`
+	KnowledgeBase     string                `json:"knowledge_base"`
+	Tenant            string                `json:"tenant"`
+	DuplicatePolicy   DuplicatePolicy       `json:"duplicate_policy"`
+	Status            string                `json:"status"`
+	TotalChapters     int                   `json:"total_chapters"`
+	ProcessedChapters int                   `json:"processed_chapters"`
+	FailedChapters    int                   `json:"failed_chapters"`
+	Error             string                `json:"error,omitempty"`
+	Chapters          []IngestionJobChapter `json:"chapters,omitempty"`
+	CreatedAt         string                `json:"created_at"`
+	UpdatedAt         string                `json:"updated_at"`
+	StartedAt         *string               `json:"started_at"`
+	FinishedAt        *string               `json:"finished_at"`
+}
+
+// Principal returns the user who queued the job, the job only sees the chapters they can read
+func (j *IngestionJob) Principal() *Principal {
+	return &Principal{UserID: j.UserID, Roles: j.UserRoles, Groups: j.UserGroups}
+}
+
+type IngestionJobChapter struct {
+	ID       string   `json:"id"`
+	Chapter  string   `json:"chapter"`
+	Document Document `json:"-"`
+	Status   string   `json:"status"`
+	Attempts int      `json:"attempts"`
+	Error    string   `json:"error,omitempty"`
+	// DuplicateOf is the id of the chapter already indexed that the chapter copies
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// Create stores a queued job with one pending entry per chapter of the documents
+func (s *JobsStore) Create(ctx context.Context, job *IngestionJob, documents []Document) error {
+	return withTx(s.client, ctx, func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO ingestion_jobs (user_id, user_roles, user_groups, knowledge_base, tenant, status, duplicate_policy)
+		VALUES ($1, COALESCE($2::text[], '{}'), COALESCE($3::text[], '{}'), $4, $5, $6, $7)
+		RETURNING job_id, created_at, updated_at
+		`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		job.Status = JobStatusQueued
+		if job.DuplicatePolicy == "" {
+			job.DuplicatePolicy = DuplicateOff
+		}
+		err := tx.QueryRowContext(ctx, query,
+			job.UserID,
+			pq.Array(job.UserRoles),
+			pq.Array(job.UserGroups),
+			job.KnowledgeBase,
+			job.Tenant,
+			job.Status,
+			job.DuplicatePolicy,
+		).Scan(
+			&job.JobID,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		chapterQuery := `
+		INSERT INTO ingestion_job_chapters (job_id, position, chapter, document)
+		VALUES ($1, $2, $3, $4)
+		`
+		for position, document := range documents {
+			documentJSON, err := json.Marshal(document)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, chapterQuery, job.JobID, position, document.Chapter, documentJSON); err != nil {
+				return err
+			}
+		}
+		job.TotalChapters = len(documents)
+		return nil
+	})
+}
+
+// GetByID returns a job with the progress of each of its chapters
+func (s *JobsStore) GetByID(ctx context.Context, jobID string) (*IngestionJob, error) {
+	query := `
+	SELECT job_id, user_id, knowledge_base, tenant, duplicate_policy, status, error, created_at, updated_at, started_at, finished_at
+	FROM ingestion_jobs WHERE job_id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	job := &IngestionJob{}
+	var startedAt, finishedAt sql.NullString
+	err := s.client.QueryRowContext(ctx, query, jobID).Scan(
+		&job.JobID,
+		&job.UserID,
+		&job.KnowledgeBase,
+		&job.Tenant,
+		&job.DuplicatePolicy,
+		&job.Status,
+		&job.Error,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&startedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.String
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.String
+	}
+
+	job.Chapters, err = s.getChapters(ctx, job.JobID, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, chapter := range job.Chapters {
+		job.TotalChapters++
+		switch chapter.Status {
+		case JobChapterStatusDone:
+			job.ProcessedChapters++
+		case JobChapterStatusFailed:
+			job.ProcessedChapters++
+			job.FailedChapters++
+		}
+	}
+	return job, nil
+}
+
+// ClaimNext marks the oldest queued job as running with a lease and returns it, ErrNotFound when the queue is empty.
+// Jobs are locked with SKIP LOCKED so that several workers never claim the same job.
+func (s *JobsStore) ClaimNext(ctx context.Context, lease time.Duration) (*IngestionJob, error) {
+	query := `
+	UPDATE ingestion_jobs SET status = $1, started_at = COALESCE(started_at, NOW()), updated_at = NOW(),
+		lease_expires_at = NOW() + make_interval(secs => $3)
+	WHERE job_id = (
+		SELECT job_id FROM ingestion_jobs
+		WHERE status = $2
+		ORDER BY created_at, job_id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING job_id, user_id, user_roles, user_groups, knowledge_base, tenant, duplicate_policy, status, created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	job := &IngestionJob{}
+	err := s.client.QueryRowContext(ctx, query, JobStatusRunning, JobStatusQueued, lease.Seconds()).Scan(
+		&job.JobID,
+		&job.UserID,
+		pq.Array(&job.UserRoles),
+		pq.Array(&job.UserGroups),
+		&job.KnowledgeBase,
+		&job.Tenant,
+		&job.DuplicatePolicy,
+		&job.Status,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return job, nil
+}
+
+// RenewLease extends the lease of a running job, ErrNotFound when the job is no longer running
+func (s *JobsStore) RenewLease(ctx context.Context, jobID string, lease time.Duration) error {
+	query := `
+	UPDATE ingestion_jobs SET lease_expires_at = NOW() + make_interval(secs => $1)
+	WHERE job_id = $2 AND status = $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.client.ExecContext(ctx, query, lease.Seconds(), jobID, JobStatusRunning)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Fail marks a job as failed when it can not be processed at all, its chapters are left pending
+func (s *JobsStore) Fail(ctx context.Context, jobID string, reason string) error {
+	query := `
+	UPDATE ingestion_jobs SET status = $1, error = $2, lease_expires_at = NULL, finished_at = NOW(), updated_at = NOW()
+	WHERE job_id = $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.client.ExecContext(ctx, query, JobStatusFailed, reason, jobID)
+	return err
+}
+
+// GetPendingChapters returns the chapters of a job that still have to be indexed, with their document
+func (s *JobsStore) GetPendingChapters(ctx context.Context, jobID string) ([]IngestionJobChapter, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.getChapters(ctx, jobID, JobChapterStatusPending)
+}
+
+func (s *JobsStore) getChapters(ctx context.Context, jobID string, status string) ([]IngestionJobChapter, error) {
+	query := `
+	SELECT id, chapter, document, status, attempts, error, duplicate_of
+	FROM ingestion_job_chapters
+	WHERE job_id = $1 AND ($2 = '' OR status = $2)
+	ORDER BY position
+	`
+	rows, err := s.client.QueryContext(ctx, query, jobID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chapters []IngestionJobChapter
+	for rows.Next() {
+		var chapter IngestionJobChapter
+		var documentJSON []byte
+		if err := rows.Scan(
+			&chapter.ID,
+			&chapter.Chapter,
+			&documentJSON,
+			&chapter.Status,
+			&chapter.Attempts,
+			&chapter.Error,
+			&chapter.DuplicateOf,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(documentJSON, &chapter.Document); err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters, rows.Err()
+}
+
+// UpdateChapter saves the status, attempts and error of a chapter of a job
+func (s *JobsStore) UpdateChapter(ctx context.Context, chapter *IngestionJobChapter) error {
+	query := `
+	UPDATE ingestion_job_chapters SET status = $1, attempts = $2, error = $3, duplicate_of = $4, updated_at = NOW()
+	WHERE id = $5
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.client.ExecContext(ctx, query, chapter.Status, chapter.Attempts, chapter.Error, chapter.DuplicateOf, chapter.ID)
+	return err
+}
+
+// Finish sets the final status of a job from the status of its chapters
+func (s *JobsStore) Finish(ctx context.Context, jobID string) (string, error) {
+	query := `
+	UPDATE ingestion_jobs j SET status = CASE
+			WHEN c.failed = 0 THEN $1
+			WHEN c.failed = c.total THEN $2
+			ELSE $3
+		END,
+		lease_expires_at = NULL,
+		finished_at = NOW(),
+		updated_at = NOW()
+	FROM (
+		SELECT COUNT(*) AS total, COUNT(*) FILTER (WHERE status = $4) AS failed
+		FROM ingestion_job_chapters WHERE job_id = $5
+	) c
+	WHERE j.job_id = $5
+	RETURNING j.status
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var status string
+	err := s.client.QueryRowContext(ctx, query,
+		JobStatusCompleted,
+		JobStatusFailed,
+		JobStatusCompletedWithErrors,
+		JobChapterStatusFailed,
+		jobID,
+	).Scan(&status)
+	if err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// RequeueExpired puts back in the queue the running jobs whose lease expired, their instance stopped without
+// finishing them. The chapters already indexed are not processed again.
+func (s *JobsStore) RequeueExpired(ctx context.Context) (int64, error) {
+	query := `
+	UPDATE ingestion_jobs SET status = $1, lease_expires_at = NULL, updated_at = NOW()
+	WHERE status = $2 AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := s.client.ExecContext(ctx, query, JobStatusQueued, JobStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultKnowledgeBaseName = "default"
+	DefaultVectorizer        = "text2vec-transformers"
+	// the knowledge bases with no weaviate vectorizer get their vectors from the app embedder
+	VectorizerNone = "none"
+)
+
+var (
+	ErrDuplicateKnowledgeBase = errors.New("knowledge base with that name already exists")
+)
+
+type KnowledgeBasesStore struct {
+	client *sql.DB
+}
+
+// KnowledgeBase is a named corpus, stored in its own weaviate classes with its own vectorizer
+type KnowledgeBase struct {
+	ID               string         `json:"id"`
+	Name             string         `json:"name"`
+	Description      string         `json:"description"`
+	ClassName        string         `json:"class_name"`
+	Vectorizer       string         `json:"vectorizer"`
+	VectorizerConfig map[string]any `json:"vectorizer_config,omitempty"`
+	CreatedAt        string         `json:"created_at"`
+	UpdatedAt        string         `json:"updated_at"`
+}
+
+// Collection returns the classes of the knowledge base scoped to the objects of a tenant
+func (kb *KnowledgeBase) Collection(tenant string) Collection {
+	return Collection{Class: kb.ClassName, Tenant: tenant, Vectorizer: kb.Vectorizer}
+}
+
+// ClassNameFromName turns a knowledge base name like "admin-guide_v3" into a valid weaviate class name ("AdminGuideV3")
+func ClassNameFromName(name string) string {
+	var builder strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if r > unicode.MaxASCII {
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		builder.WriteRune(r)
+	}
+
+	className := builder.String()
+	// class names must start with an uppercase letter
+	if className == "" || !unicode.IsLetter(rune(className[0])) {
+		className = "Kb" + className
+	}
+	return className
+}
+
+func (s *KnowledgeBasesStore) Create(ctx context.Context, kb *KnowledgeBase) error {
+	query := `
+	INSERT INTO knowledge_bases (name, description, class_name, vectorizer, vectorizer_config)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING kb_id, created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	vectorizerConfig, err := json.Marshal(kb.VectorizerConfig)
+	if err != nil {
+		return err
+	}
+	if kb.VectorizerConfig == nil {
+		vectorizerConfig = []byte("{}")
+	}
+
+	err = s.client.QueryRowContext(ctx, query,
+		kb.Name,
+		kb.Description,
+		kb.ClassName,
+		kb.Vectorizer,
+		vectorizerConfig,
+	).Scan(
+		&kb.ID,
+		&kb.CreatedAt,
+		&kb.UpdatedAt,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrDuplicateKnowledgeBase
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *KnowledgeBasesStore) GetByName(ctx context.Context, name string) (*KnowledgeBase, error) {
+	query := `
+	SELECT kb_id, name, description, class_name, vectorizer, vectorizer_config, created_at, updated_at
+	FROM knowledge_bases WHERE name = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	kb, err := scanKnowledgeBase(s.client.QueryRowContext(ctx, query, name))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return kb, nil
+}
+
+func (s *KnowledgeBasesStore) List(ctx context.Context) ([]*KnowledgeBase, error) {
+	query := `
+	SELECT kb_id, name, description, class_name, vectorizer, vectorizer_config, created_at, updated_at
+	FROM knowledge_bases ORDER BY name
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.client.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var kbs []*KnowledgeBase
+	for rows.Next() {
+		kb, err := scanKnowledgeBase(rows)
+		if err != nil {
+			return nil, err
+		}
+		kbs = append(kbs, kb)
+	}
+	return kbs, rows.Err()
+}
+
+func (s *KnowledgeBasesStore) Update(ctx context.Context, kb *KnowledgeBase) error {
+	query := `
+	UPDATE knowledge_bases SET description = $1, updated_at = NOW()
+	WHERE kb_id = $2
+	RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.client.QueryRowContext(ctx, query, kb.Description, kb.ID).Scan(&kb.UpdatedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *KnowledgeBasesStore) Delete(ctx context.Context, kbID string) error {
+	query := `DELETE FROM knowledge_bases WHERE kb_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.client.ExecContext(ctx, query, kbID)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanKnowledgeBase(row rowScanner) (*KnowledgeBase, error) {
+	kb := &KnowledgeBase{}
+	var vectorizerConfig []byte
+	err := row.Scan(
+		&kb.ID,
+		&kb.Name,
+		&kb.Description,
+		&kb.ClassName,
+		&kb.Vectorizer,
+		&vectorizerConfig,
+		&kb.CreatedAt,
+		&kb.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(vectorizerConfig, &kb.VectorizerConfig); err != nil {
+		return nil, err
+	}
+	return kb, nil
+}
@@ -0,0 +1,26 @@
+package store
+
+import "testing"
+
+func TestClassNameFromName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "admin-guide_v3", want: "AdminGuideV3"},
+		{name: "faq", want: "Faq"},
+		{name: "User Manual", want: "UserManual"},
+		{name: "alreadyCamel", want: "AlreadyCamel"},
+		{name: "2024-release", want: "Kb2024Release"},
+		{name: "café-menu", want: "CafMenu"},
+		{name: "---", want: "Kb"},
+		{name: "", want: "Kb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassNameFromName(tt.name); got != tt.want {
+				t.Errorf("ClassNameFromName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+)
+
+// SubsectionURL returns the deep link to a subsection of the document: the url of the chapter with the
+// anchor of the subsection, only the url when the subsection has no anchor and "" when the chapter has no url
+func (d *Document) SubsectionURL(index int) string {
+	if d.URL == "" {
+		return ""
+	}
+	if index < 0 || index >= len(d.Subsections) {
+		return d.URL
+	}
+	return deepLink(d.URL, d.Subsections[index].Anchor)
+}
+
+// deepLink joins the url of a chapter and the anchor of one of its subsections
+func deepLink(url string, anchor string) string {
+	if url == "" || anchor == "" {
+		return url
+	}
+	base, _, _ := strings.Cut(url, "#")
+	return base + "#" + strings.TrimPrefix(anchor, "#")
+}
+
+// SubsectionBreadcrumb returns the path of a subsection in the documentation: the breadcrumb of the
+// chapter followed by the chapter and the title of the subsection
+func (d *Document) SubsectionBreadcrumb(index int) []string {
+	breadcrumb := append([]string{}, d.Breadcrumb...)
+	if d.Chapter != "" {
+		breadcrumb = append(breadcrumb, d.Chapter)
+	}
+	if index >= 0 && index < len(d.Subsections) && d.Subsections[index].Title != "" {
+		breadcrumb = append(breadcrumb, d.Subsections[index].Title)
+	}
+	return breadcrumb
+}
+
+// setLinkProperties adds the links of a document to the properties of its chapter object. The anchors are
+// stored next to the subsections, like their hashes, so that the nested subsections keep their schema.
+func setLinkProperties(properties map[string]interface{}, doc Document) {
+	if doc.URL != "" {
+		properties["url"] = doc.URL
+	}
+	if len(doc.Breadcrumb) > 0 {
+		properties["breadcrumb"] = doc.Breadcrumb
+	}
+
+	anchors := make([]string, 0, len(doc.Subsections))
+	hasAnchors := false
+	for _, subsection := range doc.Subsections {
+		anchors = append(anchors, subsection.Anchor)
+		hasAnchors = hasAnchors || subsection.Anchor != ""
+	}
+	if hasAnchors {
+		properties["subsectionAnchors"] = anchors
+	}
+}
+
+// setSubsectionAnchors copies back the anchors read from a chapter object in its subsections
+func setSubsectionAnchors(doc *Document, anchors []string) {
+	for i := range doc.Subsections {
+		if i < len(anchors) {
+			doc.Subsections[i].Anchor = anchors[i]
+		}
+	}
+}
+
+func linkGraphQLFields() []graphql.Field {
+	return []graphql.Field{{Name: "url"}, {Name: "breadcrumb"}}
+}
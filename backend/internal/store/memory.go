@@ -0,0 +1,887 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/embedding"
+)
+
+// MemoryVectorsStore keeps the chapters and chunks in memory and searches them by brute force,
+// so that the api runs without weaviate. With a snapshot path the objects are saved to disk
+// after every change and loaded again on start.
+type MemoryVectorsStore struct {
+	chunking     ChunkingConfig
+	retrieval    RetrievalConfig
+	embedder     embedding.Embedder
+	snapshotPath string
+
+	mu       sync.RWMutex
+	chapters map[string]*memoryChapter // by memoryKey
+}
+
+type memoryChapter struct {
+	Class            string        `json:"class"`
+	Tenant           string        `json:"tenant"`
+	ID               string        `json:"id"`
+	Document         Document      `json:"document"`
+	ContentHash      string        `json:"content_hash"`
+	SubsectionHashes []string      `json:"subsection_hashes"`
+	Vector           []float32     `json:"vector"`
+	Chunks           []memoryChunk `json:"chunks"`
+	CreatedAt        int64         `json:"created_at"` // unix milliseconds, like weaviate
+	UpdatedAt        int64         `json:"updated_at"`
+}
+
+type memoryChunk struct {
+	Chunk
+	Vector []float32 `json:"vector"`
+}
+
+func memoryKey(collection Collection, id string) string {
+	return collection.Class + "/" + collection.Tenant + "/" + id
+}
+
+func NewMemoryVectorsStore(chunking ChunkingConfig, retrieval RetrievalConfig, embedder embedding.Embedder, snapshotPath string) (*MemoryVectorsStore, error) {
+	m := &MemoryVectorsStore{
+		chunking:     chunking,
+		retrieval:    retrieval,
+		embedder:     embedder,
+		snapshotPath: snapshotPath,
+		chapters:     make(map[string]*memoryChapter),
+	}
+	if snapshotPath == "" {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var chapters []*memoryChapter
+	if err := json.Unmarshal(data, &chapters); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", snapshotPath, err)
+	}
+	for _, chapter := range chapters {
+		m.chapters[memoryKey(Collection{Class: chapter.Class, Tenant: chapter.Tenant}, chapter.ID)] = chapter
+	}
+	return m, nil
+}
+
+func (m *MemoryVectorsStore) CreateVectors(ctx context.Context, collection Collection, data *RagData) (*VectorCreatedResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, doc := range data.Documents {
+		if m.findChapter(collection, doc.Chapter) != nil {
+			return nil, fmt.Errorf("error: chapter %s %w", doc.Chapter, ErrChapterAlreadyExists)
+		}
+	}
+
+	var chaptersCreated []string
+	var chapters []*memoryChapter
+	for _, doc := range data.Documents {
+		chapter, err := m.newChapter(ctx, collection, uuid.New().String(), doc, nil)
+		if err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, chapter)
+		chaptersCreated = append(chaptersCreated, doc.Chapter)
+	}
+	for _, chapter := range chapters {
+		m.chapters[memoryKey(collection, chapter.ID)] = chapter
+	}
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return &VectorCreatedResponse{ChaptersCreated: chaptersCreated}, nil
+}
+
+func (m *MemoryVectorsStore) UpsertVectors(ctx context.Context, collection Collection, data *RagData, fullSync bool) (*UpsertReport, error) {
+	report := &UpsertReport{
+		Created:   []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+		Deleted:   []string{},
+	}
+
+	seen := make(map[string]bool, len(data.Documents))
+	for _, doc := range data.Documents {
+		if seen[doc.Chapter] {
+			return nil, fmt.Errorf("chapter %s: %w", doc.Chapter, ErrDuplicateChapter)
+		}
+		seen[doc.Chapter] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, doc := range data.Documents {
+		properties := chapterProperties(doc)
+
+		existing := m.findChapter(collection, doc.Chapter)
+		switch {
+		case existing == nil:
+			chapter, err := m.newChapter(ctx, collection, uuid.New().String(), doc, nil)
+			if err != nil {
+				return nil, err
+			}
+			m.chapters[memoryKey(collection, chapter.ID)] = chapter
+			report.Created = append(report.Created, doc.Chapter)
+
+		case existing.ContentHash == properties["contentHash"]:
+			report.Unchanged = append(report.Unchanged, doc.Chapter)
+
+		default:
+			previous := existing.Document
+			changed := changedSubsections(existing.SubsectionHashes, properties["subsectionHashes"].([]string))
+			if err := m.updateChapter(ctx, existing, doc, changed); err != nil {
+				return nil, err
+			}
+			report.Updated = append(report.Updated, doc.Chapter)
+			report.Changes = append(report.Changes, ChapterChange{ID: existing.ID, Previous: previous, Current: &doc})
+		}
+	}
+
+	if fullSync {
+		for key, chapter := range m.chapters {
+			if chapter.Class != collection.Class || chapter.Tenant != collection.Tenant || seen[chapter.Document.Chapter] {
+				continue
+			}
+			delete(m.chapters, key)
+			report.Deleted = append(report.Deleted, chapter.Document.Chapter)
+			report.Changes = append(report.Changes, ChapterChange{ID: chapter.ID, Previous: chapter.Document})
+		}
+		sort.Strings(report.Deleted)
+	}
+
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (m *MemoryVectorsStore) GetClosestVectors(ctx context.Context, collection Collection, query string, filter *MetadataFilter) ([]*RetrievalHit, error) {
+	maxDistance := 0.5 // same cosine distance threshold as the weaviate search
+	limit := m.retrieval.normalized().Candidates
+
+	if m.embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	vector, err := m.embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type match struct {
+		chunk    Chunk
+		vector   []float32
+		distance float64
+	}
+	var matches []match
+	for _, chapter := range m.chapters {
+		if chapter.Class != collection.Class || chapter.Tenant != collection.Tenant || !chapter.Document.Access.Allows(collection.Reader) {
+			continue
+		}
+		for _, chunk := range chapter.Chunks {
+			if !filter.matches(chunk.Metadata) {
+				continue
+			}
+			distance := cosineDistance(vector, chunk.Vector)
+			if distance < maxDistance {
+				matches = append(matches, match{chunk.Chunk, chunk.Vector, distance})
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil, ErrNotFound
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].distance < matches[j].distance })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	chunks := make([]Chunk, 0, len(matches))
+	vectors := make([][]float32, 0, len(matches))
+	for _, match := range matches {
+		match.chunk.setDistance(match.distance)
+		chunks = append(chunks, match.chunk)
+		vectors = append(vectors, match.vector)
+	}
+	return m.chunking.chunksToHits(m.retrieval.diversify(chunks, vectors)), nil
+}
+
+// false = chapter not found / true = chapter found
+func (m *MemoryVectorsStore) chapterExists(ctx context.Context, collection Collection, chapter string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.findChapter(collection, chapter) != nil, nil
+}
+
+func (m *MemoryVectorsStore) GetObjectIDByChapter(ctx context.Context, collection Collection, chapter string) (*IDResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	existing := m.findChapter(collection, chapter)
+	if existing == nil || !existing.Document.Access.Allows(collection.Reader) {
+		return nil, fmt.Errorf("no object found for chapter %s: %w", chapter, ErrNotFound)
+	}
+	return &IDResponse{Id: existing.ID}, nil
+}
+
+func (m *MemoryVectorsStore) GetObjectWithID(ctx context.Context, collection Collection, id string) (*Document, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chapter, ok := m.chapters[memoryKey(collection, id)]
+	if !ok || !chapter.Document.Access.Allows(collection.Reader) {
+		return nil, fmt.Errorf("object with id %s: %w", id, ErrNotFound)
+	}
+	document := chapter.Document
+	return &document, nil
+}
+
+func (m *MemoryVectorsStore) DeleteChapterWithChapterName(ctx context.Context, collection Collection, chapterName string) (*SuccessfullyAPIOperation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing := m.findChapter(collection, chapterName)
+	if existing == nil {
+		return nil, fmt.Errorf("error can not delete chapter, chapter %s does not exits: %w", chapterName, ErrNotFound)
+	}
+	delete(m.chapters, memoryKey(collection, existing.ID))
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return &SuccessfullyAPIOperation{Message: "Chapter deleted successfully"}, nil
+}
+
+func (m *MemoryVectorsStore) DeleteObjectWithID(ctx context.Context, collection Collection, idToDelete string) (*SuccessfullyAPIOperation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryKey(collection, idToDelete)
+	if _, ok := m.chapters[key]; !ok {
+		return nil, fmt.Errorf("object with id %s does not exist: %w", idToDelete, ErrNotFound)
+	}
+	delete(m.chapters, key)
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return &SuccessfullyAPIOperation{Message: "Object deleted successfully "}, nil
+}
+
+func (m *MemoryVectorsStore) UpdateObjectWithID(ctx context.Context, collection Collection, updatedDocuments Document, idToUpdate string) (*SuccessfullyAPIOperation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.chapters[memoryKey(collection, idToUpdate)]
+	if !ok {
+		return nil, fmt.Errorf("error updating object with id %s, it does not exist: %w", idToUpdate, ErrNotFound)
+	}
+
+	// every subsection is chunked again
+	changed := make(map[int]bool)
+	for i := 0; i < max(len(updatedDocuments.Subsections), len(existing.Document.Subsections)); i++ {
+		changed[i] = true
+	}
+	if err := m.updateChapter(ctx, existing, updatedDocuments, changed); err != nil {
+		return nil, err
+	}
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return &SuccessfullyAPIOperation{Message: "Object updated successfully"}, nil
+}
+
+func (m *MemoryVectorsStore) ExportObjects(ctx context.Context, collection Collection, withVectors bool, fn func(*ExportedObject) error) error {
+	m.mu.RLock()
+	var chapters []*memoryChapter
+	for _, chapter := range m.chapters {
+		if chapter.Class == collection.Class && chapter.Tenant == collection.Tenant && chapter.Document.Access.Allows(collection.Reader) {
+			chapters = append(chapters, chapter)
+		}
+	}
+	m.mu.RUnlock()
+
+	// same order as the weaviate cursor
+	sort.Slice(chapters, func(i, j int) bool { return chapters[i].ID < chapters[j].ID })
+	for _, chapter := range chapters {
+		obj := &ExportedObject{
+			ID:        chapter.ID,
+			Document:  chapter.Document,
+			CreatedAt: strconv.FormatInt(chapter.CreatedAt, 10),
+			UpdatedAt: strconv.FormatInt(chapter.UpdatedAt, 10),
+		}
+		if withVectors {
+			obj.Vector = chapter.Vector
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryVectorsStore) ImportObjects(ctx context.Context, collection Collection, objects []ExportedObject, policy ConflictPolicy) (*ImportReport, error) {
+	report := &ImportReport{}
+
+	for i := range objects {
+		if objects[i].ID == "" {
+			objects[i].ID = uuid.New().String()
+		}
+		if _, err := uuid.Parse(objects[i].ID); err != nil {
+			return nil, fmt.Errorf("object %q of chapter %s: %w", objects[i].ID, objects[i].Chapter, ErrInvalidImportLine)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conflicts := make([][]string, len(objects))
+	for i, obj := range objects {
+		if _, ok := m.chapters[memoryKey(collection, obj.ID)]; ok {
+			conflicts[i] = append(conflicts[i], obj.ID)
+		}
+		if existing := m.findChapter(collection, obj.Chapter); existing != nil && existing.ID != obj.ID {
+			conflicts[i] = append(conflicts[i], existing.ID)
+		}
+		if len(conflicts[i]) > 0 && policy == ConflictFail {
+			return nil, fmt.Errorf("chapter %s (%s): %w", obj.Chapter, obj.ID, ErrImportConflict)
+		}
+	}
+
+	for i, obj := range objects {
+		if len(conflicts[i]) > 0 {
+			if policy == ConflictSkip {
+				report.Skipped++
+				continue
+			}
+			for _, id := range conflicts[i] {
+				if previous, ok := m.chapters[memoryKey(collection, id)]; ok {
+					report.Changes = append(report.Changes, overwriteChange(id, previous.Document, obj))
+				}
+				delete(m.chapters, memoryKey(collection, id))
+			}
+			report.Overwritten++
+		} else {
+			report.Imported++
+		}
+
+		chapter, err := m.newChapter(ctx, collection, obj.ID, obj.Document, obj.Vector)
+		if err != nil {
+			return nil, err
+		}
+		m.chapters[memoryKey(collection, chapter.ID)] = chapter
+	}
+
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ListChapters returns a page of the chapters the reader can access, resuming after the sort value and id of the cursor
+func (m *MemoryVectorsStore) ListChapters(ctx context.Context, collection Collection, query ChapterListQuery) (*ChapterPage, error) {
+	query, err := query.keysetNormalized()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := decodeChapterCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	var chapters []*memoryChapter
+	for _, chapter := range m.chapters {
+		if chapter.Class != collection.Class || chapter.Tenant != collection.Tenant || !chapter.Document.Access.Allows(collection.Reader) {
+			continue
+		}
+		if query.Filter.matches(chapter.Document.Metadata) {
+			chapters = append(chapters, chapter)
+		}
+	}
+	m.mu.RUnlock()
+
+	// compare returns -1, 0 or 1 like strings.Compare, on the sort value then the id
+	compare := func(chapter *memoryChapter, value string, id string) int {
+		var result int
+		switch query.Sort {
+		case ChapterSortCreated:
+			created, _ := strconv.ParseInt(value, 10, 64)
+			result = cmp.Compare(chapter.CreatedAt, created)
+		case ChapterSortUpdated:
+			updated, _ := strconv.ParseInt(value, 10, 64)
+			result = cmp.Compare(chapter.UpdatedAt, updated)
+		default:
+			result = strings.Compare(chapter.Document.Chapter, value)
+		}
+		if result == 0 {
+			result = strings.Compare(chapter.ID, id)
+		}
+		if query.Descending {
+			result = -result
+		}
+		return result
+	}
+	sortValue := func(chapter *memoryChapter) string {
+		switch query.Sort {
+		case ChapterSortCreated:
+			return strconv.FormatInt(chapter.CreatedAt, 10)
+		case ChapterSortUpdated:
+			return strconv.FormatInt(chapter.UpdatedAt, 10)
+		default:
+			return chapter.Document.Chapter
+		}
+	}
+	sort.Slice(chapters, func(i, j int) bool {
+		return compare(chapters[i], sortValue(chapters[j]), chapters[j].ID) < 0
+	})
+
+	page := &ChapterPage{Chapters: []*ChapterSummary{}}
+	var last *memoryChapter
+	for _, chapter := range chapters {
+		if cursor != nil && compare(chapter, cursor.Value, cursor.ID) <= 0 {
+			continue
+		}
+		if len(page.Chapters) == query.Limit {
+			page.NextCursor = chapterCursor{Value: sortValue(last), ID: last.ID}.encode()
+			break
+		}
+		last = chapter
+		summary := &ChapterSummary{
+			ID:        chapter.ID,
+			Chapter:   chapter.Document.Chapter,
+			Titles:    make([]string, 0, len(chapter.Document.Subsections)),
+			Source:    chapter.Document.Source,
+			URL:       chapter.Document.URL,
+			Metadata:  chapter.Document.Metadata,
+			CreatedAt: strconv.FormatInt(chapter.CreatedAt, 10),
+			UpdatedAt: strconv.FormatInt(chapter.UpdatedAt, 10),
+		}
+		for _, subsection := range chapter.Document.Subsections {
+			summary.Titles = append(summary.Titles, subsection.Title)
+		}
+		page.Chapters = append(page.Chapters, summary)
+	}
+	return page, nil
+}
+
+// SearchTitles returns the chapters and subsections whose titles contain every keyword
+func (m *MemoryVectorsStore) SearchTitles(ctx context.Context, collection Collection, keywords string, limit int) ([]*TitleMatch, error) {
+	if limit <= 0 || limit > MaxChapterPageSize {
+		limit = DefaultChapterPageSize
+	}
+	words := strings.Fields(strings.ToLower(keywords))
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matches := []*TitleMatch{}
+	if len(words) == 0 {
+		return matches, nil
+	}
+	for _, chapter := range m.chapters {
+		if chapter.Class != collection.Class || chapter.Tenant != collection.Tenant || !chapter.Document.Access.Allows(collection.Reader) {
+			continue
+		}
+		for i, subsection := range chapter.Document.Subsections {
+			text := strings.ToLower(subsection.Title + " " + chapter.Document.Chapter)
+			if !slices.ContainsFunc(words, func(word string) bool { return !strings.Contains(text, word) }) {
+				matches = append(matches, &TitleMatch{
+					ID:              chapter.ID,
+					Chapter:         chapter.Document.Chapter,
+					Title:           subsection.Title,
+					SubsectionIndex: i,
+					URL:             chapter.Document.SubsectionURL(i),
+				})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Chapter != matches[j].Chapter {
+			return matches[i].Chapter < matches[j].Chapter
+		}
+		return matches[i].SubsectionIndex < matches[j].SubsectionIndex
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// CountFacets counts the chapters the reader can access for every value of the metadata fields
+func (m *MemoryVectorsStore) CountFacets(ctx context.Context, collection Collection) (*MetadataFacets, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	facets := &MetadataFacets{Fields: make(map[string][]FacetCount, len(metadataFields))}
+	counts := make(map[string]map[string]int)
+	for _, chapter := range m.chapters {
+		if chapter.Class != collection.Class || chapter.Tenant != collection.Tenant || !chapter.Document.Access.Allows(collection.Reader) {
+			continue
+		}
+		facets.Chapters++
+		for field, values := range facetValues(chapter.Document.Metadata) {
+			if counts[field] == nil {
+				counts[field] = make(map[string]int)
+			}
+			for _, value := range values {
+				counts[field][value]++
+			}
+		}
+	}
+	for _, field := range metadataFields {
+		facets.Fields[field] = sortFacetCounts(counts[field])
+	}
+	return facets, nil
+}
+
+// FindDuplicates returns the chapters of the collection with the same text as the document,
+// or whose vector has a cosine similarity of at least threshold with it
+func (m *MemoryVectorsStore) FindDuplicates(ctx context.Context, collection Collection, doc Document, threshold float32) ([]DuplicateMatch, error) {
+	vectors, err := m.embed(ctx, chapterProperties(doc), nil)
+	if err != nil {
+		return nil, err
+	}
+	hash := TextHash(doc)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matches := make(map[string]*DuplicateMatch)
+	for _, chapter := range m.chapters {
+		if chapter.Class != collection.Class || chapter.Tenant != collection.Tenant || !chapter.Document.Access.Allows(collection.Reader) {
+			continue
+		}
+		match := &DuplicateMatch{ID: chapter.ID, Chapter: chapter.Document.Chapter}
+		if hash != "" && TextHash(chapter.Document) == hash {
+			match.Exact = true
+			match.Similarity = 1
+		} else {
+			match.Similarity = float32(1 - cosineDistance(vectors[0], chapter.Vector))
+			if match.Similarity < threshold {
+				continue
+			}
+		}
+		matches[chapter.ID] = match
+	}
+	return sortDuplicateMatches(matches), nil
+}
+
+// Search returns a page of the subsections matching the query, the keyword score counts the words of the query
+// found in the chunks and the hybrid one fuses the scores of both searches
+func (m *MemoryVectorsStore) Search(ctx context.Context, collection Collection, query SearchQuery) (*SearchPage, error) {
+	query, err := query.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	var vector []float32
+	if query.Mode != SearchModeKeyword {
+		if m.embedder == nil {
+			return nil, ErrNoEmbedder
+		}
+		vector, err = m.embedder.EmbedQuery(ctx, query.Query)
+		if err != nil {
+			return nil, err
+		}
+	}
+	terms := searchTerms(query.Query)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var vectorHits, keywordHits []searchHit
+	for _, chapter := range m.chapters {
+		if chapter.Class != collection.Class || chapter.Tenant != collection.Tenant || !chapter.Document.Access.Allows(collection.Reader) {
+			continue
+		}
+		for _, chunk := range chapter.Chunks {
+			if !query.Filter.matches(chunk.Metadata) {
+				continue
+			}
+			if vector != nil {
+				if distance := cosineDistance(vector, chunk.Vector); distance < searchMaxDistance {
+					vectorHits = append(vectorHits, searchHit{chunk: chunk.Chunk, score: 1 - distance})
+				}
+			}
+			if query.Mode != SearchModeVector {
+				if score := keywordScore(terms, chunk.Chapter+" "+chunk.Title+" "+chunk.Content); score > 0 {
+					keywordHits = append(keywordHits, searchHit{chunk: chunk.Chunk, score: score})
+				}
+			}
+		}
+	}
+
+	var hits []searchHit
+	switch query.Mode {
+	case SearchModeHybrid:
+		hits = fuseHits(vectorHits, keywordHits, hybridAlpha)
+	case SearchModeKeyword:
+		hits = keywordHits
+	default:
+		hits = vectorHits
+	}
+	return query.page(hits), nil
+}
+
+// keywordScore sums the saturated frequencies of the terms in the text, like bm25 without the document lengths
+func keywordScore(terms []string, text string) float64 {
+	counts := make(map[string]int)
+	for _, word := range searchTerms(text) {
+		counts[word]++
+	}
+	score := 0.0
+	for _, term := range terms {
+		if count := float64(counts[term]); count > 0 {
+			score += count / (count + 1.2)
+		}
+	}
+	return score
+}
+
+// RelatedChapters returns the chapters whose vectors are the closest to the one of the chapter with the id,
+// without the chapter itself
+func (m *MemoryVectorsStore) RelatedChapters(ctx context.Context, collection Collection, id string, filter *MetadataFilter, limit int) ([]*RelatedChapter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	source, ok := m.chapters[memoryKey(collection, id)]
+	if !ok || !source.Document.Access.Allows(collection.Reader) {
+		return nil, fmt.Errorf("object with id %s: %w", id, ErrNotFound)
+	}
+
+	related := []*RelatedChapter{}
+	for _, chapter := range m.chapters {
+		if chapter.Class != collection.Class || chapter.Tenant != collection.Tenant || chapter.ID == id {
+			continue
+		}
+		if !chapter.Document.Access.Allows(collection.Reader) || !filter.matches(chapter.Document.Metadata) {
+			continue
+		}
+		related = append(related, &RelatedChapter{
+			ID:         chapter.ID,
+			Chapter:    chapter.Document.Chapter,
+			Source:     chapter.Document.Source,
+			URL:        chapter.Document.URL,
+			Breadcrumb: chapter.Document.Breadcrumb,
+			Metadata:   chapter.Document.Metadata,
+			Similarity: 1 - cosineDistance(source.Vector, chapter.Vector),
+		})
+	}
+	sort.SliceStable(related, func(i, j int) bool { return related[i].Similarity > related[j].Similarity })
+	return related[:min(len(related), relatedLimit(limit))], nil
+}
+
+func (m *MemoryVectorsStore) CreateCollection(ctx context.Context, kb *KnowledgeBase) error {
+	return nil
+}
+
+// the objects in memory have no schema
+func (m *MemoryVectorsStore) MigrateSchema(ctx context.Context, kb *KnowledgeBase, apply bool) (*SchemaPlan, error) {
+	return &SchemaPlan{
+		KnowledgeBase: kb.Name,
+		Additive:      []SchemaChange{},
+		Incompatible:  []SchemaChange{},
+		Applied:       apply,
+	}, nil
+}
+
+func (m *MemoryVectorsStore) DeleteCollection(ctx context.Context, collection Collection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, chapter := range m.chapters {
+		if chapter.Class == collection.Class {
+			delete(m.chapters, key)
+		}
+	}
+	return m.save()
+}
+
+func (m *MemoryVectorsStore) CreateTenant(ctx context.Context, collection Collection) error {
+	return nil
+}
+
+// the requests of a deactivated organization are already refused before reaching the store
+func (m *MemoryVectorsStore) SetTenantActive(ctx context.Context, collection Collection, active bool) error {
+	return nil
+}
+
+func (m *MemoryVectorsStore) DeleteTenant(ctx context.Context, collection Collection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, chapter := range m.chapters {
+		if chapter.Class == collection.Class && chapter.Tenant == collection.Tenant {
+			delete(m.chapters, key)
+		}
+	}
+	return m.save()
+}
+
+// findChapter returns the chapter of the collection with that name, the lock must be held
+func (m *MemoryVectorsStore) findChapter(collection Collection, name string) *memoryChapter {
+	for _, chapter := range m.chapters {
+		if chapter.Class == collection.Class && chapter.Tenant == collection.Tenant && chapter.Document.Chapter == name {
+			return chapter
+		}
+	}
+	return nil
+}
+
+// newChapter embeds a document and its chunks, the vector of the chapter is computed when it is nil
+func (m *MemoryVectorsStore) newChapter(ctx context.Context, collection Collection, id string, doc Document, vector []float32) (*memoryChapter, error) {
+	properties := chapterProperties(doc)
+	chunks := m.chunking.chunkDocument(id, doc)
+
+	vectors, err := m.embed(ctx, properties, chunks)
+	if err != nil {
+		return nil, err
+	}
+	if vector == nil {
+		vector = vectors[0]
+	}
+
+	now := time.Now().UnixMilli()
+	chapter := &memoryChapter{
+		Class:            collection.Class,
+		Tenant:           collection.Tenant,
+		ID:               id,
+		Document:         doc,
+		ContentHash:      properties["contentHash"].(string),
+		SubsectionHashes: properties["subsectionHashes"].([]string),
+		Vector:           vector,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	for i, chunk := range chunks {
+		chapter.Chunks = append(chapter.Chunks, memoryChunk{chunk, vectors[i+1]})
+	}
+	return chapter, nil
+}
+
+// updateChapter replaces the text and vector of a chapter, the chunks of the unchanged subsections are kept
+func (m *MemoryVectorsStore) updateChapter(ctx context.Context, chapter *memoryChapter, doc Document, changed map[int]bool) error {
+	properties := chapterProperties(doc)
+
+	var chunks []Chunk
+	for _, chunk := range m.chunking.chunkDocument(chapter.ID, doc) {
+		if changed[chunk.SubsectionIndex] {
+			chunks = append(chunks, chunk)
+		}
+	}
+	vectors, err := m.embed(ctx, properties, chunks)
+	if err != nil {
+		return err
+	}
+
+	kept := chapter.Chunks[:0]
+	for _, chunk := range chapter.Chunks {
+		if !changed[chunk.SubsectionIndex] {
+			// the chapter name is copied in every chunk
+			chunk.Chapter = doc.Chapter
+			kept = append(kept, chunk)
+		}
+	}
+	for i, chunk := range chunks {
+		kept = append(kept, memoryChunk{chunk, vectors[i+1]})
+	}
+
+	chapter.Document = doc
+	chapter.ContentHash = properties["contentHash"].(string)
+	chapter.SubsectionHashes = properties["subsectionHashes"].([]string)
+	chapter.Vector = vectors[0]
+	chapter.Chunks = kept
+	chapter.UpdatedAt = time.Now().UnixMilli()
+	return nil
+}
+
+// embed returns the vector of the chapter followed by the vectors of its chunks
+func (m *MemoryVectorsStore) embed(ctx context.Context, properties map[string]interface{}, chunks []Chunk) ([][]float32, error) {
+	if m.embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	texts := make([]string, 0, len(chunks)+1)
+	texts = append(texts, objectText(properties))
+	for _, chunk := range chunks {
+		texts = append(texts, chunkText(chunk))
+	}
+	vectors, err := m.embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+	return vectors, nil
+}
+
+// save writes the snapshot, the lock must be held. The file is replaced at once so that a crash
+// does not leave half of it.
+func (m *MemoryVectorsStore) save() error {
+	if m.snapshotPath == "" {
+		return nil
+	}
+
+	chapters := make([]*memoryChapter, 0, len(m.chapters))
+	for _, chapter := range m.chapters {
+		chapters = append(chapters, chapter)
+	}
+	data, err := json.Marshal(chapters)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.snapshotPath), filepath.Base(m.snapshotPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.snapshotPath)
+}
+
+func cosineDistance(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return math.Inf(1)
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 1
+	}
+	return 1 - dot/(math.Sqrt(normA)*math.Sqrt(normB))
+}
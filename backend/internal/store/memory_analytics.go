@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryAnalyticsStore keeps the query events and the times the reports were sent in memory, for the memory backend
+type MemoryAnalyticsStore struct {
+	mu          sync.Mutex
+	events      []QueryEvent // in insertion order
+	reportsSent map[string]time.Time
+	started     time.Time
+}
+
+func NewMemoryAnalyticsStore() *MemoryAnalyticsStore {
+	return &MemoryAnalyticsStore{
+		reportsSent: make(map[string]time.Time),
+		started:     time.Now(),
+	}
+}
+
+// inRange returns the events of the knowledge base and tenant of the range, the lock must be held
+func (s *MemoryAnalyticsStore) inRange(r AnalyticsRange) []QueryEvent {
+	var events []QueryEvent
+	for _, event := range s.events {
+		if event.KnowledgeBase == r.KnowledgeBase && event.Tenant == r.Tenant &&
+			!event.CreatedAt.Before(r.From) && event.CreatedAt.Before(r.To) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func (s *MemoryAnalyticsStore) CreateBatch(ctx context.Context, events []*QueryEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = time.Now()
+		}
+		stored := *event
+		stored.Retrieved = slices.Clone(event.Retrieved)
+		s.events = append(s.events, stored)
+	}
+	return nil
+}
+
+func (s *MemoryAnalyticsStore) TopQuestions(ctx context.Context, r AnalyticsRange) ([]QuestionCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type counted struct {
+		QuestionCount
+		lastAskedAt time.Time
+	}
+	var order []string
+	counts := make(map[string]*counted)
+	for _, event := range s.inRange(r) {
+		key := strings.ToLower(strings.TrimSpace(event.Question))
+		count, ok := counts[key]
+		if !ok {
+			count = &counted{QuestionCount: QuestionCount{Question: event.Question}}
+			counts[key] = count
+			order = append(order, key)
+		}
+		count.Question = min(count.Question, event.Question)
+		count.Count++
+		if event.InsufficientInfo {
+			count.InsufficientInfo++
+		}
+		if event.CreatedAt.After(count.lastAskedAt) {
+			count.lastAskedAt = event.CreatedAt
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := counts[order[i]], counts[order[j]]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.lastAskedAt.After(b.lastAskedAt)
+	})
+	questions := []QuestionCount{}
+	for _, key := range order[:min(len(order), r.limit())] {
+		count := counts[key]
+		count.LastAskedAt = memoryTimestamp(count.lastAskedAt)
+		questions = append(questions, count.QuestionCount)
+	}
+	return questions, nil
+}
+
+func (s *MemoryAnalyticsStore) TopChapters(ctx context.Context, r AnalyticsRange, hidden []string) ([]ChapterCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	counts := make(map[string]*ChapterCount)
+	for _, event := range s.inRange(r) {
+		for _, object := range event.Retrieved {
+			if slices.Contains(hidden, object.ID) {
+				continue
+			}
+			count, ok := counts[object.ID]
+			if !ok {
+				count = &ChapterCount{ID: object.ID}
+				counts[object.ID] = count
+				ids = append(ids, object.ID)
+			}
+			count.Chapter = max(count.Chapter, object.Chapter)
+			count.Count++
+			// the sum of the distances until the average is computed below
+			count.AvgDistance += object.Distance
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := counts[ids[i]], counts[ids[j]]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.ID < b.ID
+	})
+	chapters := []ChapterCount{}
+	for _, id := range ids[:min(len(ids), r.limit())] {
+		count := counts[id]
+		count.AvgDistance /= float64(count.Count)
+		chapters = append(chapters, *count)
+	}
+	return chapters, nil
+}
+
+func (s *MemoryAnalyticsStore) RetrievedChapterIDs(ctx context.Context, r AnalyticsRange) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make(map[string]bool)
+	for _, event := range s.inRange(r) {
+		for _, object := range event.Retrieved {
+			ids[object.ID] = true
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryAnalyticsStore) UnansweredQuestions(ctx context.Context, r AnalyticsRange) ([]UnansweredQuestion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := s.inRange(r)
+	slices.SortStableFunc(events, func(a, b QueryEvent) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	var questions []UnansweredQuestion
+	for _, event := range events {
+		if !event.InsufficientInfo {
+			continue
+		}
+		if len(questions) == maxUnansweredQuestions {
+			break
+		}
+		questions = append(questions, UnansweredQuestion{
+			Question:           event.Question,
+			StandaloneQuestion: event.StandaloneQuestion,
+			UserID:             event.UserID,
+			NoResults:          len(event.Retrieved) == 0,
+			AskedAt:            memoryTimestamp(event.CreatedAt),
+		})
+	}
+	return questions, nil
+}
+
+func (s *MemoryAnalyticsStore) UnansweredScopes(ctx context.Context, from time.Time, to time.Time) ([]AnalyticsRange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[[2]string]bool)
+	var scopes []AnalyticsRange
+	for _, event := range s.events {
+		scope := [2]string{event.KnowledgeBase, event.Tenant}
+		if !event.InsufficientInfo || event.CreatedAt.Before(from) || !event.CreatedAt.Before(to) || seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		scopes = append(scopes, AnalyticsRange{KnowledgeBase: event.KnowledgeBase, Tenant: event.Tenant, From: from, To: to})
+	}
+	sort.Slice(scopes, func(i, j int) bool {
+		if scopes[i].KnowledgeBase != scopes[j].KnowledgeBase {
+			return scopes[i].KnowledgeBase < scopes[j].KnowledgeBase
+		}
+		return scopes[i].Tenant < scopes[j].Tenant
+	})
+	return scopes, nil
+}
+
+func (s *MemoryAnalyticsStore) ClaimReport(ctx context.Context, name string, now time.Time, interval time.Duration) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// like the report_schedules rows of the migrations, the first report is due one interval after the start
+	lastSentAt, ok := s.reportsSent[name]
+	if !ok {
+		lastSentAt = s.started
+	}
+	if lastSentAt.After(now.Add(-interval)) {
+		return time.Time{}, false, nil
+	}
+	s.reportsSent[name] = now
+	return lastSentAt, true, nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMemoryAnalyticsStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryAnalyticsStore()
+
+	now := time.Now()
+	events := []*QueryEvent{
+		{KnowledgeBase: "default", Question: "How to install?", CreatedAt: now.Add(-3 * time.Hour),
+			Retrieved: []RetrievedObject{{ID: "a", Chapter: "Install", Distance: 0.2}}},
+		{KnowledgeBase: "default", Question: " how to install? ", CreatedAt: now.Add(-2 * time.Hour), InsufficientInfo: true,
+			Retrieved: []RetrievedObject{{ID: "a", Chapter: "Install", Distance: 0.4}, {ID: "b", Chapter: "Upgrade", Distance: 0.5}}},
+		{KnowledgeBase: "default", Question: "Refunds?", CreatedAt: now.Add(-time.Hour), InsufficientInfo: true},
+		{KnowledgeBase: "default", Tenant: "acme", Question: "Pricing?", CreatedAt: now.Add(-time.Hour), InsufficientInfo: true},
+		{KnowledgeBase: "default", Question: "Too old", CreatedAt: now.Add(-48 * time.Hour), InsufficientInfo: true},
+	}
+	if err := s.CreateBatch(ctx, events); err != nil {
+		t.Fatalf("CreateBatch() error = %v", err)
+	}
+	r := AnalyticsRange{KnowledgeBase: "default", From: now.Add(-24 * time.Hour), To: now}
+
+	questions, err := s.TopQuestions(ctx, r)
+	if err != nil {
+		t.Fatalf("TopQuestions() error = %v", err)
+	}
+	if len(questions) != 2 || questions[0].Question != " how to install? " || questions[0].Count != 2 || questions[0].InsufficientInfo != 1 {
+		t.Errorf("TopQuestions() = %+v", questions)
+	}
+
+	chapters, err := s.TopChapters(ctx, r, []string{"b"})
+	if err != nil {
+		t.Fatalf("TopChapters() error = %v", err)
+	}
+	if len(chapters) != 1 || chapters[0].ID != "a" || chapters[0].Count != 2 || math.Abs(chapters[0].AvgDistance-0.3) > 1e-9 {
+		t.Errorf("TopChapters() = %+v, want chapter a retrieved twice at 0.3", chapters)
+	}
+
+	unanswered, err := s.UnansweredQuestions(ctx, r)
+	if err != nil {
+		t.Fatalf("UnansweredQuestions() error = %v", err)
+	}
+	if len(unanswered) != 2 || unanswered[0].Question != "Refunds?" || !unanswered[0].NoResults || unanswered[1].NoResults {
+		t.Errorf("UnansweredQuestions() = %+v, want the newest first", unanswered)
+	}
+
+	scopes, err := s.UnansweredScopes(ctx, r.From, r.To)
+	if err != nil {
+		t.Fatalf("UnansweredScopes() error = %v", err)
+	}
+	if len(scopes) != 2 || scopes[0].Tenant != "" || scopes[1].Tenant != "acme" {
+		t.Errorf("UnansweredScopes() = %+v", scopes)
+	}
+
+	// the first report is due one interval after the start, then once per interval
+	if _, claimed, _ := s.ClaimReport(ctx, "knowledge_gaps", now, time.Hour); claimed {
+		t.Error("ClaimReport() claimed a report before the interval")
+	}
+	if _, claimed, _ := s.ClaimReport(ctx, "knowledge_gaps", now.Add(2*time.Hour), time.Hour); !claimed {
+		t.Error("ClaimReport() did not claim a due report")
+	}
+	if _, claimed, _ := s.ClaimReport(ctx, "knowledge_gaps", now.Add(2*time.Hour+time.Minute), time.Hour); claimed {
+		t.Error("ClaimReport() claimed a report sent a minute before")
+	}
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/memory"
+)
+
+// MemoryChatHistoryStore keeps the chat histories in memory instead of redis, for the memory backend
+type MemoryChatHistoryStore struct {
+	mu        sync.Mutex
+	histories map[string]*memory.ChatMessageHistory
+}
+
+func NewMemoryChatHistoryStore() *MemoryChatHistoryStore {
+	return &MemoryChatHistoryStore{
+		histories: make(map[string]*memory.ChatMessageHistory),
+	}
+}
+
+func (c *MemoryChatHistoryStore) GetChatHistory(ctx context.Context, clientID string) (map[string]any, error) {
+	c.mu.Lock()
+	chatHistory, ok := c.histories[clientID]
+	if !ok {
+		chatHistory = memory.NewChatMessageHistory()
+		c.histories[clientID] = chatHistory
+	}
+	c.mu.Unlock()
+
+	// memory buffer only has 4 slots, like the redis one
+	memoryBuffer := memory.NewConversationWindowBuffer(4, func(b *memory.ConversationBuffer) {
+		b.ChatHistory = chatHistory
+	})
+	return memoryBuffer.LoadMemoryVariables(ctx, map[string]any{})
+}
+
+func (c *MemoryChatHistoryStore) PostChatData(ctx context.Context) error {
+	return nil
+}
+
+// MemoryRelatedCacheStore keeps the related chapters in memory instead of redis, for the memory backend.
+// The lists expire after relatedCacheTTL like the redis ones.
+type MemoryRelatedCacheStore struct {
+	mu    sync.Mutex
+	lists []memoryRelatedList
+}
+
+type memoryRelatedList struct {
+	class    string
+	tenant   string
+	id       string
+	variant  string
+	related  []*RelatedChapter
+	chapters []string // the chapter of the list and the related ones
+	expires  time.Time
+}
+
+func NewMemoryRelatedCacheStore() *MemoryRelatedCacheStore {
+	return &MemoryRelatedCacheStore{}
+}
+
+func (l memoryRelatedList) in(collection Collection) bool {
+	return l.class == collection.Class && l.tenant == collection.Tenant
+}
+
+func (c *MemoryRelatedCacheStore) Get(ctx context.Context, collection Collection, id string, filter *MetadataFilter, limit int) ([]*RelatedChapter, error) {
+	variant, err := relatedVariant(collection, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, list := range c.lists {
+		if list.in(collection) && list.id == id && list.variant == string(variant) && now.Before(list.expires) {
+			return slices.Clone(list.related), nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *MemoryRelatedCacheStore) Set(ctx context.Context, collection Collection, id string, filter *MetadataFilter, limit int, related []*RelatedChapter) error {
+	variant, err := relatedVariant(collection, filter, limit)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	chapters := []string{id}
+	for _, chapter := range related {
+		chapters = append(chapters, chapter.ID)
+	}
+	now := time.Now()
+	// the list is replaced and the expired ones are dropped
+	c.lists = slices.DeleteFunc(c.lists, func(list memoryRelatedList) bool {
+		return (list.in(collection) && list.id == id && list.variant == string(variant)) || !now.Before(list.expires)
+	})
+	c.lists = append(c.lists, memoryRelatedList{
+		class:    collection.Class,
+		tenant:   collection.Tenant,
+		id:       id,
+		variant:  string(variant),
+		related:  slices.Clone(related),
+		chapters: chapters,
+		expires:  now.Add(relatedCacheTTL),
+	})
+	return nil
+}
+
+func (c *MemoryRelatedCacheStore) Invalidate(ctx context.Context, collection Collection, ids ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lists = slices.DeleteFunc(c.lists, func(list memoryRelatedList) bool {
+		return list.in(collection) && slices.ContainsFunc(list.chapters, func(chapter string) bool {
+			return slices.Contains(ids, chapter)
+		})
+	})
+	return nil
+}
+
+// InvalidateCollection drops the lists of every tenant of the class of the collection, like the redis store
+func (c *MemoryRelatedCacheStore) InvalidateCollection(ctx context.Context, collection Collection) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lists = slices.DeleteFunc(c.lists, func(list memoryRelatedList) bool {
+		return list.class == collection.Class
+	})
+	return nil
+}
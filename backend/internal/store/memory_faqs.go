@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryFAQsStore keeps the faq entries and the vectors of their questions in memory, for the memory backend
+type MemoryFAQsStore struct {
+	mu      sync.Mutex
+	lastID  int64
+	entries []*memoryFAQEntry // in creation order, like the ids of postgres
+}
+
+type memoryFAQEntry struct {
+	entry   FAQEntry
+	vectors [][]float32
+}
+
+func NewMemoryFAQsStore() *MemoryFAQsStore {
+	return &MemoryFAQsStore{}
+}
+
+func copyFAQEntry(entry *FAQEntry) *FAQEntry {
+	copied := *entry
+	copied.Questions = slices.Clone(entry.Questions)
+	copied.Links = slices.Clone(entry.Links)
+	return &copied
+}
+
+// find returns the entry of the knowledge base and tenant with the id, the lock must be held
+func (s *MemoryFAQsStore) find(knowledgeBase string, tenant string, id string) (int, error) {
+	for i, stored := range s.entries {
+		if stored.entry.KnowledgeBase == knowledgeBase && stored.entry.Tenant == tenant && stored.entry.ID == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("faq %s: %w", id, ErrNotFound)
+}
+
+func (s *MemoryFAQsStore) Create(ctx context.Context, entry *FAQEntry, vectors [][]float32) error {
+	if len(vectors) != len(entry.Questions) {
+		return fmt.Errorf("got %d vectors for the %d questions of faq %s", len(vectors), len(entry.Questions), entry.ID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	now := memoryTimestamp(time.Now())
+	entry.ID = strconv.FormatInt(s.lastID, 10)
+	entry.CreatedAt = now
+	entry.UpdatedAt = now
+	if entry.Links == nil {
+		entry.Links = []FAQLink{}
+	}
+	s.entries = append(s.entries, &memoryFAQEntry{entry: *copyFAQEntry(entry), vectors: slices.Clone(vectors)})
+	return nil
+}
+
+func (s *MemoryFAQsStore) GetByID(ctx context.Context, knowledgeBase string, tenant string, id string) (*FAQEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(knowledgeBase, tenant, id)
+	if err != nil {
+		return nil, err
+	}
+	return copyFAQEntry(&s.entries[i].entry), nil
+}
+
+func (s *MemoryFAQsStore) List(ctx context.Context, knowledgeBase string, tenant string) ([]*FAQEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := []*FAQEntry{}
+	for _, stored := range s.entries {
+		if stored.entry.KnowledgeBase == knowledgeBase && stored.entry.Tenant == tenant {
+			entries = append(entries, copyFAQEntry(&stored.entry))
+		}
+	}
+	return entries, nil
+}
+
+func (s *MemoryFAQsStore) Update(ctx context.Context, entry *FAQEntry, vectors [][]float32) error {
+	if len(vectors) != len(entry.Questions) {
+		return fmt.Errorf("got %d vectors for the %d questions of faq %s", len(vectors), len(entry.Questions), entry.ID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(entry.KnowledgeBase, entry.Tenant, entry.ID)
+	if err != nil {
+		return err
+	}
+	entry.CreatedAt = s.entries[i].entry.CreatedAt
+	entry.UpdatedAt = memoryTimestamp(time.Now())
+	if entry.Links == nil {
+		entry.Links = []FAQLink{}
+	}
+	s.entries[i] = &memoryFAQEntry{entry: *copyFAQEntry(entry), vectors: slices.Clone(vectors)}
+	return nil
+}
+
+func (s *MemoryFAQsStore) Delete(ctx context.Context, knowledgeBase string, tenant string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(knowledgeBase, tenant, id)
+	if err != nil {
+		return err
+	}
+	s.entries = slices.Delete(s.entries, i, i+1)
+	return nil
+}
+
+// Match compares the question with every variant, the variants embedded with other dimensions are ignored
+func (s *MemoryFAQsStore) Match(ctx context.Context, knowledgeBase string, tenant string, vector []float32, threshold float64) (*FAQMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var match *FAQMatch
+	for _, stored := range s.entries {
+		if stored.entry.KnowledgeBase != knowledgeBase || stored.entry.Tenant != tenant {
+			continue
+		}
+		for i, questionVector := range stored.vectors {
+			if len(questionVector) != len(vector) {
+				continue
+			}
+			similarity := 1 - cosineDistance(vector, questionVector)
+			if similarity < threshold || (match != nil && similarity <= match.Similarity) {
+				continue
+			}
+			match = &FAQMatch{Entry: &stored.entry, Question: stored.entry.Questions[i], Similarity: similarity}
+		}
+	}
+	if match == nil {
+		return nil, ErrNotFound
+	}
+	match.Entry = copyFAQEntry(match.Entry)
+	return match, nil
+}
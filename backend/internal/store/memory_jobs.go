@@ -0,0 +1,226 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryJobsStore keeps the ingestion jobs in memory, for the memory backend. The jobs are lost when the api stops,
+// there is only one instance so the leases only matter to the workers of that instance.
+type MemoryJobsStore struct {
+	mu            sync.Mutex
+	lastID        int64
+	lastChapterID int64
+	jobs          map[string]*memoryJob
+	order         []string // job ids in creation order, the oldest queued job is claimed first
+}
+
+type memoryJob struct {
+	job            IngestionJob
+	chapters       []IngestionJobChapter
+	leaseExpiresAt time.Time
+}
+
+func NewMemoryJobsStore() *MemoryJobsStore {
+	return &MemoryJobsStore{
+		jobs: make(map[string]*memoryJob),
+	}
+}
+
+func (s *MemoryJobsStore) Create(ctx context.Context, job *IngestionJob, documents []Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	now := memoryTimestamp(time.Now())
+	job.JobID = strconv.FormatInt(s.lastID, 10)
+	job.Status = JobStatusQueued
+	if job.DuplicatePolicy == "" {
+		job.DuplicatePolicy = DuplicateOff
+	}
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	job.TotalChapters = len(documents)
+
+	stored := &memoryJob{job: *job}
+	stored.job.UserRoles = slices.Clone(job.UserRoles)
+	stored.job.UserGroups = slices.Clone(job.UserGroups)
+	stored.job.Chapters = nil
+	for _, document := range documents {
+		s.lastChapterID++
+		stored.chapters = append(stored.chapters, IngestionJobChapter{
+			ID:       strconv.FormatInt(s.lastChapterID, 10),
+			Chapter:  document.Chapter,
+			Document: document,
+			Status:   JobChapterStatusPending,
+		})
+	}
+	s.jobs[job.JobID] = stored
+	s.order = append(s.order, job.JobID)
+	return nil
+}
+
+func (s *MemoryJobsStore) GetByID(ctx context.Context, jobID string) (*IngestionJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.jobs[jobID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	job := stored.job
+	job.Chapters = slices.Clone(stored.chapters)
+	job.TotalChapters = 0
+	for _, chapter := range job.Chapters {
+		job.TotalChapters++
+		switch chapter.Status {
+		case JobChapterStatusDone:
+			job.ProcessedChapters++
+		case JobChapterStatusFailed:
+			job.ProcessedChapters++
+			job.FailedChapters++
+		}
+	}
+	return &job, nil
+}
+
+func (s *MemoryJobsStore) ClaimNext(ctx context.Context, lease time.Duration) (*IngestionJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, jobID := range s.order {
+		stored := s.jobs[jobID]
+		if stored.job.Status != JobStatusQueued {
+			continue
+		}
+		now := time.Now()
+		stored.job.Status = JobStatusRunning
+		if stored.job.StartedAt == nil {
+			startedAt := memoryTimestamp(now)
+			stored.job.StartedAt = &startedAt
+		}
+		stored.job.UpdatedAt = memoryTimestamp(now)
+		stored.leaseExpiresAt = now.Add(lease)
+
+		job := stored.job
+		job.UserRoles = slices.Clone(stored.job.UserRoles)
+		job.UserGroups = slices.Clone(stored.job.UserGroups)
+		return &job, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryJobsStore) RenewLease(ctx context.Context, jobID string, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.jobs[jobID]
+	if !ok || stored.job.Status != JobStatusRunning {
+		return ErrNotFound
+	}
+	stored.leaseExpiresAt = time.Now().Add(lease)
+	return nil
+}
+
+func (s *MemoryJobsStore) Fail(ctx context.Context, jobID string, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.jobs[jobID]
+	if !ok {
+		return nil
+	}
+	s.finish(stored, JobStatusFailed)
+	stored.job.Error = reason
+	return nil
+}
+
+func (s *MemoryJobsStore) GetPendingChapters(ctx context.Context, jobID string) ([]IngestionJobChapter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.jobs[jobID]
+	if !ok {
+		return nil, nil
+	}
+	var chapters []IngestionJobChapter
+	for _, chapter := range stored.chapters {
+		if chapter.Status == JobChapterStatusPending {
+			chapters = append(chapters, chapter)
+		}
+	}
+	return chapters, nil
+}
+
+func (s *MemoryJobsStore) UpdateChapter(ctx context.Context, chapter *IngestionJobChapter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.jobs {
+		for i := range stored.chapters {
+			if stored.chapters[i].ID != chapter.ID {
+				continue
+			}
+			stored.chapters[i].Status = chapter.Status
+			stored.chapters[i].Attempts = chapter.Attempts
+			stored.chapters[i].Error = chapter.Error
+			stored.chapters[i].DuplicateOf = chapter.DuplicateOf
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *MemoryJobsStore) Finish(ctx context.Context, jobID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.jobs[jobID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	failed := 0
+	for _, chapter := range stored.chapters {
+		if chapter.Status == JobChapterStatusFailed {
+			failed++
+		}
+	}
+	switch {
+	case failed == 0:
+		s.finish(stored, JobStatusCompleted)
+	case failed == len(stored.chapters):
+		s.finish(stored, JobStatusFailed)
+	default:
+		s.finish(stored, JobStatusCompletedWithErrors)
+	}
+	return stored.job.Status, nil
+}
+
+// finish sets the final status of a job and drops its lease, the lock must be held
+func (s *MemoryJobsStore) finish(stored *memoryJob, status string) {
+	now := memoryTimestamp(time.Now())
+	stored.job.Status = status
+	stored.job.FinishedAt = &now
+	stored.job.UpdatedAt = now
+	stored.leaseExpiresAt = time.Time{}
+}
+
+func (s *MemoryJobsStore) RequeueExpired(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var requeued int64
+	now := time.Now()
+	for _, stored := range s.jobs {
+		if stored.job.Status == JobStatusRunning && stored.leaseExpiresAt.Before(now) {
+			stored.job.Status = JobStatusQueued
+			stored.job.UpdatedAt = memoryTimestamp(now)
+			stored.leaseExpiresAt = time.Time{}
+			requeued++
+		}
+	}
+	return requeued, nil
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryJobsStoreQueue(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryJobsStore()
+
+	first := &IngestionJob{UserID: "1", UserRoles: []string{"support"}, KnowledgeBase: "default"}
+	if err := s.Create(ctx, first, []Document{{Chapter: "Install"}, {Chapter: "Upgrade"}}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	second := &IngestionJob{UserID: "2", KnowledgeBase: "default"}
+	if err := s.Create(ctx, second, []Document{{Chapter: "Backup"}}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if first.Status != JobStatusQueued || first.DuplicatePolicy != DuplicateOff || first.TotalChapters != 2 {
+		t.Errorf("Create() job = %+v", first)
+	}
+
+	// the oldest job is claimed first, with the roles of the user who queued it
+	claimed, err := s.ClaimNext(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimNext() error = %v", err)
+	}
+	if claimed.JobID != first.JobID || claimed.Status != JobStatusRunning || claimed.Principal().Roles[0] != "support" {
+		t.Errorf("ClaimNext() = %+v, want job %s running", claimed, first.JobID)
+	}
+
+	chapters, err := s.GetPendingChapters(ctx, first.JobID)
+	if err != nil || len(chapters) != 2 {
+		t.Fatalf("GetPendingChapters() = %d chapters, error = %v", len(chapters), err)
+	}
+	chapters[0].Status = JobChapterStatusDone
+	chapters[1].Status = JobChapterStatusFailed
+	chapters[1].Attempts = 3
+	for i := range chapters {
+		if err := s.UpdateChapter(ctx, &chapters[i]); err != nil {
+			t.Fatalf("UpdateChapter() error = %v", err)
+		}
+	}
+	status, err := s.Finish(ctx, first.JobID)
+	if err != nil || status != JobStatusCompletedWithErrors {
+		t.Errorf("Finish() = %q, error = %v, want %q", status, err, JobStatusCompletedWithErrors)
+	}
+
+	job, err := s.GetByID(ctx, first.JobID)
+	if err != nil {
+		t.Fatalf("GetByID() error = %v", err)
+	}
+	if job.TotalChapters != 2 || job.ProcessedChapters != 2 || job.FailedChapters != 1 || job.FinishedAt == nil {
+		t.Errorf("GetByID() = %+v", job)
+	}
+	if err := s.RenewLease(ctx, first.JobID, time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RenewLease() of a finished job error = %v, want %v", err, ErrNotFound)
+	}
+
+	// a job whose lease expired goes back to the queue
+	if _, err := s.ClaimNext(ctx, -time.Second); err != nil {
+		t.Fatalf("ClaimNext() error = %v", err)
+	}
+	if requeued, err := s.RequeueExpired(ctx); err != nil || requeued != 1 {
+		t.Errorf("RequeueExpired() = %d, error = %v, want 1", requeued, err)
+	}
+	claimed, err = s.ClaimNext(ctx, time.Minute)
+	if err != nil || claimed.JobID != second.JobID {
+		t.Fatalf("ClaimNext() = %+v, error = %v, want job %s", claimed, err, second.JobID)
+	}
+	if _, err := s.ClaimNext(ctx, time.Minute); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ClaimNext() of an empty queue error = %v, want %v", err, ErrNotFound)
+	}
+}
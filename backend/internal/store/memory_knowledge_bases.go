@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryKnowledgeBasesStore keeps the knowledge bases in memory, it starts with the default knowledge base
+// like the migrations
+type MemoryKnowledgeBasesStore struct {
+	mu             sync.Mutex
+	lastID         int64
+	knowledgeBases map[string]*KnowledgeBase // by name
+}
+
+func NewMemoryKnowledgeBasesStore() *MemoryKnowledgeBasesStore {
+	s := &MemoryKnowledgeBasesStore{
+		knowledgeBases: make(map[string]*KnowledgeBase),
+	}
+	s.Create(context.Background(), &KnowledgeBase{
+		Name:        DefaultKnowledgeBaseName,
+		Description: "default knowledge base",
+		ClassName:   "Book",
+		Vectorizer:  DefaultVectorizer,
+	})
+	return s
+}
+
+func copyKnowledgeBase(kb *KnowledgeBase) *KnowledgeBase {
+	copied := *kb
+	copied.VectorizerConfig = maps.Clone(kb.VectorizerConfig)
+	return &copied
+}
+
+func (s *MemoryKnowledgeBasesStore) Create(ctx context.Context, kb *KnowledgeBase) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.knowledgeBases {
+		if existing.Name == kb.Name || existing.ClassName == kb.ClassName {
+			return ErrDuplicateKnowledgeBase
+		}
+	}
+
+	s.lastID++
+	now := memoryTimestamp(time.Now())
+	kb.ID = strconv.FormatInt(s.lastID, 10)
+	kb.CreatedAt = now
+	kb.UpdatedAt = now
+	if kb.VectorizerConfig == nil {
+		kb.VectorizerConfig = map[string]any{}
+	}
+	s.knowledgeBases[kb.Name] = copyKnowledgeBase(kb)
+	return nil
+}
+
+func (s *MemoryKnowledgeBasesStore) GetByName(ctx context.Context, name string) (*KnowledgeBase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kb, ok := s.knowledgeBases[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyKnowledgeBase(kb), nil
+}
+
+func (s *MemoryKnowledgeBasesStore) List(ctx context.Context) ([]*KnowledgeBase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kbs []*KnowledgeBase
+	for _, kb := range s.knowledgeBases {
+		kbs = append(kbs, copyKnowledgeBase(kb))
+	}
+	sort.Slice(kbs, func(i, j int) bool { return kbs[i].Name < kbs[j].Name })
+	return kbs, nil
+}
+
+func (s *MemoryKnowledgeBasesStore) Update(ctx context.Context, kb *KnowledgeBase) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.knowledgeBases {
+		if existing.ID == kb.ID {
+			existing.Description = kb.Description
+			existing.UpdatedAt = memoryTimestamp(time.Now())
+			kb.UpdatedAt = existing.UpdatedAt
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryKnowledgeBasesStore) Delete(ctx context.Context, kbID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maps.DeleteFunc(s.knowledgeBases, func(_ string, kb *KnowledgeBase) bool { return kb.ID == kbID })
+	return nil
+}
+
+// MemoryTenantsStore keeps the tenants in memory, for the memory backend
+type MemoryTenantsStore struct {
+	mu      sync.Mutex
+	lastID  int64
+	tenants map[string]*Tenant // by name
+}
+
+func NewMemoryTenantsStore() *MemoryTenantsStore {
+	return &MemoryTenantsStore{
+		tenants: make(map[string]*Tenant),
+	}
+}
+
+func copyTenant(tenant *Tenant) *Tenant {
+	copied := *tenant
+	copied.GapReportEmails = slices.Clone(tenant.GapReportEmails)
+	return &copied
+}
+
+func (s *MemoryTenantsStore) Create(ctx context.Context, tenant *Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenant.Name]; ok {
+		return ErrDuplicateTenant
+	}
+
+	s.lastID++
+	now := memoryTimestamp(time.Now())
+	tenant.ID = strconv.FormatInt(s.lastID, 10)
+	tenant.IsActive = true
+	if tenant.GapReportEmails == nil {
+		tenant.GapReportEmails = []string{}
+	}
+	tenant.CreatedAt = now
+	tenant.UpdatedAt = now
+	s.tenants[tenant.Name] = copyTenant(tenant)
+	return nil
+}
+
+func (s *MemoryTenantsStore) GetByName(ctx context.Context, name string) (*Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenant, ok := s.tenants[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyTenant(tenant), nil
+}
+
+func (s *MemoryTenantsStore) List(ctx context.Context) ([]*Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tenants []*Tenant
+	for _, tenant := range s.tenants {
+		tenants = append(tenants, copyTenant(tenant))
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return tenants, nil
+}
+
+func (s *MemoryTenantsStore) SetActive(ctx context.Context, tenant *Tenant) error {
+	return s.update(tenant, func(stored *Tenant) {
+		stored.IsActive = tenant.IsActive
+	})
+}
+
+func (s *MemoryTenantsStore) SetGapReportEmails(ctx context.Context, tenant *Tenant) error {
+	if tenant.GapReportEmails == nil {
+		tenant.GapReportEmails = []string{}
+	}
+	return s.update(tenant, func(stored *Tenant) {
+		stored.GapReportEmails = slices.Clone(tenant.GapReportEmails)
+	})
+}
+
+// update changes the stored tenant with the id of the tenant and sets its updated_at
+func (s *MemoryTenantsStore) update(tenant *Tenant, change func(*Tenant)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.tenants {
+		if stored.ID == tenant.ID {
+			change(stored)
+			stored.UpdatedAt = memoryTimestamp(time.Now())
+			tenant.UpdatedAt = stored.UpdatedAt
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryTenantsStore) Delete(ctx context.Context, tenantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maps.DeleteFunc(s.tenants, func(_ string, tenant *Tenant) bool { return tenant.ID == tenantID })
+	return nil
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/mik-dmi/rag_chatbot/backend/internal/embedding"
+)
+
+func TestMemoryVectorsStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	snapshot := filepath.Join(t.TempDir(), "vectors.json")
+	collection := Collection{Class: "Guide", Tenant: "acme"}
+
+	public := Document{
+		Chapter:     "Install",
+		Subsections: []Subsection{{Title: "Linux", Content: "download the installer and run the installer script"}},
+	}
+	restricted := Document{
+		Chapter:     "Passwords",
+		Subsections: []Subsection{{Title: "Reset", Content: "reset the admin password from the console"}},
+		Access:      &Access{Roles: []string{"support"}, Users: []string{"alice"}},
+	}
+
+	m, err := NewMemoryVectorsStore(ChunkingConfig{Size: 50}, RetrievalConfig{Limit: 5}, embedding.NewHashingEmbedder(256), snapshot)
+	if err != nil {
+		t.Fatalf("NewMemoryVectorsStore() error = %v", err)
+	}
+	if _, err := m.CreateVectors(ctx, collection, &RagData{Documents: []Document{public, restricted}}); err != nil {
+		t.Fatalf("CreateVectors() error = %v", err)
+	}
+	if _, err := m.CreateVectors(ctx, collection, &RagData{Documents: []Document{public}}); !errors.Is(err, ErrChapterAlreadyExists) {
+		t.Errorf("CreateVectors() of an existing chapter error = %v, want %v", err, ErrChapterAlreadyExists)
+	}
+
+	// the store is loaded again from its snapshot, the reads below check what was saved
+	m, err = NewMemoryVectorsStore(ChunkingConfig{Size: 50}, RetrievalConfig{Limit: 5}, embedding.NewHashingEmbedder(256), snapshot)
+	if err != nil {
+		t.Fatalf("NewMemoryVectorsStore() from snapshot error = %v", err)
+	}
+	restrictedID, err := m.GetObjectIDByChapter(ctx, collection, restricted.Chapter)
+	if err != nil {
+		t.Fatalf("GetObjectIDByChapter() error = %v", err)
+	}
+	got, err := m.GetObjectWithID(ctx, collection, restrictedID.Id)
+	if err != nil {
+		t.Fatalf("GetObjectWithID() error = %v", err)
+	}
+	if !reflect.DeepEqual(*got, restricted) {
+		t.Errorf("GetObjectWithID() = %+v, want %+v", *got, restricted)
+	}
+
+	tests := []struct {
+		name         string
+		reader       *Principal
+		wantVisible  bool
+		wantRetrieve []string
+	}{
+		{
+			name:         "no reader sees every chapter",
+			reader:       nil,
+			wantVisible:  true,
+			wantRetrieve: []string{"Install", "Passwords"},
+		},
+		{
+			name:         "a reader with an allowed role",
+			reader:       &Principal{UserID: "bob", Roles: []string{"support"}},
+			wantVisible:  true,
+			wantRetrieve: []string{"Install", "Passwords"},
+		},
+		{
+			name:         "an allowed user",
+			reader:       &Principal{UserID: "alice"},
+			wantVisible:  true,
+			wantRetrieve: []string{"Install", "Passwords"},
+		},
+		{
+			name:         "a reader without access",
+			reader:       &Principal{UserID: "bob", Roles: []string{"sales"}, Groups: []string{"support"}},
+			wantVisible:  false,
+			wantRetrieve: []string{"Install"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reading := collection
+			reading.Reader = tt.reader
+
+			_, err := m.GetObjectWithID(ctx, reading, restrictedID.Id)
+			if visible := err == nil; visible != tt.wantVisible {
+				t.Errorf("GetObjectWithID() error = %v, want visible %v", err, tt.wantVisible)
+			}
+			_, err = m.GetObjectIDByChapter(ctx, reading, restricted.Chapter)
+			if visible := err == nil; visible != tt.wantVisible {
+				t.Errorf("GetObjectIDByChapter() error = %v, want visible %v", err, tt.wantVisible)
+			}
+
+			var retrieved []string
+			for _, query := range []string{"run the installer script", "reset the admin password"} {
+				hits, err := m.GetClosestVectors(ctx, reading, query, nil)
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					t.Fatalf("GetClosestVectors(%q) error = %v", query, err)
+				}
+				for _, hit := range hits {
+					retrieved = append(retrieved, hit.Document.Chapter)
+				}
+			}
+			sort.Strings(retrieved)
+			if !reflect.DeepEqual(retrieved, tt.wantRetrieve) {
+				t.Errorf("GetClosestVectors() retrieved %q, want %q", retrieved, tt.wantRetrieve)
+			}
+		})
+	}
+
+	other := Collection{Class: "Guide", Tenant: "globex"}
+	if _, err := m.GetObjectWithID(ctx, other, restrictedID.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetObjectWithID() in another tenant error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestMemoryVectorsStoreListChapters(t *testing.T) {
+	ctx := context.Background()
+	collection := Collection{Class: "Guide", Tenant: "acme"}
+
+	m, err := NewMemoryVectorsStore(ChunkingConfig{Size: 50}, RetrievalConfig{Limit: 5}, embedding.NewHashingEmbedder(64), "")
+	if err != nil {
+		t.Fatalf("NewMemoryVectorsStore() error = %v", err)
+	}
+	var documents []Document
+	for _, chapter := range []string{"Upgrade", "Backup", "Install", "Restore", "Monitoring"} {
+		documents = append(documents, Document{Chapter: chapter, Subsections: []Subsection{{Title: chapter, Content: "steps"}}})
+	}
+	if _, err := m.CreateVectors(ctx, collection, &RagData{Documents: documents}); err != nil {
+		t.Fatalf("CreateVectors() error = %v", err)
+	}
+
+	// the pages resume after the last chapter of the previous one
+	var listed []string
+	query := ChapterListQuery{Limit: 2}
+	for {
+		page, err := m.ListChapters(ctx, collection, query)
+		if err != nil {
+			t.Fatalf("ListChapters() error = %v", err)
+		}
+		for _, chapter := range page.Chapters {
+			listed = append(listed, chapter.Chapter)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if want := []string{"Backup", "Install", "Monitoring", "Restore", "Upgrade"}; !reflect.DeepEqual(listed, want) {
+		t.Errorf("ListChapters() pages = %v, want %v", listed, want)
+	}
+
+	if _, err := m.ListChapters(ctx, collection, ChapterListQuery{Offset: 2}); !errors.Is(err, ErrCursorPaging) {
+		t.Errorf("ListChapters() with an offset error = %v, want %v", err, ErrCursorPaging)
+	}
+	if _, err := m.ListChapters(ctx, collection, ChapterListQuery{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("ListChapters() with an invalid cursor error = %v, want %v", err, ErrInvalidCursor)
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryUsersStore keeps the users and their invitations in memory, for the memory backend
+type MemoryUsersStore struct {
+	mu          sync.Mutex
+	lastID      int64
+	users       map[string]*PostgreUser
+	invitations map[string]memoryInvitation // by hashed token
+}
+
+type memoryInvitation struct {
+	userID string
+	expiry time.Time
+}
+
+func NewMemoryUsersStore() *MemoryUsersStore {
+	return &MemoryUsersStore{
+		users:       make(map[string]*PostgreUser),
+		invitations: make(map[string]memoryInvitation),
+	}
+}
+
+// memoryTimestamp formats the times of the memory stores like postgres returns them
+func memoryTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (s *MemoryUsersStore) GetUserById(ctx context.Context, userId string) (*PostgreUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+// CreateUser stores the user, there is no transaction in memory so tx is not used
+func (s *MemoryUsersStore) CreateUser(ctx context.Context, tx *sql.Tx, user *PostgreUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createUser(user)
+}
+
+// createUser checks the unique email and username like the constraints of the users table, the lock must be held
+func (s *MemoryUsersStore) createUser(user *PostgreUser) error {
+	for _, existing := range s.users {
+		// the emails are citext in postgres
+		if strings.EqualFold(existing.Email, user.Email) {
+			return ErrDuplicateEmail
+		}
+		if existing.Username == user.Username {
+			return ErrDuplicateUsername
+		}
+	}
+
+	s.lastID++
+	now := memoryTimestamp(time.Now())
+	user.UserID = strconv.FormatInt(s.lastID, 10)
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	stored := *user
+	s.users[user.UserID] = &stored
+	return nil
+}
+
+func (s *MemoryUsersStore) CreateAndInvite(ctx context.Context, user *PostgreUser, token string, invitationExp time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.createUser(user); err != nil {
+		return err
+	}
+	s.invitations[token] = memoryInvitation{userID: user.UserID, expiry: time.Now().Add(invitationExp)}
+	return nil
+}
+
+func (s *MemoryUsersStore) Activate(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := sha256.Sum256([]byte(token))
+	invitation, ok := s.invitations[hex.EncodeToString(hash[:])]
+	if !ok || !invitation.expiry.After(time.Now()) {
+		return ErrNotFound
+	}
+	user, ok := s.users[invitation.userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.ISActive = true
+	user.UpdatedAt = memoryTimestamp(time.Now())
+	s.deleteInvitations(user.UserID)
+	return nil
+}
+
+func (s *MemoryUsersStore) Delete(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, userID)
+	s.deleteInvitations(userID)
+	return nil
+}
+
+func (s *MemoryUsersStore) deleteInvitations(userID string) {
+	for token, invitation := range s.invitations {
+		if invitation.userID == userID {
+			delete(s.invitations, token)
+		}
+	}
+}
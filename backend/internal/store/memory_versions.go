@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryVersionsStore keeps the versions of the chapters in memory, for the memory backend
+type MemoryVersionsStore struct {
+	mu       sync.Mutex
+	lastID   int64
+	versions []*ChapterVersion // oldest first
+}
+
+func NewMemoryVersionsStore() *MemoryVersionsStore {
+	return &MemoryVersionsStore{}
+}
+
+func (s *MemoryVersionsStore) Create(ctx context.Context, version *ChapterVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest := 0
+	for _, stored := range s.versions {
+		if sameChapterVersions(stored, version.KnowledgeBase, version.Tenant, version.ObjectID) {
+			latest = max(latest, stored.Version)
+		}
+	}
+
+	s.lastID++
+	version.ID = strconv.FormatInt(s.lastID, 10)
+	version.Version = latest + 1
+	version.CreatedAt = memoryTimestamp(time.Now())
+	stored := *version
+	s.versions = append(s.versions, &stored)
+	return nil
+}
+
+func (s *MemoryVersionsStore) List(ctx context.Context, knowledgeBase string, tenant string, objectID string) ([]*ChapterVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var versions []*ChapterVersion
+	for i := len(s.versions) - 1; i >= 0; i-- {
+		if sameChapterVersions(s.versions[i], knowledgeBase, tenant, objectID) {
+			version := *s.versions[i]
+			versions = append(versions, &version)
+		}
+	}
+	return versions, nil
+}
+
+func (s *MemoryVersionsStore) GetByVersion(ctx context.Context, knowledgeBase string, tenant string, objectID string, number int) (*ChapterVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.versions {
+		if sameChapterVersions(stored, knowledgeBase, tenant, objectID) && stored.Version == number {
+			version := *stored
+			return &version, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func sameChapterVersions(version *ChapterVersion, knowledgeBase string, tenant string, objectID string) bool {
+	return version.KnowledgeBase == knowledgeBase && version.Tenant == tenant && version.ObjectID == objectID
+}
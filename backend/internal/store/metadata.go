@@ -0,0 +1,206 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/filters"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+)
+
+// Metadata describes what a document is about, so that a question can be answered only from
+// the documents of a product, version, language or audience. It is copied in every chunk.
+type Metadata struct {
+	Product  string   `json:"product,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	Language string   `json:"language,omitempty"`
+	Audience string   `json:"audience,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// metadataFields are the names of the metadata properties in weaviate, the same as the json fields
+var metadataFields = []string{"product", "version", "language", "audience", "tags"}
+
+func (m *Metadata) IsEmpty() bool {
+	return m == nil || (m.Product == "" && m.Version == "" && m.Language == "" && m.Audience == "" && len(m.Tags) == 0)
+}
+
+// setMetadataProperties adds the metadata to the properties of a weaviate object, the empty fields are left out
+func setMetadataProperties(properties map[string]interface{}, metadata *Metadata) {
+	if metadata == nil {
+		return
+	}
+	for field, value := range map[string]string{
+		"product":  metadata.Product,
+		"version":  metadata.Version,
+		"language": metadata.Language,
+		"audience": metadata.Audience,
+	} {
+		if value != "" {
+			properties[field] = value
+		}
+	}
+	if len(metadata.Tags) > 0 {
+		properties["tags"] = metadata.Tags
+	}
+}
+
+// metadataFromJSON reads the metadata properties of an object, nil when it has none
+func metadataFromJSON(data []byte) (*Metadata, error) {
+	metadata := &Metadata{}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, err
+	}
+	if metadata.IsEmpty() {
+		return nil, nil
+	}
+	return metadata, nil
+}
+
+func metadataGraphQLFields() []graphql.Field {
+	fields := make([]graphql.Field, 0, len(metadataFields))
+	for _, field := range metadataFields {
+		fields = append(fields, graphql.Field{Name: field})
+	}
+	return fields
+}
+
+// MetadataFilter restricts a retrieval to the documents matching every field that is set.
+// A field matches when the document has one of its values, * is a wildcard ("3.*").
+type MetadataFilter struct {
+	Product  []string `json:"product,omitempty"`
+	Version  []string `json:"version,omitempty"`
+	Language []string `json:"language,omitempty"`
+	Audience []string `json:"audience,omitempty"`
+	Tags     []string `json:"tags,omitempty"` // the document has at least one of the tags
+}
+
+func (f *MetadataFilter) IsEmpty() bool {
+	return f == nil || (len(f.Product) == 0 && len(f.Version) == 0 && len(f.Language) == 0 && len(f.Audience) == 0 && len(f.Tags) == 0)
+}
+
+type filteredField struct {
+	name   string
+	values []string
+}
+
+// scalarFields returns the filtered fields that have a single value in the documents
+func (f *MetadataFilter) scalarFields() []filteredField {
+	var fields []filteredField
+	for _, field := range []filteredField{
+		{"product", f.Product},
+		{"version", f.Version},
+		{"language", f.Language},
+		{"audience", f.Audience},
+	} {
+		if len(field.values) > 0 {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// where returns the weaviate filter of the metadata, nil when nothing is filtered
+func (f *MetadataFilter) where() *filters.WhereBuilder {
+	if f.IsEmpty() {
+		return nil
+	}
+
+	var operands []*filters.WhereBuilder
+	for _, field := range f.scalarFields() {
+		var valueOperands []*filters.WhereBuilder
+		for _, value := range field.values {
+			operator := filters.Equal
+			if strings.Contains(value, "*") {
+				operator = filters.Like
+			}
+			valueOperands = append(valueOperands, filters.Where().
+				WithPath([]string{field.name}).
+				WithOperator(operator).
+				WithValueText(value))
+		}
+		if len(valueOperands) == 1 {
+			operands = append(operands, valueOperands[0])
+		} else {
+			operands = append(operands, filters.Where().WithOperator(filters.Or).WithOperands(valueOperands))
+		}
+	}
+	if len(f.Tags) > 0 {
+		operands = append(operands, filters.Where().
+			WithPath([]string{"tags"}).
+			WithOperator(filters.ContainsAny).
+			WithValueText(f.Tags...))
+	}
+
+	if len(operands) == 1 {
+		return operands[0]
+	}
+	return filters.Where().WithOperator(filters.And).WithOperands(operands)
+}
+
+// sqlWhere returns the conditions of the filter on a metadata jsonb column, with their arguments
+// numbered after the ones already in args
+func (f *MetadataFilter) sqlWhere(column string, args []any) (string, []any) {
+	if f.IsEmpty() {
+		return "", args
+	}
+
+	var conditions []string
+	for _, field := range f.scalarFields() {
+		patterns := make([]string, 0, len(field.values))
+		for _, value := range field.values {
+			patterns = append(patterns, strings.ReplaceAll(escapeLike(value), "*", "%"))
+		}
+		args = append(args, pq.Array(patterns))
+		conditions = append(conditions, fmt.Sprintf("%s->>'%s' LIKE ANY($%d)", column, field.name, len(args)))
+	}
+	if len(f.Tags) > 0 {
+		args = append(args, pq.Array(f.Tags))
+		conditions = append(conditions, fmt.Sprintf("%s->'tags' ?| $%d", column, len(args)))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// matches tells if the metadata of a document match the filter, for the stores without a query language
+func (f *MetadataFilter) matches(metadata *Metadata) bool {
+	if f.IsEmpty() {
+		return true
+	}
+	if metadata == nil {
+		metadata = &Metadata{}
+	}
+
+	values := map[string]string{
+		"product":  metadata.Product,
+		"version":  metadata.Version,
+		"language": metadata.Language,
+		"audience": metadata.Audience,
+	}
+	for _, field := range f.scalarFields() {
+		if !slices.ContainsFunc(field.values, func(pattern string) bool { return wildcardMatch(pattern, values[field.name]) }) {
+			return false
+		}
+	}
+	if len(f.Tags) > 0 && !slices.ContainsFunc(f.Tags, func(tag string) bool { return slices.Contains(metadata.Tags, tag) }) {
+		return false
+	}
+	return true
+}
+
+// escapeLike escapes the characters of a value that are wildcards in a sql LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+func wildcardMatch(pattern string, value string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == value
+	}
+	expression := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	matched, _ := regexp.MatchString(expression, value)
+	return matched
+}
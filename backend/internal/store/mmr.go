@@ -0,0 +1,62 @@
+package store
+
+// RetrievalConfig sets how the chunks of the context of an answer are picked: Candidates chunks closest to the
+// question are fetched and Limit of them are kept with maximal marginal relevance, so that the context is not
+// made of several slices of the same subsection when another chapter also answers the question.
+type RetrievalConfig struct {
+	Limit      int
+	Candidates int
+	MMRLambda  float64 // weight of the relevance against the diversity, 1 keeps the closest chunks
+}
+
+func (c RetrievalConfig) normalized() RetrievalConfig {
+	if c.Limit <= 0 {
+		c.Limit = 5
+	}
+	if c.Candidates < c.Limit {
+		c.Candidates = c.Limit * 4
+	}
+	c.MMRLambda = min(max(c.MMRLambda, 0), 1)
+	return c
+}
+
+// diversify picks the chunks of the context among the candidates, closest first. Every pick is the candidate with the
+// best lambda * score of the chunk - (1 - lambda) * highest similarity to the chunks already picked.
+// The vectors are the ones of the candidates, a candidate without vector is only ranked on its relevance.
+func (c RetrievalConfig) diversify(candidates []Chunk, vectors [][]float32) []Chunk {
+	c = c.normalized()
+	if c.MMRLambda == 1 {
+		return candidates[:min(len(candidates), c.Limit)]
+	}
+
+	picked := make([]Chunk, 0, c.Limit)
+	var pickedVectors [][]float32
+	used := make([]bool, len(candidates))
+	for len(picked) < c.Limit && len(picked) < len(candidates) {
+		best, bestScore := -1, 0.0
+		for i, candidate := range candidates {
+			if used[i] {
+				continue
+			}
+			redundancy := 0.0
+			if i < len(vectors) && len(vectors[i]) > 0 {
+				for _, vector := range pickedVectors {
+					if len(vector) == len(vectors[i]) {
+						redundancy = max(redundancy, 1-cosineDistance(vectors[i], vector))
+					}
+				}
+			}
+			score := c.MMRLambda*candidate.Score - (1-c.MMRLambda)*redundancy
+			if best == -1 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		used[best] = true
+		picked = append(picked, candidates[best])
+		if best < len(vectors) && len(vectors[best]) > 0 {
+			pickedVectors = append(pickedVectors, vectors[best])
+		}
+	}
+	return picked
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiversify(t *testing.T) {
+	candidates := []Chunk{
+		{Content: "install", Score: 0.9},
+		{Content: "install again", Score: 0.85},
+		{Content: "upgrade", Score: 0.7},
+	}
+	// the second candidate is a copy of the first one, the third one points elsewhere
+	vectors := [][]float32{{1, 0}, {1, 0}, {0, 1}}
+
+	tests := []struct {
+		name       string
+		config     RetrievalConfig
+		candidates []Chunk
+		vectors    [][]float32
+		want       []string
+	}{
+		{
+			name:       "lambda 1 keeps the closest chunks",
+			config:     RetrievalConfig{Limit: 2, Candidates: 3, MMRLambda: 1},
+			candidates: candidates,
+			vectors:    vectors,
+			want:       []string{"install", "install again"},
+		},
+		{
+			name:       "redundant chunks are skipped",
+			config:     RetrievalConfig{Limit: 2, Candidates: 3, MMRLambda: 0.5},
+			candidates: candidates,
+			vectors:    vectors,
+			want:       []string{"install", "upgrade"},
+		},
+		{
+			name:       "chunks without vector are ranked on their relevance",
+			config:     RetrievalConfig{Limit: 2, Candidates: 3, MMRLambda: 0.5},
+			candidates: candidates,
+			vectors:    nil,
+			want:       []string{"install", "install again"},
+		},
+		{
+			name:       "fewer candidates than the limit",
+			config:     RetrievalConfig{Limit: 5, Candidates: 5, MMRLambda: 0.5},
+			candidates: candidates[:2],
+			vectors:    vectors[:2],
+			want:       []string{"install", "install again"},
+		},
+		{
+			name:       "no candidates",
+			config:     RetrievalConfig{Limit: 2, MMRLambda: 0.5},
+			candidates: nil,
+			vectors:    nil,
+			want:       []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, chunk := range tt.config.diversify(tt.candidates, tt.vectors) {
+				got = append(got, chunk.Content)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diversify() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
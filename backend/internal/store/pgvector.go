@@ -0,0 +1,1262 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/embedding"
+)
+
+// PgVectorsStore keeps the chapters and chunks in postgres with the pgvector extension,
+// for the deployments without weaviate. The vectors always come from the app embedder.
+type PgVectorsStore struct {
+	client    *sql.DB
+	chunking  ChunkingConfig
+	retrieval RetrievalConfig
+	embedder  embedding.Embedder
+}
+
+func (p *PgVectorsStore) CreateVectors(ctx context.Context, collection Collection, data *RagData) (*VectorCreatedResponse, error) {
+	ctx, cancel := writeContext(ctx)
+	defer cancel()
+
+	var chaptersCreated []string
+	err := withTx(p.client, ctx, func(tx *sql.Tx) error {
+		for _, doc := range data.Documents {
+			// checked in the transaction, so that the chapters inserted before in the batch are seen
+			ok, err := chapterExistsIn(ctx, tx, collection, doc.Chapter)
+			if err != nil {
+				return fmt.Errorf("error checking if a chapter already exits in postgres: %w", err)
+			}
+			if ok {
+				return fmt.Errorf("error: chapter %s %w", doc.Chapter, ErrChapterAlreadyExists)
+			}
+
+			if err := p.insertChapter(ctx, tx, collection, uuid.New().String(), doc, nil); err != nil {
+				return err
+			}
+			chaptersCreated = append(chaptersCreated, doc.Chapter)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &VectorCreatedResponse{ChaptersCreated: chaptersCreated}, nil
+}
+
+func (p *PgVectorsStore) UpsertVectors(ctx context.Context, collection Collection, data *RagData, fullSync bool) (*UpsertReport, error) {
+	report := &UpsertReport{
+		Created:   []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+		Deleted:   []string{},
+	}
+
+	seen := make(map[string]bool, len(data.Documents))
+	for _, doc := range data.Documents {
+		if seen[doc.Chapter] {
+			return nil, fmt.Errorf("chapter %s: %w", doc.Chapter, ErrDuplicateChapter)
+		}
+		seen[doc.Chapter] = true
+	}
+
+	indexed, err := p.indexedChapters(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	err = withTx(p.client, ctx, func(tx *sql.Tx) error {
+		for _, doc := range data.Documents {
+			properties := chapterProperties(doc)
+
+			existing, ok := indexed[doc.Chapter]
+			switch {
+			case !ok:
+				if err := p.insertChapter(ctx, tx, collection, uuid.New().String(), doc, nil); err != nil {
+					return err
+				}
+				report.Created = append(report.Created, doc.Chapter)
+
+			case existing.ContentHash == properties["contentHash"]:
+				report.Unchanged = append(report.Unchanged, doc.Chapter)
+
+			default:
+				previous, err := p.GetObjectWithID(ctx, collection.unrestricted(), existing.ID)
+				if err != nil {
+					return err
+				}
+				changed := changedSubsections(existing.SubsectionHashes, properties["subsectionHashes"].([]string))
+				if err := p.updateChapter(ctx, tx, collection, existing.ID, doc, changed); err != nil {
+					return err
+				}
+				report.Updated = append(report.Updated, doc.Chapter)
+				report.Changes = append(report.Changes, ChapterChange{ID: existing.ID, Previous: *previous, Current: &doc})
+			}
+		}
+
+		if fullSync {
+			for chapter, existing := range indexed {
+				if seen[chapter] {
+					continue
+				}
+				previous, err := p.GetObjectWithID(ctx, collection.unrestricted(), existing.ID)
+				if err != nil {
+					return err
+				}
+				_, err = tx.ExecContext(ctx,
+					`DELETE FROM vector_chapters WHERE collection = $1 AND tenant = $2 AND id = $3`,
+					collection.Class, collection.Tenant, existing.ID,
+				)
+				if err != nil {
+					return err
+				}
+				report.Deleted = append(report.Deleted, chapter)
+				report.Changes = append(report.Changes, ChapterChange{ID: existing.ID, Previous: *previous})
+			}
+			sort.Strings(report.Deleted)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (p *PgVectorsStore) GetClosestVectors(ctx context.Context, collection Collection, query string, filter *MetadataFilter) ([]*RetrievalHit, error) {
+	maxDistance := 0.5 // same cosine distance threshold as the weaviate search
+
+	vector, err := p.embedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []any{collection.Class, collection.Tenant, vectorLiteral(vector), maxDistance}
+	where := "collection = $1 AND tenant = $2 AND vector <=> $3::vector < $4"
+	if conditions, filterArgs := filter.sqlWhere("metadata", args); conditions != "" {
+		where += " AND " + conditions
+		args = filterArgs
+	}
+	if conditions, accessArgs := accessSQLWhere(collection.Reader, args); conditions != "" {
+		where += " AND " + conditions
+		args = accessArgs
+	}
+	sqlQuery := `
+	SELECT chapter_id, chapter, title, content, subsection_index, chunk_index, source, pages, metadata, url, anchor, breadcrumb,
+		vector <=> $3::vector, vector::text
+	FROM vector_chunks
+	WHERE ` + where + `
+	ORDER BY vector <=> $3::vector
+	LIMIT ` + strconv.Itoa(p.retrieval.normalized().Candidates) + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.client.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []Chunk
+	var vectors [][]float32
+	for rows.Next() {
+		var chunk Chunk
+		var pages pq.Int64Array
+		var metadata []byte
+		var distance float64
+		var chunkVector string
+		if err := rows.Scan(
+			&chunk.ChapterID,
+			&chunk.Chapter,
+			&chunk.Title,
+			&chunk.Content,
+			&chunk.SubsectionIndex,
+			&chunk.ChunkIndex,
+			&chunk.Source,
+			&pages,
+			&metadata,
+			&chunk.URL,
+			&chunk.Anchor,
+			pq.Array(&chunk.Breadcrumb),
+			&distance,
+			&chunkVector,
+		); err != nil {
+			return nil, err
+		}
+		chunk.Metadata, err = metadataFromJSON(metadata)
+		if err != nil {
+			return nil, err
+		}
+		for _, page := range pages {
+			chunk.Pages = append(chunk.Pages, int(page))
+		}
+		parsed, err := parseVector(chunkVector)
+		if err != nil {
+			return nil, err
+		}
+		chunk.setDistance(distance)
+		chunks = append(chunks, chunk)
+		vectors = append(vectors, parsed)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return p.chunking.chunksToHits(p.retrieval.diversify(chunks, vectors)), nil
+}
+
+// false = chapter not found / true = chapter found
+func (p *PgVectorsStore) chapterExists(ctx context.Context, collection Collection, chapter string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return chapterExistsIn(ctx, p.client, collection, chapter)
+}
+
+// rowQuerier is a *sql.DB or a *sql.Tx
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func chapterExistsIn(ctx context.Context, q rowQuerier, collection Collection, chapter string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM vector_chapters WHERE collection = $1 AND tenant = $2 AND chapter = $3)`
+
+	var exists bool
+	err := q.QueryRowContext(ctx, query, collection.Class, collection.Tenant, chapter).Scan(&exists)
+	return exists, err
+}
+
+func (p *PgVectorsStore) GetObjectIDByChapter(ctx context.Context, collection Collection, chapter string) (*IDResponse, error) {
+	query := `SELECT id FROM vector_chapters WHERE collection = $1 AND tenant = $2 AND chapter = $3`
+	args := []any{collection.Class, collection.Tenant, chapter}
+	if conditions, accessArgs := accessSQLWhere(collection.Reader, args); conditions != "" {
+		query += " AND " + conditions
+		args = accessArgs
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var id string
+	err := p.client.QueryRowContext(ctx, query, args...).Scan(&id)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, fmt.Errorf("no object found for chapter %s: %w", chapter, ErrNotFound)
+		default:
+			return nil, fmt.Errorf("failed to get object by chapter %s: %w", chapter, err)
+		}
+	}
+	return &IDResponse{Id: id}, nil
+}
+
+func (p *PgVectorsStore) GetObjectWithID(ctx context.Context, collection Collection, id string) (*Document, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("object with id %s: %w", id, ErrNotFound)
+	}
+
+	query := `
+	SELECT chapter, subsections, source, metadata, acl_principals, url, breadcrumb
+	FROM vector_chapters WHERE collection = $1 AND tenant = $2 AND id = $3
+	`
+	args := []any{collection.Class, collection.Tenant, id}
+	// a document the reader can not access is reported as not found, so that its existence is not leaked
+	if conditions, accessArgs := accessSQLWhere(collection.Reader, args); conditions != "" {
+		query += " AND " + conditions
+		args = accessArgs
+	}
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	document := &Document{}
+	var subsections, metadata []byte
+	var principals []string
+	err := p.client.QueryRowContext(ctx, query, args...).Scan(
+		&document.Chapter,
+		&subsections,
+		&document.Source,
+		&metadata,
+		pq.Array(&principals),
+		&document.URL,
+		pq.Array(&document.Breadcrumb),
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, fmt.Errorf("object with id %s: %w", id, ErrNotFound)
+		default:
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(subsections, &document.Subsections); err != nil {
+		return nil, err
+	}
+	document.Metadata, err = metadataFromJSON(metadata)
+	if err != nil {
+		return nil, err
+	}
+	document.Access = accessFromPrincipals(principals)
+	return document, nil
+}
+
+func (p *PgVectorsStore) DeleteChapterWithChapterName(ctx context.Context, collection Collection, chapterName string) (*SuccessfullyAPIOperation, error) {
+	query := `DELETE FROM vector_chapters WHERE collection = $1 AND tenant = $2 AND chapter = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := p.client.ExecContext(ctx, query, collection.Class, collection.Tenant, chapterName)
+	if err != nil {
+		return nil, err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return nil, fmt.Errorf("error can not delete chapter, chapter %s does not exits: %w", chapterName, ErrNotFound)
+	}
+	return &SuccessfullyAPIOperation{Message: "Chapter deleted successfully"}, nil
+}
+
+func (p *PgVectorsStore) DeleteObjectWithID(ctx context.Context, collection Collection, idToDelete string) (*SuccessfullyAPIOperation, error) {
+	if _, err := uuid.Parse(idToDelete); err != nil {
+		return nil, fmt.Errorf("object with id %s: %w", idToDelete, ErrNotFound)
+	}
+
+	// the chunks are deleted by the foreign key
+	query := `DELETE FROM vector_chapters WHERE collection = $1 AND tenant = $2 AND id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	result, err := p.client.ExecContext(ctx, query, collection.Class, collection.Tenant, idToDelete)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting object with id %s: %w", idToDelete, err)
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return nil, fmt.Errorf("object with id %s does not exist: %w", idToDelete, ErrNotFound)
+	}
+	return &SuccessfullyAPIOperation{Message: "Object deleted successfully "}, nil
+}
+
+func (p *PgVectorsStore) UpdateObjectWithID(ctx context.Context, collection Collection, updatedDocuments Document, idToUpdate string) (*SuccessfullyAPIOperation, error) {
+	if _, err := uuid.Parse(idToUpdate); err != nil {
+		return nil, fmt.Errorf("error updating object with id %s, it does not exist: %w", idToUpdate, ErrNotFound)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := withTx(p.client, ctx, func(tx *sql.Tx) error {
+		// every subsection is chunked again
+		changed := make(map[int]bool)
+		for i := range updatedDocuments.Subsections {
+			changed[i] = true
+		}
+		return p.updateChapter(ctx, tx, collection, idToUpdate, updatedDocuments, changed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SuccessfullyAPIOperation{Message: "Object updated successfully"}, nil
+}
+
+func (p *PgVectorsStore) ExportObjects(ctx context.Context, collection Collection, withVectors bool, fn func(*ExportedObject) error) error {
+	after := uuid.Nil.String()
+	for {
+		objects, err := p.exportPage(ctx, collection, after, withVectors)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+		if len(objects) < exportPageSize {
+			return nil
+		}
+		after = objects[len(objects)-1].ID
+	}
+}
+
+func (p *PgVectorsStore) exportPage(ctx context.Context, collection Collection, after string, withVectors bool) ([]*ExportedObject, error) {
+	// the times are unix milliseconds like in the weaviate exports
+	query := `
+	SELECT id, chapter, subsections, source, metadata, acl_principals, url, breadcrumb,
+		(EXTRACT(EPOCH FROM created_at) * 1000)::bigint::text,
+		(EXTRACT(EPOCH FROM updated_at) * 1000)::bigint::text,
+		CASE WHEN $4 THEN vector::text ELSE '' END
+	FROM vector_chapters
+	WHERE collection = $1 AND tenant = $2 AND id > $3`
+	args := []any{collection.Class, collection.Tenant, after, withVectors}
+	if conditions, accessArgs := accessSQLWhere(collection.Reader, args); conditions != "" {
+		query += " AND " + conditions
+		args = accessArgs
+	}
+	args = append(args, exportPageSize)
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d", len(args))
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.client.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []*ExportedObject
+	for rows.Next() {
+		obj := &ExportedObject{}
+		var subsections, metadata []byte
+		var principals []string
+		var vector string
+		if err := rows.Scan(
+			&obj.ID,
+			&obj.Chapter,
+			&subsections,
+			&obj.Source,
+			&metadata,
+			pq.Array(&principals),
+			&obj.URL,
+			pq.Array(&obj.Breadcrumb),
+			&obj.CreatedAt,
+			&obj.UpdatedAt,
+			&vector,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(subsections, &obj.Subsections); err != nil {
+			return nil, err
+		}
+		obj.Metadata, err = metadataFromJSON(metadata)
+		if err != nil {
+			return nil, err
+		}
+		obj.Access = accessFromPrincipals(principals)
+		if vector != "" {
+			obj.Vector, err = parseVector(vector)
+			if err != nil {
+				return nil, err
+			}
+		}
+		objects = append(objects, obj)
+	}
+	return objects, rows.Err()
+}
+
+func (p *PgVectorsStore) ImportObjects(ctx context.Context, collection Collection, objects []ExportedObject, policy ConflictPolicy) (*ImportReport, error) {
+	report := &ImportReport{}
+
+	err := withTx(p.client, ctx, func(tx *sql.Tx) error {
+		for i := range objects {
+			if objects[i].ID == "" {
+				objects[i].ID = uuid.New().String()
+			}
+			if _, err := uuid.Parse(objects[i].ID); err != nil {
+				return fmt.Errorf("object %q of chapter %s: %w", objects[i].ID, objects[i].Chapter, ErrInvalidImportLine)
+			}
+		}
+
+		conflicts := make([][]string, len(objects))
+		for i, obj := range objects {
+			rows, err := tx.QueryContext(ctx,
+				`SELECT id FROM vector_chapters WHERE collection = $1 AND tenant = $2 AND (id = $3 OR chapter = $4)`,
+				collection.Class, collection.Tenant, obj.ID, obj.Chapter,
+			)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				var id string
+				if err := rows.Scan(&id); err != nil {
+					rows.Close()
+					return err
+				}
+				conflicts[i] = append(conflicts[i], id)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			if len(conflicts[i]) > 0 && policy == ConflictFail {
+				return fmt.Errorf("chapter %s (%s): %w", obj.Chapter, obj.ID, ErrImportConflict)
+			}
+		}
+
+		for i, obj := range objects {
+			if len(conflicts[i]) > 0 {
+				if policy == ConflictSkip {
+					report.Skipped++
+					continue
+				}
+				for _, id := range conflicts[i] {
+					previous, err := p.GetObjectWithID(ctx, collection.unrestricted(), id)
+					if err != nil {
+						return err
+					}
+					report.Changes = append(report.Changes, overwriteChange(id, *previous, obj))
+				}
+				_, err := tx.ExecContext(ctx,
+					`DELETE FROM vector_chapters WHERE collection = $1 AND tenant = $2 AND id = ANY($3)`,
+					collection.Class, collection.Tenant, pq.Array(conflicts[i]),
+				)
+				if err != nil {
+					return err
+				}
+				report.Overwritten++
+			} else {
+				report.Imported++
+			}
+
+			if err := p.insertChapter(ctx, tx, collection, obj.ID, obj.Document, obj.Vector); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// the tables are shared by every knowledge base, the rows of a knowledge base have its class name as collection
+// ListChapters returns a page of the chapters the reader can access, resuming after the sort value and id of the cursor
+func (p *PgVectorsStore) ListChapters(ctx context.Context, collection Collection, query ChapterListQuery) (*ChapterPage, error) {
+	query, err := query.keysetNormalized()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := decodeChapterCursor(query.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	column := map[string]string{
+		ChapterSortName:    "chapter",
+		ChapterSortCreated: "created_at",
+		ChapterSortUpdated: "updated_at",
+	}[query.Sort]
+	comparison, direction := ">", "ASC"
+	if query.Descending {
+		comparison, direction = "<", "DESC"
+	}
+
+	args := []any{collection.Class, collection.Tenant}
+	where := "collection = $1 AND tenant = $2"
+	if conditions, filterArgs := query.Filter.sqlWhere("metadata", args); conditions != "" {
+		where += " AND " + conditions
+		args = filterArgs
+	}
+	if conditions, accessArgs := accessSQLWhere(collection.Reader, args); conditions != "" {
+		where += " AND " + conditions
+		args = accessArgs
+	}
+	if cursor != nil {
+		args = append(args, cursor.Value, cursor.ID)
+		// the times of the cursors are unix milliseconds
+		value := fmt.Sprintf("$%d", len(args)-1)
+		if column != "chapter" {
+			value = fmt.Sprintf("to_timestamp($%d::bigint / 1000.0)", len(args)-1)
+		}
+		where += fmt.Sprintf(" AND (%s, id) %s (%s, $%d::uuid)", column, comparison, value, len(args))
+	}
+	args = append(args, query.Limit+1)
+
+	// one more chapter than the page tells if there is a next page
+	sqlQuery := fmt.Sprintf(`
+	SELECT id, chapter, ARRAY(SELECT s->>'title' FROM jsonb_array_elements(subsections) s), source, url, metadata,
+		(EXTRACT(EPOCH FROM created_at) * 1000)::bigint::text,
+		(EXTRACT(EPOCH FROM updated_at) * 1000)::bigint::text
+	FROM vector_chapters
+	WHERE %s
+	ORDER BY %s %s, id %s
+	LIMIT $%d
+	`, where, column, direction, direction, len(args))
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.client.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &ChapterPage{Chapters: []*ChapterSummary{}}
+	for rows.Next() {
+		summary := &ChapterSummary{}
+		var metadata []byte
+		if err := rows.Scan(
+			&summary.ID,
+			&summary.Chapter,
+			pq.Array(&summary.Titles),
+			&summary.Source,
+			&summary.URL,
+			&metadata,
+			&summary.CreatedAt,
+			&summary.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		summary.Metadata, err = metadataFromJSON(metadata)
+		if err != nil {
+			return nil, err
+		}
+		page.Chapters = append(page.Chapters, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Chapters) > query.Limit {
+		page.Chapters = page.Chapters[:query.Limit]
+		last := page.Chapters[query.Limit-1]
+		next := chapterCursor{Value: last.Chapter, ID: last.ID}
+		switch query.Sort {
+		case ChapterSortCreated:
+			next.Value = last.CreatedAt
+		case ChapterSortUpdated:
+			next.Value = last.UpdatedAt
+		}
+		page.NextCursor = next.encode()
+	}
+	return page, nil
+}
+
+// SearchTitles returns the chapters and subsections whose titles contain every keyword
+func (p *PgVectorsStore) SearchTitles(ctx context.Context, collection Collection, keywords string, limit int) ([]*TitleMatch, error) {
+	if limit <= 0 || limit > MaxChapterPageSize {
+		limit = DefaultChapterPageSize
+	}
+	var patterns []string
+	for _, keyword := range strings.Fields(keywords) {
+		patterns = append(patterns, "%"+escapeLike(keyword)+"%")
+	}
+	if len(patterns) == 0 {
+		return []*TitleMatch{}, nil
+	}
+
+	args := []any{collection.Class, collection.Tenant, pq.Array(patterns)}
+	where := "collection = $1 AND tenant = $2 AND (title || ' ' || chapter) ILIKE ALL($3)"
+	if conditions, accessArgs := accessSQLWhere(collection.Reader, args); conditions != "" {
+		where += " AND " + conditions
+		args = accessArgs
+	}
+	args = append(args, limit)
+	sqlQuery := fmt.Sprintf(`
+	SELECT chapter_id, chapter, title, subsection_index, url, anchor FROM (
+		SELECT DISTINCT ON (chapter_id, subsection_index) chapter_id, chapter, title, subsection_index, url, anchor
+		FROM vector_chunks
+		WHERE %s
+		ORDER BY chapter_id, subsection_index
+	) matches
+	ORDER BY chapter, subsection_index
+	LIMIT $%d
+	`, where, len(args))
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.client.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []*TitleMatch{}
+	for rows.Next() {
+		match := &TitleMatch{}
+		var url, anchor string
+		if err := rows.Scan(&match.ID, &match.Chapter, &match.Title, &match.SubsectionIndex, &url, &anchor); err != nil {
+			return nil, err
+		}
+		match.URL = deepLink(url, anchor)
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
+
+// CountFacets counts the chapters the reader can access for every value of the metadata fields
+func (p *PgVectorsStore) CountFacets(ctx context.Context, collection Collection) (*MetadataFacets, error) {
+	args := []any{collection.Class, collection.Tenant}
+	where := "collection = $1 AND tenant = $2"
+	if conditions, accessArgs := accessSQLWhere(collection.Reader, args); conditions != "" {
+		where += " AND " + conditions
+		args = accessArgs
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	facets := &MetadataFacets{Fields: make(map[string][]FacetCount, len(metadataFields))}
+	err := p.client.QueryRowContext(ctx, `SELECT count(*) FROM vector_chapters WHERE `+where, args...).Scan(&facets.Chapters)
+	if err != nil {
+		return nil, err
+	}
+
+	// the scalar fields are the text values of the metadata object and every tag counts on its own
+	sqlQuery := fmt.Sprintf(`
+	SELECT field, value, count(*) FROM (
+		SELECT key AS field, value FROM vector_chapters, jsonb_each_text(metadata) WHERE %s AND key <> 'tags'
+		UNION ALL
+		SELECT 'tags', tag FROM vector_chapters, jsonb_array_elements_text(metadata->'tags') tag WHERE %s
+	) facets
+	GROUP BY field, value
+	`, where, where)
+	rows, err := p.client.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]map[string]int)
+	for rows.Next() {
+		var field, value string
+		var count int
+		if err := rows.Scan(&field, &value, &count); err != nil {
+			return nil, err
+		}
+		if counts[field] == nil {
+			counts[field] = make(map[string]int)
+		}
+		counts[field][value] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, field := range metadataFields {
+		facets.Fields[field] = sortFacetCounts(counts[field])
+	}
+	return facets, nil
+}
+
+// FindDuplicates returns the chapters of the collection with the same text as the document,
+// or whose vector has a cosine similarity of at least threshold with it
+func (p *PgVectorsStore) FindDuplicates(ctx context.Context, collection Collection, doc Document, threshold float32) ([]DuplicateMatch, error) {
+	vectors, err := p.embedDocuments(ctx, []string{objectText(chapterProperties(doc))})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	SELECT id, chapter, text_hash = $3, 1 - (vector <=> $4::vector)
+	FROM vector_chapters
+	WHERE collection = $1 AND tenant = $2 AND ((text_hash = $3 AND $3 <> '') OR vector <=> $4::vector <= $5)`
+	args := []any{collection.Class, collection.Tenant, TextHash(doc), vectorLiteral(vectors[0]), 1 - threshold}
+	if conditions, accessArgs := accessSQLWhere(collection.Reader, args); conditions != "" {
+		query += " AND " + conditions
+		args = accessArgs
+	}
+	args = append(args, duplicateLimit)
+	query += fmt.Sprintf(" ORDER BY text_hash = $3 DESC, vector <=> $4::vector LIMIT $%d", len(args))
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.client.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := make(map[string]*DuplicateMatch)
+	for rows.Next() {
+		match := &DuplicateMatch{}
+		var similarity float64
+		if err := rows.Scan(&match.ID, &match.Chapter, &match.Exact, &similarity); err != nil {
+			return nil, err
+		}
+		match.Similarity = float32(similarity)
+		if match.Exact {
+			match.Similarity = 1
+		}
+		matches[match.ID] = match
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sortDuplicateMatches(matches), nil
+}
+
+// Search returns a page of the subsections matching the query, the keyword search is the full text search of postgres
+// and the hybrid one fuses the scores of both searches
+func (p *PgVectorsStore) Search(ctx context.Context, collection Collection, query SearchQuery) (*SearchPage, error) {
+	query, err := query.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []searchHit
+	switch query.Mode {
+	case SearchModeHybrid:
+		vectorHits, err := p.searchChunks(ctx, collection, query, SearchModeVector)
+		if err != nil {
+			return nil, err
+		}
+		keywordHits, err := p.searchChunks(ctx, collection, query, SearchModeKeyword)
+		if err != nil {
+			return nil, err
+		}
+		hits = fuseHits(vectorHits, keywordHits, hybridAlpha)
+	default:
+		hits, err = p.searchChunks(ctx, collection, query, query.Mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return query.page(hits), nil
+}
+
+func (p *PgVectorsStore) searchChunks(ctx context.Context, collection Collection, query SearchQuery, mode string) ([]searchHit, error) {
+	args := []any{collection.Class, collection.Tenant}
+	var score, condition string
+	if mode == SearchModeKeyword {
+		args = append(args, query.Query)
+		document := "to_tsvector('simple', chapter || ' ' || title || ' ' || content)"
+		score = "ts_rank(" + document + ", plainto_tsquery('simple', $3))"
+		condition = document + " @@ plainto_tsquery('simple', $3)"
+	} else {
+		vector, err := p.embedQuery(ctx, query.Query)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, vectorLiteral(vector), searchMaxDistance)
+		score = "1 - (vector <=> $3::vector)"
+		condition = "vector <=> $3::vector < $4"
+	}
+
+	where := "collection = $1 AND tenant = $2 AND " + condition
+	if conditions, filterArgs := query.Filter.sqlWhere("metadata", args); conditions != "" {
+		where += " AND " + conditions
+		args = filterArgs
+	}
+	if conditions, accessArgs := accessSQLWhere(collection.Reader, args); conditions != "" {
+		where += " AND " + conditions
+		args = accessArgs
+	}
+	args = append(args, query.window())
+	sqlQuery := fmt.Sprintf(`
+	SELECT chapter_id, chapter, title, content, subsection_index, chunk_index, source, pages, metadata, url, anchor, breadcrumb,
+		%s AS score
+	FROM vector_chunks
+	WHERE %s
+	ORDER BY score DESC
+	LIMIT $%d
+	`, score, where, len(args))
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.client.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []searchHit
+	for rows.Next() {
+		var hit searchHit
+		var pages pq.Int64Array
+		var metadata []byte
+		if err := rows.Scan(
+			&hit.chunk.ChapterID,
+			&hit.chunk.Chapter,
+			&hit.chunk.Title,
+			&hit.chunk.Content,
+			&hit.chunk.SubsectionIndex,
+			&hit.chunk.ChunkIndex,
+			&hit.chunk.Source,
+			&pages,
+			&metadata,
+			&hit.chunk.URL,
+			&hit.chunk.Anchor,
+			pq.Array(&hit.chunk.Breadcrumb),
+			&hit.score,
+		); err != nil {
+			return nil, err
+		}
+		hit.chunk.Metadata, err = metadataFromJSON(metadata)
+		if err != nil {
+			return nil, err
+		}
+		for _, page := range pages {
+			hit.chunk.Pages = append(hit.chunk.Pages, int(page))
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// RelatedChapters returns the chapters whose vectors are the closest to the one of the chapter with the id,
+// without the chapter itself
+func (p *PgVectorsStore) RelatedChapters(ctx context.Context, collection Collection, id string, filter *MetadataFilter, limit int) ([]*RelatedChapter, error) {
+	if _, err := p.GetObjectWithID(ctx, collection, id); err != nil {
+		return nil, err
+	}
+
+	args := []any{collection.Class, collection.Tenant, id}
+	where := "collection = $1 AND tenant = $2 AND id <> $3"
+	if conditions, filterArgs := filter.sqlWhere("metadata", args); conditions != "" {
+		where += " AND " + conditions
+		args = filterArgs
+	}
+	if conditions, accessArgs := accessSQLWhere(collection.Reader, args); conditions != "" {
+		where += " AND " + conditions
+		args = accessArgs
+	}
+	args = append(args, relatedLimit(limit))
+	query := fmt.Sprintf(`
+	SELECT id, chapter, source, url, breadcrumb, metadata,
+		1 - (vector <=> (SELECT vector FROM vector_chapters WHERE collection = $1 AND tenant = $2 AND id = $3)) AS similarity
+	FROM vector_chapters
+	WHERE %s
+	ORDER BY similarity DESC
+	LIMIT $%d
+	`, where, len(args))
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.client.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	related := []*RelatedChapter{}
+	for rows.Next() {
+		chapter := &RelatedChapter{}
+		var metadata []byte
+		if err := rows.Scan(
+			&chapter.ID,
+			&chapter.Chapter,
+			&chapter.Source,
+			&chapter.URL,
+			pq.Array(&chapter.Breadcrumb),
+			&metadata,
+			&chapter.Similarity,
+		); err != nil {
+			return nil, err
+		}
+		chapter.Metadata, err = metadataFromJSON(metadata)
+		if err != nil {
+			return nil, err
+		}
+		related = append(related, chapter)
+	}
+	return related, rows.Err()
+}
+
+func (p *PgVectorsStore) CreateCollection(ctx context.Context, kb *KnowledgeBase) error {
+	return nil
+}
+
+// the tables of the vectors are created by the sql migrations, there is nothing to diff
+func (p *PgVectorsStore) MigrateSchema(ctx context.Context, kb *KnowledgeBase, apply bool) (*SchemaPlan, error) {
+	return &SchemaPlan{
+		KnowledgeBase: kb.Name,
+		Additive:      []SchemaChange{},
+		Incompatible:  []SchemaChange{},
+		Applied:       apply,
+	}, nil
+}
+
+func (p *PgVectorsStore) DeleteCollection(ctx context.Context, collection Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := p.client.ExecContext(ctx, `DELETE FROM vector_chapters WHERE collection = $1`, collection.Class)
+	return err
+}
+
+// the rows of a tenant are created with its first chapter
+func (p *PgVectorsStore) CreateTenant(ctx context.Context, collection Collection) error {
+	return nil
+}
+
+// the requests of a deactivated organization are already refused before reaching the store
+func (p *PgVectorsStore) SetTenantActive(ctx context.Context, collection Collection, active bool) error {
+	return nil
+}
+
+func (p *PgVectorsStore) DeleteTenant(ctx context.Context, collection Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := p.client.ExecContext(ctx, `DELETE FROM vector_chapters WHERE collection = $1 AND tenant = $2`, collection.Class, collection.Tenant)
+	return err
+}
+
+// insertChapter stores a chapter with its chunks, the vector of the chapter is computed when it is nil
+func (p *PgVectorsStore) insertChapter(ctx context.Context, tx *sql.Tx, collection Collection, id string, doc Document, vector []float32) error {
+	properties := chapterProperties(doc)
+	chunks := p.chunking.chunkDocument(id, doc)
+
+	texts := make([]string, 0, len(chunks)+1)
+	texts = append(texts, objectText(properties))
+	for _, chunk := range chunks {
+		texts = append(texts, chunkText(chunk))
+	}
+	vectors, err := p.embedDocuments(ctx, texts)
+	if err != nil {
+		return err
+	}
+	if vector == nil {
+		vector = vectors[0]
+	}
+
+	subsections, err := subsectionsColumn(doc)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO vector_chapters (id, collection, tenant, chapter, subsections, source, content_hash, subsection_hashes, vector, metadata,
+		acl_restricted, acl_principals, url, breadcrumb, text_hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::vector, $10, $11, $12, $13, $14, $15)
+	`
+	_, err = tx.ExecContext(ctx, query,
+		id,
+		collection.Class,
+		collection.Tenant,
+		doc.Chapter,
+		subsections,
+		doc.Source,
+		properties["contentHash"],
+		pq.Array(properties["subsectionHashes"]),
+		vectorLiteral(vector),
+		metadataColumn(doc.Metadata),
+		doc.Access.IsRestricted(),
+		pq.Array(doc.Access.principals()),
+		doc.URL,
+		pq.Array(breadcrumbColumn(doc.Breadcrumb)),
+		properties["textHash"],
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting chapter %s: %w", doc.Chapter, err)
+	}
+
+	return p.insertChunks(ctx, tx, collection, chunks, vectors[1:])
+}
+
+// updateChapter replaces the text and vector of a chapter and indexes again the chunks of the changed subsections
+func (p *PgVectorsStore) updateChapter(ctx context.Context, tx *sql.Tx, collection Collection, id string, doc Document, changed map[int]bool) error {
+	properties := chapterProperties(doc)
+
+	var chunks []Chunk
+	for _, chunk := range p.chunking.chunkDocument(id, doc) {
+		if changed[chunk.SubsectionIndex] {
+			chunks = append(chunks, chunk)
+		}
+	}
+	texts := make([]string, 0, len(chunks)+1)
+	texts = append(texts, objectText(properties))
+	for _, chunk := range chunks {
+		texts = append(texts, chunkText(chunk))
+	}
+	vectors, err := p.embedDocuments(ctx, texts)
+	if err != nil {
+		return err
+	}
+
+	subsections, err := subsectionsColumn(doc)
+	if err != nil {
+		return err
+	}
+	query := `
+	UPDATE vector_chapters
+	SET chapter = $1, subsections = $2, source = $3, content_hash = $4, subsection_hashes = $5, vector = $6::vector,
+		metadata = $10, acl_restricted = $11, acl_principals = $12, url = $13, breadcrumb = $14, text_hash = $15, updated_at = NOW()
+	WHERE collection = $7 AND tenant = $8 AND id = $9
+	`
+	result, err := tx.ExecContext(ctx, query,
+		doc.Chapter,
+		subsections,
+		doc.Source,
+		properties["contentHash"],
+		pq.Array(properties["subsectionHashes"]),
+		vectorLiteral(vectors[0]),
+		collection.Class,
+		collection.Tenant,
+		id,
+		metadataColumn(doc.Metadata),
+		doc.Access.IsRestricted(),
+		pq.Array(doc.Access.principals()),
+		doc.URL,
+		pq.Array(breadcrumbColumn(doc.Breadcrumb)),
+		properties["textHash"],
+	)
+	if err != nil {
+		return fmt.Errorf("error updating object with id %s: %w", id, err)
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return fmt.Errorf("error updating object with id %s, it does not exist: %w", id, ErrNotFound)
+	}
+
+	indexes := make([]int64, 0, len(changed))
+	for i := range changed {
+		indexes = append(indexes, int64(i))
+	}
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM vector_chunks WHERE collection = $1 AND tenant = $2 AND chapter_id = $3 AND subsection_index = ANY($4)`,
+		collection.Class, collection.Tenant, id, pq.Array(indexes),
+	)
+	if err != nil {
+		return fmt.Errorf("error deleting chunks of object with id %s: %w", id, err)
+	}
+
+	return p.insertChunks(ctx, tx, collection, chunks, vectors[1:])
+}
+
+func (p *PgVectorsStore) insertChunks(ctx context.Context, tx *sql.Tx, collection Collection, chunks []Chunk, vectors [][]float32) error {
+	query := `
+	INSERT INTO vector_chunks (chapter_id, collection, tenant, chapter, title, content, subsection_index, chunk_index, source, pages, vector, metadata,
+		acl_restricted, acl_principals, url, anchor, breadcrumb)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11::vector, $12, $13, $14, $15, $16, $17)
+	`
+	for i, chunk := range chunks {
+		pages := make([]int64, 0, len(chunk.Pages))
+		for _, page := range chunk.Pages {
+			pages = append(pages, int64(page))
+		}
+		_, err := tx.ExecContext(ctx, query,
+			chunk.ChapterID,
+			collection.Class,
+			collection.Tenant,
+			chunk.Chapter,
+			chunk.Title,
+			chunk.Content,
+			chunk.SubsectionIndex,
+			chunk.ChunkIndex,
+			chunk.Source,
+			pq.Array(pages),
+			vectorLiteral(vectors[i]),
+			metadataColumn(chunk.Metadata),
+			chunk.Access.IsRestricted(),
+			pq.Array(chunk.Access.principals()),
+			chunk.URL,
+			chunk.Anchor,
+			pq.Array(breadcrumbColumn(chunk.Breadcrumb)),
+		)
+		if err != nil {
+			return fmt.Errorf("error inserting chunk of chapter %s: %w", chunk.Chapter, err)
+		}
+	}
+	return nil
+}
+
+func (p *PgVectorsStore) indexedChapters(ctx context.Context, collection Collection) (map[string]*indexedChapter, error) {
+	query := `
+	SELECT id, chapter, content_hash, subsection_hashes
+	FROM vector_chapters WHERE collection = $1 AND tenant = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.client.QueryContext(ctx, query, collection.Class, collection.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chapters := make(map[string]*indexedChapter)
+	for rows.Next() {
+		chapter := &indexedChapter{}
+		var name string
+		if err := rows.Scan(&chapter.ID, &name, &chapter.ContentHash, pq.Array(&chapter.SubsectionHashes)); err != nil {
+			return nil, err
+		}
+		chapters[name] = chapter
+	}
+	return chapters, rows.Err()
+}
+
+func (p *PgVectorsStore) embedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	if p.embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	vectors, err := p.embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+	return vectors, nil
+}
+
+func (p *PgVectorsStore) embedQuery(ctx context.Context, query string) ([]float32, error) {
+	if p.embedder == nil {
+		return nil, ErrNoEmbedder
+	}
+	return p.embedder.EmbedQuery(ctx, query)
+}
+
+// chunkText is the text embedded for a chunk, the same as objectText for a chunk object
+func chunkText(chunk Chunk) string {
+	return chunk.Chapter + "\n" + chunk.Title + "\n" + chunk.Content
+}
+
+// subsectionsColumn is the value of the subsections jsonb column, with their anchors
+func subsectionsColumn(doc Document) ([]byte, error) {
+	if doc.Subsections == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(doc.Subsections)
+}
+
+// breadcrumbColumn is the value of a breadcrumb column, that can not be null
+func breadcrumbColumn(breadcrumb []string) []string {
+	if breadcrumb == nil {
+		return []string{}
+	}
+	return breadcrumb
+}
+
+// metadataColumn is the value of a metadata jsonb column, the empty fields are left out
+func metadataColumn(metadata *Metadata) []byte {
+	if metadata.IsEmpty() {
+		return []byte("{}")
+	}
+	data, _ := json.Marshal(metadata)
+	return data
+}
+
+// vectorLiteral formats a vector as a pgvector value: [1,2,3]
+func vectorLiteral(vector []float32) string {
+	values := make([]string, 0, len(vector))
+	for _, value := range vector {
+		values = append(values, strconv.FormatFloat(float64(value), 'f', -1, 32))
+	}
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+func parseVector(literal string) ([]float32, error) {
+	literal = strings.Trim(literal, "[]")
+	if literal == "" {
+		return nil, nil
+	}
+	parts := strings.Split(literal, ",")
+	vector := make([]float32, 0, len(parts))
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return nil, errors.New("invalid vector in postgres: " + err.Error())
+		}
+		vector = append(vector, float32(value))
+	}
+	return vector, nil
+}
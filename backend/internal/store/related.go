@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/filters"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+)
+
+const (
+	DefaultRelatedLimit = 5
+	MaxRelatedLimit     = 20
+)
+
+// RelatedChapter is a chapter similar to another one, for the related topics of the docs pages
+type RelatedChapter struct {
+	ID         string    `json:"id"`
+	Chapter    string    `json:"chapter"`
+	Source     string    `json:"source,omitempty"`
+	URL        string    `json:"url,omitempty"`
+	Breadcrumb []string  `json:"breadcrumb,omitempty"`
+	Metadata   *Metadata `json:"metadata,omitempty"`
+	Similarity float64   `json:"similarity"` // cosine similarity of the vectors of the chapters
+}
+
+func relatedLimit(limit int) int {
+	if limit <= 0 || limit > MaxRelatedLimit {
+		return DefaultRelatedLimit
+	}
+	return limit
+}
+
+// RelatedChapters returns the chapters whose vectors are the closest to the one of the chapter with the id,
+// without the chapter itself. ErrNotFound is returned when the reader can not access the chapter.
+func (d *VectorsStore) RelatedChapters(ctx context.Context, collection Collection, id string, filter *MetadataFilter, limit int) ([]*RelatedChapter, error) {
+	if _, err := d.GetObjectWithID(ctx, collection, id); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	fields := append([]graphql.Field{
+		{Name: "chapter"},
+		{Name: "source"},
+		{Name: "url"},
+		{Name: "breadcrumb"},
+		{Name: "_additional", Fields: []graphql.Field{{Name: "id"}, {Name: "distance"}}},
+	}, metadataGraphQLFields()...)
+	notItself := filters.Where().
+		WithPath([]string{"id"}).
+		WithOperator(filters.NotEqual).
+		WithValueText(id)
+	response, err := d.client.GraphQL().Get().
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
+		WithFields(fields...).
+		WithNearObject(d.client.GraphQL().NearObjectArgBuilder().WithID(id)).
+		WithWhere(andWhere(notItself, filter.where(), accessWhere(collection.Reader))).
+		WithLimit(relatedLimit(limit)).
+		Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up chapters related to %s: %w", id, err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL response error: %s", response.Errors[0].Message)
+	}
+
+	getData, ok := response.Data["Get"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid response structure: missing 'Get' key")
+	}
+	rawChapters, _ := getData[collection.Class].([]any)
+
+	related := make([]*RelatedChapter, 0, len(rawChapters))
+	for _, item := range rawChapters {
+		itemJSON, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var raw struct {
+			Chapter    string   `json:"chapter"`
+			Source     string   `json:"source"`
+			URL        string   `json:"url"`
+			Breadcrumb []string `json:"breadcrumb"`
+			Additional struct {
+				ID       string  `json:"id"`
+				Distance float64 `json:"distance"`
+			} `json:"_additional"`
+		}
+		if err := json.Unmarshal(itemJSON, &raw); err != nil {
+			return nil, err
+		}
+		metadata, err := metadataFromJSON(itemJSON)
+		if err != nil {
+			return nil, err
+		}
+		related = append(related, &RelatedChapter{
+			ID:         raw.Additional.ID,
+			Chapter:    raw.Chapter,
+			Source:     raw.Source,
+			URL:        raw.URL,
+			Breadcrumb: raw.Breadcrumb,
+			Metadata:   metadata,
+			Similarity: 1 - raw.Additional.Distance,
+		})
+	}
+	return related, nil
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// relatedCacheTTL bounds how long a list survives a change the api did not see, like a chapter created by a job
+const relatedCacheTTL = time.Hour
+
+// RelatedCacheStore keeps the related chapters in redis. Every chapter has a set of the cached lists it is part of,
+// as the chapter of the page or as one of the related ones, so that they are all dropped when it changes.
+type RelatedCacheStore struct {
+	client *redis.Client
+}
+
+// generationKey is bumped to drop every list of a class at once, it is part of the keys of the lists
+func (c *RelatedCacheStore) generationKey(collection Collection) string {
+	return "related:" + collection.Class + ":generation"
+}
+
+func (c *RelatedCacheStore) chapterKey(collection Collection, id string) string {
+	return "related:" + collection.Class + ":" + collection.Tenant + ":chapter:" + id
+}
+
+// listKey is the key of the list of a chapter for a reader, a filter and a limit
+func (c *RelatedCacheStore) listKey(ctx context.Context, collection Collection, id string, filter *MetadataFilter, limit int) (string, error) {
+	generation, err := c.client.Get(ctx, c.generationKey(collection)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", err
+	}
+
+	variant, err := relatedVariant(collection, filter, limit)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(variant)
+	return fmt.Sprintf("related:%s:%s:%d:%s:%s", collection.Class, collection.Tenant, generation, id, hex.EncodeToString(sum[:8])), nil
+}
+
+// relatedVariant identifies the list of a chapter for the reader of the collection, a filter and a limit
+func relatedVariant(collection Collection, filter *MetadataFilter, limit int) ([]byte, error) {
+	var principals []string
+	if collection.Reader != nil {
+		principals = collection.Reader.principals()
+		slices.Sort(principals)
+	}
+	return json.Marshal(struct {
+		Reader     bool
+		Principals []string
+		Filter     *MetadataFilter
+		Limit      int
+	}{collection.Reader != nil, principals, filter, relatedLimit(limit)})
+}
+
+// Get returns the cached related chapters, nil when they are not cached
+func (c *RelatedCacheStore) Get(ctx context.Context, collection Collection, id string, filter *MetadataFilter, limit int) ([]*RelatedChapter, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	key, err := c.listKey(ctx, collection, id, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := c.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	related := []*RelatedChapter{}
+	if err := json.Unmarshal(cached, &related); err != nil {
+		return nil, err
+	}
+	return related, nil
+}
+
+// Set caches the related chapters of a chapter and adds the list to the sets of all the chapters in it
+func (c *RelatedCacheStore) Set(ctx context.Context, collection Collection, id string, filter *MetadataFilter, limit int, related []*RelatedChapter) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	key, err := c.listKey(ctx, collection, id, filter, limit)
+	if err != nil {
+		return err
+	}
+	relatedJSON, err := json.Marshal(related)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, relatedJSON, relatedCacheTTL)
+		ids := []string{id}
+		for _, chapter := range related {
+			ids = append(ids, chapter.ID)
+		}
+		for _, chapterID := range ids {
+			pipe.SAdd(ctx, c.chapterKey(collection, chapterID), key)
+			pipe.Expire(ctx, c.chapterKey(collection, chapterID), relatedCacheTTL)
+		}
+		return nil
+	})
+	return err
+}
+
+// Invalidate drops the cached lists the chapters are part of
+func (c *RelatedCacheStore) Invalidate(ctx context.Context, collection Collection, ids ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	for _, id := range ids {
+		chapterKey := c.chapterKey(collection, id)
+		keys, err := c.client.SMembers(ctx, chapterKey).Result()
+		if err != nil {
+			return err
+		}
+		if err := c.client.Del(ctx, append(keys, chapterKey)...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidateCollection drops every cached list of the class of the collection, for the changes of many chapters.
+// The old lists are not deleted, they are no longer read and expire.
+func (c *RelatedCacheStore) InvalidateCollection(ctx context.Context, collection Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return c.client.Incr(ctx, c.generationKey(collection)).Err()
+}
@@ -0,0 +1,24 @@
+package store
+
+// RetrievalHit is a chapter retrieved to answer a question, rebuilt from its chunks that matched.
+// The scores are the ones of its best chunk.
+type RetrievalHit struct {
+	ID                string    `json:"id"`
+	Rank              int       `json:"rank"`                    // 1 for the first chapter of the context
+	Score             float64   `json:"score"`                   // higher is better, 1 - distance for the vector search
+	Distance          float64   `json:"distance"`                // cosine distance to the question
+	Certainty         float64   `json:"certainty"`               // the distance scaled to [0, 1] by weaviate
+	ExplainScore      string    `json:"explain_score,omitempty"` // how weaviate computed the score, for the keyword and hybrid searches
+	MatchedSubsection int       `json:"matched_subsection"`      // index in the subsections of Document of the one of the best chunk
+	MatchedTitle      string    `json:"matched_title"`
+	Document          *Document `json:"document"` // only the subsections of the chunks that matched
+}
+
+// HitDocuments returns the documents of the hits in their rank order
+func HitDocuments(hits []*RetrievalHit) []*Document {
+	documents := make([]*Document, 0, len(hits))
+	for _, hit := range hits {
+		documents = append(documents, hit.Document)
+	}
+	return documents
+}
@@ -0,0 +1,340 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+// kinds of schema changes, the first two are applied by a migration and the others have to be done by hand
+// (export the knowledge base with the kb cli, delete the class and import it again)
+const (
+	SchemaCreateClass     = "create_class"
+	SchemaAddProperty     = "add_property"
+	SchemaMultiTenancy    = "multi_tenancy"
+	SchemaVectorizer      = "vectorizer"
+	SchemaDataType        = "data_type"
+	SchemaTokenization    = "tokenization"
+	SchemaIndexFilterable = "index_filterable"
+	SchemaIndexSearchable = "index_searchable"
+	SchemaNestedProperty  = "nested_property"
+)
+
+// SchemaChange is one difference between the live schema of a class and the one declared here
+type SchemaChange struct {
+	Class    string `json:"class"`
+	Property string `json:"property,omitempty"`
+	Kind     string `json:"kind"`
+	Live     string `json:"live,omitempty"`
+	Desired  string `json:"desired,omitempty"`
+}
+
+func (c SchemaChange) String() string {
+	name := c.Class
+	if c.Property != "" {
+		name += "." + c.Property
+	}
+	if c.Live == "" && c.Desired == "" {
+		return fmt.Sprintf("%s: %s", name, c.Kind)
+	}
+	return fmt.Sprintf("%s: %s %q -> %q", name, c.Kind, c.Live, c.Desired)
+}
+
+// SchemaPlan is the result of diffing the classes of a knowledge base against their declared schema
+type SchemaPlan struct {
+	KnowledgeBase string         `json:"knowledge_base"`
+	Additive      []SchemaChange `json:"additive"`
+	Incompatible  []SchemaChange `json:"incompatible"`
+	Applied       bool           `json:"applied"`
+}
+
+// Err returns an error when an incompatible change keeps the classes from being used at all,
+// the other incompatible changes are only reported
+func (p *SchemaPlan) Err() error {
+	for _, change := range p.Incompatible {
+		if change.Kind == SchemaMultiTenancy {
+			return fmt.Errorf("class %s: %w", change.Class, ErrCollectionNotMultiTenant)
+		}
+	}
+	return nil
+}
+
+func schemaBool(value bool) *bool {
+	return &value
+}
+
+// text properties that are only compared as a whole value, never searched with bm25
+func keywordProperty(name string, dataType string) *models.Property {
+	return &models.Property{
+		Name:            name,
+		DataType:        []string{dataType},
+		Tokenization:    models.PropertyTokenizationField,
+		IndexFilterable: schemaBool(true),
+		IndexSearchable: schemaBool(false),
+	}
+}
+
+func textProperty(name string) *models.Property {
+	return &models.Property{
+		Name:            name,
+		DataType:        []string{"text"},
+		Tokenization:    models.PropertyTokenizationWord,
+		IndexFilterable: schemaBool(true),
+		IndexSearchable: schemaBool(true),
+	}
+}
+
+func intProperty(name string, dataType string) *models.Property {
+	return &models.Property{
+		Name:            name,
+		DataType:        []string{dataType},
+		IndexFilterable: schemaBool(true),
+	}
+}
+
+// collectionClasses returns the schema of the two classes of a knowledge base,
+// the chunk class references the chapter class so it has to be created last
+func collectionClasses(kb *KnowledgeBase) []*models.Class {
+	collection := kb.Collection("")
+
+	var moduleConfig map[string]interface{}
+	var notVectorized map[string]interface{}
+	if kb.Vectorizer != VectorizerNone {
+		if len(kb.VectorizerConfig) > 0 {
+			moduleConfig = map[string]interface{}{
+				kb.Vectorizer: kb.VectorizerConfig,
+			}
+		}
+		// the hashes of the upserts are not part of the text of the chapter
+		notVectorized = map[string]interface{}{
+			kb.Vectorizer: map[string]interface{}{"skip": true},
+		}
+	}
+
+	// the metadata are only filtered on, they are not part of the text that is vectorized
+	metadataProperties := func() []*models.Property {
+		var properties []*models.Property
+		for _, field := range metadataFields {
+			dataType := "text"
+			if field == "tags" {
+				dataType = "text[]"
+			}
+			property := keywordProperty(field, dataType)
+			property.ModuleConfig = notVectorized
+			properties = append(properties, property)
+		}
+		return properties
+	}
+
+	// the access lists of the documents, copied in their chunks so that the search can filter on them
+	accessProperties := func() []*models.Property {
+		restricted := &models.Property{
+			Name:            "aclRestricted",
+			DataType:        []string{"boolean"},
+			IndexFilterable: schemaBool(true),
+			ModuleConfig:    notVectorized,
+		}
+		principals := keywordProperty("aclPrincipals", "text[]")
+		principals.ModuleConfig = notVectorized
+		return []*models.Property{restricted, principals}
+	}
+
+	// the links of the documents are cited in the answers, they are not part of the text that is vectorized
+	linkProperty := func(name string, dataType string) *models.Property {
+		property := keywordProperty(name, dataType)
+		property.ModuleConfig = notVectorized
+		return property
+	}
+
+	contentHash := keywordProperty("contentHash", "text")
+	contentHash.ModuleConfig = notVectorized
+	subsectionHashes := keywordProperty("subsectionHashes", "text[]")
+	subsectionHashes.ModuleConfig = notVectorized
+	// looks up the copies of a document uploaded again under another name
+	textHash := keywordProperty("textHash", "text")
+	textHash.ModuleConfig = notVectorized
+
+	// the chapters are looked up by their whole name, the chunks keep the words of the name for bm25.
+	// The classes created with a word tokenized name are reported as an incompatible change.
+	chapterName := keywordProperty("chapter", "text")
+
+	chapterClass := &models.Class{
+		Class:              collection.Class,
+		Vectorizer:         kb.Vectorizer,
+		ModuleConfig:       moduleConfig,
+		MultiTenancyConfig: &models.MultiTenancyConfig{Enabled: true},
+		Properties: append([]*models.Property{
+			chapterName,
+			textProperty("source"),
+			{
+				Name:     "subsections",
+				DataType: []string{"object[]"},
+				NestedProperties: []*models.NestedProperty{
+					{Name: "title", DataType: []string{"text"}},
+					{Name: "content", DataType: []string{"text"}},
+					{Name: "pages", DataType: []string{"int[]"}},
+				},
+			},
+			contentHash,
+			subsectionHashes,
+			textHash,
+			linkProperty("url", "text"),
+			linkProperty("breadcrumb", "text[]"),
+			linkProperty("subsectionAnchors", "text[]"),
+		}, append(metadataProperties(), accessProperties()...)...),
+	}
+
+	// every subsection of a chapter is split into chunk objects that reference their chapter
+	chunkClass := &models.Class{
+		Class:              collection.ChunkClass(),
+		Vectorizer:         kb.Vectorizer,
+		ModuleConfig:       moduleConfig,
+		MultiTenancyConfig: &models.MultiTenancyConfig{Enabled: true},
+		Properties: append([]*models.Property{
+			keywordProperty("chapterId", "text"),
+			textProperty("chapter"),
+			textProperty("title"),
+			textProperty("content"),
+			intProperty("subsectionIndex", "int"),
+			intProperty("chunkIndex", "int"),
+			textProperty("source"),
+			intProperty("pages", "int[]"),
+			{Name: "ofChapter", DataType: []string{collection.Class}},
+			linkProperty("url", "text"),
+			linkProperty("anchor", "text"),
+			linkProperty("breadcrumb", "text[]"),
+		}, append(metadataProperties(), accessProperties()...)...),
+	}
+
+	return []*models.Class{chapterClass, chunkClass}
+}
+
+// MigrateSchema diffs the live classes of a knowledge base against collectionClasses. With apply the
+// missing classes and properties are created, the incompatible changes are only reported.
+func (d *VectorsStore) MigrateSchema(ctx context.Context, kb *KnowledgeBase, apply bool) (*SchemaPlan, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	plan := &SchemaPlan{
+		KnowledgeBase: kb.Name,
+		Additive:      []SchemaChange{},
+		Incompatible:  []SchemaChange{},
+	}
+	for _, class := range collectionClasses(kb) {
+		exists, err := d.client.Schema().ClassExistenceChecker().WithClassName(class.Class).Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error checking if class %s exists: %w", class.Class, err)
+		}
+		if !exists {
+			plan.Additive = append(plan.Additive, SchemaChange{Class: class.Class, Kind: SchemaCreateClass})
+			if apply {
+				if err := d.client.Schema().ClassCreator().WithClass(class).Do(ctx); err != nil {
+					return nil, fmt.Errorf("error creating class %s: %w", class.Class, err)
+				}
+			}
+			continue
+		}
+
+		live, err := d.client.Schema().ClassGetter().WithClassName(class.Class).Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting class %s: %w", class.Class, err)
+		}
+		missing, incompatible := diffClass(live, class)
+		plan.Incompatible = append(plan.Incompatible, incompatible...)
+		for _, property := range missing {
+			plan.Additive = append(plan.Additive, SchemaChange{Class: class.Class, Property: property.Name, Kind: SchemaAddProperty})
+			if !apply {
+				continue
+			}
+			err := d.client.Schema().PropertyCreator().WithClassName(class.Class).WithProperty(property).Do(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("error adding property %s to class %s: %w", property.Name, class.Class, err)
+			}
+		}
+	}
+	plan.Applied = apply
+	return plan, nil
+}
+
+// diffClass returns the properties missing from the live class and the differences that weaviate
+// can not change on a class that already exists. Properties only in the live class are left alone.
+func diffClass(live *models.Class, desired *models.Class) ([]*models.Property, []SchemaChange) {
+	var incompatible []SchemaChange
+	change := func(property string, kind string, liveValue string, desiredValue string) {
+		incompatible = append(incompatible, SchemaChange{
+			Class:    desired.Class,
+			Property: property,
+			Kind:     kind,
+			Live:     liveValue,
+			Desired:  desiredValue,
+		})
+	}
+
+	// multi-tenancy can not be turned on for a class that already exists
+	if live.MultiTenancyConfig == nil || !live.MultiTenancyConfig.Enabled {
+		change("", SchemaMultiTenancy, "disabled", "enabled")
+	}
+	if live.Vectorizer != desired.Vectorizer {
+		change("", SchemaVectorizer, live.Vectorizer, desired.Vectorizer)
+	}
+
+	liveProperties := make(map[string]*models.Property, len(live.Properties))
+	for _, property := range live.Properties {
+		liveProperties[property.Name] = property
+	}
+
+	var missing []*models.Property
+	for _, property := range desired.Properties {
+		liveProperty, ok := liveProperties[property.Name]
+		if !ok {
+			missing = append(missing, property)
+			continue
+		}
+
+		liveType := strings.Join(liveProperty.DataType, ",")
+		desiredType := strings.Join(property.DataType, ",")
+		if liveType != desiredType {
+			change(property.Name, SchemaDataType, liveType, desiredType)
+			continue
+		}
+
+		isText := desiredType == "text" || desiredType == "text[]"
+		if isText && property.Tokenization != "" {
+			// weaviate tokenizes text by word when nothing was set
+			tokenization := liveProperty.Tokenization
+			if tokenization == "" {
+				tokenization = models.PropertyTokenizationWord
+			}
+			if tokenization != property.Tokenization {
+				change(property.Name, SchemaTokenization, tokenization, property.Tokenization)
+			}
+		}
+		if property.IndexFilterable != nil && indexEnabled(liveProperty.IndexFilterable) != *property.IndexFilterable {
+			change(property.Name, SchemaIndexFilterable,
+				strconv.FormatBool(indexEnabled(liveProperty.IndexFilterable)), strconv.FormatBool(*property.IndexFilterable))
+		}
+		if isText && property.IndexSearchable != nil && indexEnabled(liveProperty.IndexSearchable) != *property.IndexSearchable {
+			change(property.Name, SchemaIndexSearchable,
+				strconv.FormatBool(indexEnabled(liveProperty.IndexSearchable)), strconv.FormatBool(*property.IndexSearchable))
+		}
+
+		liveNested := make(map[string]bool, len(liveProperty.NestedProperties))
+		for _, nested := range liveProperty.NestedProperties {
+			liveNested[nested.Name] = true
+		}
+		for _, nested := range property.NestedProperties {
+			if !liveNested[nested.Name] {
+				change(property.Name+"."+nested.Name, SchemaNestedProperty, "", "added")
+			}
+		}
+	}
+	return missing, incompatible
+}
+
+// the indexes of weaviate are enabled when nothing was set
+func indexEnabled(value *bool) bool {
+	return value == nil || *value
+}
@@ -0,0 +1,334 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+var ErrUnknownSearchMode = errors.New("unknown search mode, use vector, hybrid or keyword")
+
+// modes of the search, the vector one is the retrieval of the chat
+const (
+	SearchModeVector  = "vector"
+	SearchModeHybrid  = "hybrid"
+	SearchModeKeyword = "keyword"
+)
+
+const (
+	DefaultSearchLimit = 10
+	MaxSearchLimit     = 50
+
+	searchMaxDistance     = 0.5 // same cosine distance threshold as the retrieval of the chat
+	hybridAlpha           = 0.5 // weight of the vector scores in the hybrid search, the keyword ones get the rest
+	searchChunksPerResult = 3   // chunks fetched per result, several chunks of a subsection make one result
+	maxSearchWindow       = 300 // chunks ranked at most, the pages after them are empty
+	snippetWords          = 30
+)
+
+// SearchQuery is a page of a search of the chunks of a collection, the results are subsections
+type SearchQuery struct {
+	Query  string
+	Mode   string
+	Filter *MetadataFilter
+	Limit  int
+	Offset int
+}
+
+// SearchResult is a subsection matching a search, with the best of its chunks as snippet
+type SearchResult struct {
+	ID              string    `json:"id"` // id of the chapter object
+	Chapter         string    `json:"chapter"`
+	Title           string    `json:"title"`
+	SubsectionIndex int       `json:"subsection_index"`
+	URL             string    `json:"url,omitempty"` // deep link to the subsection
+	Breadcrumb      []string  `json:"breadcrumb,omitempty"`
+	Source          string    `json:"source,omitempty"`
+	Pages           []int     `json:"pages,omitempty"`
+	Metadata        *Metadata `json:"metadata,omitempty"`
+	Snippet         string    `json:"snippet"` // html escaped, the words of the query are in <mark> tags
+	Score           float64   `json:"score"`   // higher is better, only comparable within a mode
+}
+
+type SearchPage struct {
+	Mode    string          `json:"mode"`
+	Results []*SearchResult `json:"results"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+	HasMore bool            `json:"has_more"`
+}
+
+// searchHit is a chunk matching a search with its score
+type searchHit struct {
+	chunk Chunk
+	score float64
+}
+
+func ParseSearchMode(value string, fallback string) (string, error) {
+	switch value {
+	case SearchModeVector, SearchModeHybrid, SearchModeKeyword:
+		return value, nil
+	case "":
+		return fallback, nil
+	default:
+		return "", ErrUnknownSearchMode
+	}
+}
+
+// normalized checks the mode and sets the default limit
+func (q SearchQuery) normalized() (SearchQuery, error) {
+	mode, err := ParseSearchMode(q.Mode, SearchModeVector)
+	if err != nil {
+		return q, err
+	}
+	q.Mode = mode
+	if q.Limit <= 0 || q.Limit > MaxSearchLimit {
+		q.Limit = DefaultSearchLimit
+	}
+	q.Offset = max(q.Offset, 0)
+	return q, nil
+}
+
+// window is the number of chunks ranked to fill the page and to know if there is another one
+func (q SearchQuery) window() int {
+	return min((q.Offset+q.Limit+1)*searchChunksPerResult, maxSearchWindow)
+}
+
+// page groups the hits, best first, by subsection and returns the results of the page
+func (q SearchQuery) page(hits []searchHit) *SearchPage {
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+
+	page := &SearchPage{Mode: q.Mode, Results: []*SearchResult{}, Limit: q.Limit, Offset: q.Offset}
+	seen := make(map[string]bool)
+	ranked := 0
+	for _, hit := range hits {
+		key := fmt.Sprintf("%s/%d", hit.chunk.ChapterID, hit.chunk.SubsectionIndex)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ranked++
+		if ranked <= q.Offset {
+			continue
+		}
+		if len(page.Results) == q.Limit {
+			page.HasMore = true
+			break
+		}
+		page.Results = append(page.Results, &SearchResult{
+			ID:              hit.chunk.ChapterID,
+			Chapter:         hit.chunk.Chapter,
+			Title:           hit.chunk.Title,
+			SubsectionIndex: hit.chunk.SubsectionIndex,
+			URL:             deepLink(hit.chunk.URL, hit.chunk.Anchor),
+			Breadcrumb:      hit.chunk.Breadcrumb,
+			Source:          hit.chunk.Source,
+			Pages:           hit.chunk.Pages,
+			Metadata:        hit.chunk.Metadata,
+			Snippet:         Highlight(hit.chunk.Content, q.Query),
+			Score:           hit.score,
+		})
+	}
+	return page
+}
+
+// fuseHits merges the hits of a vector and a keyword search: the scores of each search are scaled to [0, 1]
+// and summed with the weight alpha for the vector ones, like the relative score fusion of weaviate
+func fuseHits(vectorHits []searchHit, keywordHits []searchHit, alpha float64) []searchHit {
+	fused := make(map[string]*searchHit)
+	var order []string
+	add := func(hits []searchHit, weight float64) {
+		if len(hits) == 0 {
+			return
+		}
+		low, high := hits[0].score, hits[0].score
+		for _, hit := range hits {
+			low, high = min(low, hit.score), max(high, hit.score)
+		}
+		for _, hit := range hits {
+			scaled := 1.0
+			if high > low {
+				scaled = (hit.score - low) / (high - low)
+			}
+			key := fmt.Sprintf("%s/%d/%d", hit.chunk.ChapterID, hit.chunk.SubsectionIndex, hit.chunk.ChunkIndex)
+			existing, ok := fused[key]
+			if !ok {
+				existing = &searchHit{chunk: hit.chunk}
+				fused[key] = existing
+				order = append(order, key)
+			}
+			existing.score += weight * scaled
+		}
+	}
+	add(vectorHits, alpha)
+	add(keywordHits, 1-alpha)
+
+	hits := make([]searchHit, 0, len(order))
+	for _, key := range order {
+		hits = append(hits, *fused[key])
+	}
+	return hits
+}
+
+// searchTerms returns the lowercased words of a query
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Highlight returns the part of the content with the most words of the query, html escaped and with
+// the words of the query in <mark> tags. The start of the content is returned when no word matches.
+func Highlight(content string, query string) string {
+	words := strings.Fields(content)
+	terms := make(map[string]bool)
+	for _, term := range searchTerms(query) {
+		terms[term] = true
+	}
+	matches := make([]bool, len(words))
+	for i, word := range words {
+		for _, term := range searchTerms(word) {
+			if terms[term] {
+				matches[i] = true
+				break
+			}
+		}
+	}
+
+	// the window of snippetWords words with the most matches
+	start, best, count := 0, 0, 0
+	for i := range words {
+		if matches[i] {
+			count++
+		}
+		if i >= snippetWords && matches[i-snippetWords] {
+			count--
+		}
+		if count > best {
+			best = count
+			start = max(i-snippetWords+1, 0)
+		}
+	}
+	// a few words before the first match give it some context
+	if best > 0 {
+		first := start
+		for !matches[first] {
+			first++
+		}
+		start = max(first-snippetWords/4, 0)
+	}
+	end := min(start+snippetWords, len(words))
+
+	var snippet strings.Builder
+	if start > 0 {
+		snippet.WriteString("… ")
+	}
+	for i := start; i < end; i++ {
+		if i > start {
+			snippet.WriteString(" ")
+		}
+		if matches[i] {
+			snippet.WriteString("<mark>" + html.EscapeString(words[i]) + "</mark>")
+		} else {
+			snippet.WriteString(html.EscapeString(words[i]))
+		}
+	}
+	if end < len(words) {
+		snippet.WriteString(" …")
+	}
+	return snippet.String()
+}
+
+// Search returns a page of the subsections matching the query with the vector, the bm25 or the hybrid search of weaviate
+func (d *VectorsStore) Search(ctx context.Context, collection Collection, query SearchQuery) (*SearchPage, error) {
+	query, err := query.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	get := d.client.GraphQL().Get().
+		WithClassName(collection.ChunkClass()).
+		WithTenant(collection.Tenant).
+		WithLimit(query.window())
+	if where := andWhere(query.Filter.where(), accessWhere(collection.Reader)); where != nil {
+		get = get.WithWhere(where)
+	}
+	switch query.Mode {
+	case SearchModeKeyword:
+		get = get.WithFields(chunkGraphQLFields("score")...).
+			WithBM25(d.client.GraphQL().Bm25ArgBuilder().
+				WithQuery(query.Query).
+				WithProperties("title", "content", "chapter"))
+	case SearchModeHybrid:
+		hybrid := d.client.GraphQL().HybridArgumentBuilder().
+			WithQuery(query.Query).
+			WithAlpha(hybridAlpha).
+			WithProperties([]string{"title", "content", "chapter"})
+		// the collections without a weaviate vectorizer are searched with the vector of the app embedder
+		if collection.clientEmbeddings() {
+			if d.embedder == nil {
+				return nil, ErrNoEmbedder
+			}
+			vector, err := d.embedder.EmbedQuery(ctx, query.Query)
+			if err != nil {
+				return nil, err
+			}
+			hybrid = hybrid.WithVector(vector)
+		}
+		get = get.WithFields(chunkGraphQLFields("score")...).WithHybrid(hybrid)
+	default:
+		nearVector, err := d.nearVector(ctx, collection, query.Query, searchMaxDistance)
+		if err != nil {
+			return nil, err
+		}
+		get = get.WithFields(chunkGraphQLFields("distance")...)
+		if nearVector != nil {
+			get = get.WithNearVector(nearVector)
+		} else {
+			get = get.WithNearText(d.client.GraphQL().NearTextArgBuilder().
+				WithConcepts([]string{query.Query}).
+				WithDistance(searchMaxDistance))
+		}
+	}
+
+	response, err := get.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error searching %s: %w", collection.ChunkClass(), err)
+	}
+	hits, err := parseSearchHits(response, collection.ChunkClass())
+	if err != nil {
+		return nil, err
+	}
+	return query.page(hits), nil
+}
+
+func parseSearchHits(response *models.GraphQLResponse, className string) ([]searchHit, error) {
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL response error: %s", response.Errors[0].Message)
+	}
+	getData, ok := response.Data["Get"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid response structure: missing 'Get' key")
+	}
+	rawChunks, _ := getData[className].([]any)
+
+	hits := make([]searchHit, 0, len(rawChunks))
+	for _, item := range rawChunks {
+		itemMap, _ := item.(map[string]any)
+		chunk, err := chunkFromGraphQL(itemMap)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, searchHit{chunk: chunk, score: chunk.Score})
+	}
+	return hits, nil
+}
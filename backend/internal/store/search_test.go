@@ -0,0 +1,50 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	long := strings.Repeat("filler ", 40) + "restart the server" + strings.Repeat(" filler", 40)
+
+	tests := []struct {
+		name    string
+		content string
+		query   string
+		want    string
+	}{
+		{
+			name:    "words of the query are marked",
+			content: "Restart the server, then check the logs.",
+			query:   "restart logs",
+			want:    "<mark>Restart</mark> the server, then check the <mark>logs.</mark>",
+		},
+		{
+			name:    "html is escaped",
+			content: "Use <b>sudo</b> & restart",
+			query:   "restart",
+			want:    "Use &lt;b&gt;sudo&lt;/b&gt; &amp; <mark>restart</mark>",
+		},
+		{
+			name:    "no match returns the start of the content",
+			content: strings.Repeat("word ", 35),
+			query:   "missing",
+			want:    strings.TrimSpace(strings.Repeat("word ", 30)) + " …",
+		},
+		{
+			name:    "the snippet starts a few words before the match",
+			content: long,
+			query:   "server",
+			want: "… " + strings.TrimSpace(strings.Repeat("filler ", 5)) + " restart the <mark>server</mark> " +
+				strings.TrimSpace(strings.Repeat("filler ", 22)) + " …",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Highlight(tt.content, tt.query); got != tt.want {
+				t.Errorf("Highlight() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
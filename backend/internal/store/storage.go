@@ -7,6 +7,7 @@ import (
 
 	"errors"
 
+	"github.com/mik-dmi/rag_chatbot/backend/internal/embedding"
 	"github.com/redis/go-redis/v9"
 	"github.com/weaviate/weaviate-go-client/v4/weaviate"
 )
@@ -15,19 +16,42 @@ var (
 	ErrNotFound             = errors.New("vector not found")
 	ErrChapterAlreadyExists = errors.New("already exists in weaviate")
 	QueryTimeoutDuration    = time.Second * 5
+	WriteTimeoutDuration    = time.Minute // the batch writes also embed every chunk they store
 	ErrDuplicateEmail       = errors.New("user with that email already exist")
 	ErrDuplicateUsername    = errors.New("user with that user name already exists")
 )
 
+const (
+	VectorBackendWeaviate = "weaviate"
+	VectorBackendPgVector = "pgvector"
+	VectorBackendMemory   = "memory"
+)
+
 type WeaviateStorage struct {
 	Vectors interface {
-		CreateVectors(context.Context, *RagData) (*VectorCreatedResponse, error)
-		GetClosestVectors(context.Context, string) ([]*Document, error)
-		chapterExists(context.Context, string) (bool, error)
-		GetObjectIDByChapter(context.Context, string) (*IDResponse, error)
-		DeleteChapterWithChapterName(context.Context, string) (*SuccessfullyAPIOperation, error)
-		DeleteObjectWithID(context.Context, string) (*SuccessfullyAPIOperation, error)
-		UpdateObjectWithID(context.Context, Document, string) (*SuccessfullyAPIOperation, error)
+		CreateVectors(context.Context, Collection, *RagData) (*VectorCreatedResponse, error)
+		UpsertVectors(context.Context, Collection, *RagData, bool) (*UpsertReport, error)
+		GetClosestVectors(context.Context, Collection, string, *MetadataFilter) ([]*RetrievalHit, error)
+		chapterExists(context.Context, Collection, string) (bool, error)
+		GetObjectIDByChapter(context.Context, Collection, string) (*IDResponse, error)
+		DeleteChapterWithChapterName(context.Context, Collection, string) (*SuccessfullyAPIOperation, error)
+		GetObjectWithID(context.Context, Collection, string) (*Document, error)
+		ListChapters(context.Context, Collection, ChapterListQuery) (*ChapterPage, error)
+		SearchTitles(context.Context, Collection, string, int) ([]*TitleMatch, error)
+		CountFacets(context.Context, Collection) (*MetadataFacets, error)
+		FindDuplicates(context.Context, Collection, Document, float32) ([]DuplicateMatch, error)
+		Search(context.Context, Collection, SearchQuery) (*SearchPage, error)
+		RelatedChapters(context.Context, Collection, string, *MetadataFilter, int) ([]*RelatedChapter, error)
+		DeleteObjectWithID(context.Context, Collection, string) (*SuccessfullyAPIOperation, error)
+		UpdateObjectWithID(context.Context, Collection, Document, string) (*SuccessfullyAPIOperation, error)
+		ExportObjects(context.Context, Collection, bool, func(*ExportedObject) error) error
+		ImportObjects(context.Context, Collection, []ExportedObject, ConflictPolicy) (*ImportReport, error)
+		CreateCollection(context.Context, *KnowledgeBase) error
+		MigrateSchema(context.Context, *KnowledgeBase, bool) (*SchemaPlan, error)
+		DeleteCollection(context.Context, Collection) error
+		CreateTenant(context.Context, Collection) error
+		SetTenantActive(context.Context, Collection, bool) error
+		DeleteTenant(context.Context, Collection) error
 	}
 }
 type RedisStorage struct {
@@ -35,6 +59,12 @@ type RedisStorage struct {
 		GetChatHistory(context.Context, string) (map[string]any, error)
 		PostChatData(context.Context) error
 	}
+	RelatedChapters interface {
+		Get(context.Context, Collection, string, *MetadataFilter, int) ([]*RelatedChapter, error)
+		Set(context.Context, Collection, string, *MetadataFilter, int, []*RelatedChapter) error
+		Invalidate(context.Context, Collection, ...string) error
+		InvalidateCollection(context.Context, Collection) error
+	}
 }
 
 type PostgreStorage struct {
@@ -45,27 +75,131 @@ type PostgreStorage struct {
 		Activate(context.Context, string) error
 		Delete(context.Context, string) error
 	}
+	Jobs interface {
+		Create(context.Context, *IngestionJob, []Document) error
+		GetByID(context.Context, string) (*IngestionJob, error)
+		ClaimNext(context.Context, time.Duration) (*IngestionJob, error)
+		RenewLease(context.Context, string, time.Duration) error
+		Fail(context.Context, string, string) error
+		GetPendingChapters(context.Context, string) ([]IngestionJobChapter, error)
+		UpdateChapter(context.Context, *IngestionJobChapter) error
+		Finish(context.Context, string) (string, error)
+		RequeueExpired(context.Context) (int64, error)
+	}
+	KnowledgeBases interface {
+		Create(context.Context, *KnowledgeBase) error
+		GetByName(context.Context, string) (*KnowledgeBase, error)
+		List(context.Context) ([]*KnowledgeBase, error)
+		Update(context.Context, *KnowledgeBase) error
+		Delete(context.Context, string) error
+	}
+	Versions interface {
+		Create(context.Context, *ChapterVersion) error
+		List(context.Context, string, string, string) ([]*ChapterVersion, error)
+		GetByVersion(context.Context, string, string, string, int) (*ChapterVersion, error)
+	}
+	Tenants interface {
+		Create(context.Context, *Tenant) error
+		GetByName(context.Context, string) (*Tenant, error)
+		List(context.Context) ([]*Tenant, error)
+		SetActive(context.Context, *Tenant) error
+		SetGapReportEmails(context.Context, *Tenant) error
+		Delete(context.Context, string) error
+	}
+	Analytics interface {
+		CreateBatch(context.Context, []*QueryEvent) error
+		TopQuestions(context.Context, AnalyticsRange) ([]QuestionCount, error)
+		TopChapters(context.Context, AnalyticsRange, []string) ([]ChapterCount, error)
+		RetrievedChapterIDs(context.Context, AnalyticsRange) (map[string]bool, error)
+		UnansweredQuestions(context.Context, AnalyticsRange) ([]UnansweredQuestion, error)
+		UnansweredScopes(context.Context, time.Time, time.Time) ([]AnalyticsRange, error)
+		ClaimReport(context.Context, string, time.Time, time.Duration) (time.Time, bool, error)
+	}
+	FAQs interface {
+		Create(context.Context, *FAQEntry, [][]float32) error
+		GetByID(context.Context, string, string, string) (*FAQEntry, error)
+		List(context.Context, string, string) ([]*FAQEntry, error)
+		Update(context.Context, *FAQEntry, [][]float32) error
+		Delete(context.Context, string, string, string) error
+		Match(context.Context, string, string, []float32, float64) (*FAQMatch, error)
+	}
+}
+
+func NewWeaviateStorage(client *weaviate.Client, chunking ChunkingConfig, retrieval RetrievalConfig, embedder embedding.Embedder) WeaviateStorage {
+	return WeaviateStorage{
+		Vectors: &VectorsStore{client, chunking, retrieval, embedder},
+	}
 }
 
-func NewWeaviateStorage(client *weaviate.Client) WeaviateStorage {
+// NewPgVectorStorage keeps the vectors in postgres, they are always computed by the embedder
+func NewPgVectorStorage(client *sql.DB, chunking ChunkingConfig, retrieval RetrievalConfig, embedder embedding.Embedder) WeaviateStorage {
 	return WeaviateStorage{
-		Vectors: &VectorsStore{client},
+		Vectors: &PgVectorsStore{client, chunking, retrieval, embedder},
 	}
 }
 
+// NewMemoryVectorStorage keeps the vectors in memory, for development and tests.
+// With a snapshot path they are also saved to that file.
+func NewMemoryVectorStorage(chunking ChunkingConfig, retrieval RetrievalConfig, embedder embedding.Embedder, snapshotPath string) (WeaviateStorage, error) {
+	vectors, err := NewMemoryVectorsStore(chunking, retrieval, embedder, snapshotPath)
+	if err != nil {
+		return WeaviateStorage{}, err
+	}
+	return WeaviateStorage{
+		Vectors: vectors,
+	}, nil
+}
+
 func NewRedisStorage(client *redis.Client) RedisStorage {
 	return RedisStorage{
-		ChatHistory: &ChatHistoryStore{client},
+		ChatHistory:     &ChatHistoryStore{client},
+		RelatedChapters: &RelatedCacheStore{client},
 	}
 }
 
 func NewPostgreStorage(client *sql.DB) PostgreStorage {
 	return PostgreStorage{
-		Users: &UsersStore{client},
+		Users:          &UsersStore{client},
+		Jobs:           &JobsStore{client},
+		KnowledgeBases: &KnowledgeBasesStore{client},
+		Tenants:        &TenantsStore{client},
+		Versions:       &VersionsStore{client},
+		Analytics:      &AnalyticsStore{client},
+		FAQs:           &FAQsStore{client},
 	}
 
 }
 
+// NewMemoryRedisStorage keeps the chat histories and the related chapters in memory, for the memory backend
+func NewMemoryRedisStorage() RedisStorage {
+	return RedisStorage{
+		ChatHistory:     NewMemoryChatHistoryStore(),
+		RelatedChapters: NewMemoryRelatedCacheStore(),
+	}
+}
+
+// NewMemoryPostgreStorage keeps the tables of postgres in memory, for the memory backend.
+// Unlike the vectors they are not saved to a snapshot and are lost when the api stops.
+func NewMemoryPostgreStorage() PostgreStorage {
+	return PostgreStorage{
+		Users:          NewMemoryUsersStore(),
+		Jobs:           NewMemoryJobsStore(),
+		KnowledgeBases: NewMemoryKnowledgeBasesStore(),
+		Tenants:        NewMemoryTenantsStore(),
+		Versions:       NewMemoryVersionsStore(),
+		Analytics:      NewMemoryAnalyticsStore(),
+		FAQs:           NewMemoryFAQsStore(),
+	}
+}
+
+// writeContext bounds a batch write with WriteTimeoutDuration, unless the caller already set its own deadline
+func writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, WriteTimeoutDuration)
+}
+
 func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error {
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
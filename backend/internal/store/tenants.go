@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateTenant = errors.New("tenant with that name already exists")
+)
+
+type TenantsStore struct {
+	client *sql.DB
+}
+
+// Tenant is a customer organization, its documents are stored in its own weaviate tenant of every knowledge base
+type Tenant struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	IsActive        bool     `json:"is_active"`
+	GapReportEmails []string `json:"gap_report_emails"` // they get the knowledge gap reports of the questions of the organization
+	CreatedAt       string   `json:"created_at"`
+	UpdatedAt       string   `json:"updated_at"`
+}
+
+func (s *TenantsStore) Create(ctx context.Context, tenant *Tenant) error {
+	query := `
+	INSERT INTO tenants (name, is_active, gap_report_emails)
+	VALUES ($1, $2, $3)
+	RETURNING tenant_id, created_at, updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tenant.IsActive = true
+	if tenant.GapReportEmails == nil {
+		tenant.GapReportEmails = []string{}
+	}
+	err := s.client.QueryRowContext(ctx, query, tenant.Name, tenant.IsActive, pq.Array(tenant.GapReportEmails)).Scan(
+		&tenant.ID,
+		&tenant.CreatedAt,
+		&tenant.UpdatedAt,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrDuplicateTenant
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *TenantsStore) GetByName(ctx context.Context, name string) (*Tenant, error) {
+	query := `
+	SELECT tenant_id, name, is_active, gap_report_emails, created_at, updated_at
+	FROM tenants WHERE name = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tenant := &Tenant{}
+	err := s.client.QueryRowContext(ctx, query, name).Scan(
+		&tenant.ID,
+		&tenant.Name,
+		&tenant.IsActive,
+		pq.Array(&tenant.GapReportEmails),
+		&tenant.CreatedAt,
+		&tenant.UpdatedAt,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return tenant, nil
+}
+
+func (s *TenantsStore) List(ctx context.Context) ([]*Tenant, error) {
+	query := `
+	SELECT tenant_id, name, is_active, gap_report_emails, created_at, updated_at
+	FROM tenants ORDER BY name
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.client.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*Tenant
+	for rows.Next() {
+		tenant := &Tenant{}
+		if err := rows.Scan(
+			&tenant.ID,
+			&tenant.Name,
+			&tenant.IsActive,
+			pq.Array(&tenant.GapReportEmails),
+			&tenant.CreatedAt,
+			&tenant.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
+
+// SetActive saves the is_active flag of the tenant
+func (s *TenantsStore) SetActive(ctx context.Context, tenant *Tenant) error {
+	query := `
+	UPDATE tenants SET is_active = $1, updated_at = NOW()
+	WHERE tenant_id = $2
+	RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.client.QueryRowContext(ctx, query, tenant.IsActive, tenant.ID).Scan(&tenant.UpdatedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// SetGapReportEmails saves the recipients of the knowledge gap reports of the tenant
+func (s *TenantsStore) SetGapReportEmails(ctx context.Context, tenant *Tenant) error {
+	query := `
+	UPDATE tenants SET gap_report_emails = $1, updated_at = NOW()
+	WHERE tenant_id = $2
+	RETURNING updated_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if tenant.GapReportEmails == nil {
+		tenant.GapReportEmails = []string{}
+	}
+	err := s.client.QueryRowContext(ctx, query, pq.Array(tenant.GapReportEmails), tenant.ID).Scan(&tenant.UpdatedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *TenantsStore) Delete(ctx context.Context, tenantID string) error {
+	query := `DELETE FROM tenants WHERE tenant_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.client.ExecContext(ctx, query, tenantID)
+	return err
+}
@@ -0,0 +1,327 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/filters"
+	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
+	"github.com/weaviate/weaviate/entities/models"
+)
+
+var ErrDuplicateChapter = errors.New("chapter is more than once in the documents")
+
+// UpsertReport lists the chapters of an upsert by what was done with them
+type UpsertReport struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Unchanged []string `json:"unchanged"`
+	Deleted   []string `json:"deleted"`
+	// the updated and deleted chapters, for their versions
+	Changes []ChapterChange `json:"-"`
+}
+
+// ChapterChange is a chapter updated or deleted by an upsert or an import, with the text it had before
+type ChapterChange struct {
+	ID       string
+	Previous Document
+	Current  *Document // nil when the chapter was deleted
+}
+
+// indexedChapter is what an upsert needs to know about a chapter that is already stored
+type indexedChapter struct {
+	ID               string
+	ContentHash      string
+	SubsectionHashes []string
+}
+
+func documentHash(doc Document) string {
+	// empty metadata and access hash like none, so that the chapters indexed before them are unchanged
+	if doc.Metadata.IsEmpty() {
+		doc.Metadata = nil
+	}
+	if !doc.Access.IsRestricted() {
+		doc.Access = nil
+	}
+	data, _ := json.Marshal(doc)
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// the source, links, metadata and access are part of the hash of a subsection because they are copied in its chunks
+func subsectionHash(doc Document, subsection Subsection) string {
+	metadata := doc.Metadata
+	if metadata.IsEmpty() {
+		metadata = nil
+	}
+	access := doc.Access
+	if !access.IsRestricted() {
+		access = nil
+	}
+	data, _ := json.Marshal(struct {
+		Source     string    `json:"source"`
+		URL        string    `json:"url,omitempty"`
+		Breadcrumb []string  `json:"breadcrumb,omitempty"`
+		Metadata   *Metadata `json:"metadata,omitempty"`
+		Access     *Access   `json:"access,omitempty"`
+		Subsection
+	}{doc.Source, doc.URL, doc.Breadcrumb, metadata, access, subsection})
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// chapterProperties returns the properties of the chapter object of a document, with the hashes used by the upserts
+func chapterProperties(doc Document) map[string]interface{} {
+	hashes := make([]string, 0, len(doc.Subsections))
+	// the anchors are not part of the nested subsections, they are stored in subsectionAnchors
+	subsections := make([]Subsection, 0, len(doc.Subsections))
+	for _, subsection := range doc.Subsections {
+		hashes = append(hashes, subsectionHash(doc, subsection))
+		subsection.Anchor = ""
+		subsections = append(subsections, subsection)
+	}
+	properties := map[string]interface{}{
+		"chapter":          doc.Chapter,
+		"subsections":      subsections,
+		"source":           doc.Source,
+		"contentHash":      documentHash(doc),
+		"subsectionHashes": hashes,
+		"textHash":         TextHash(doc),
+	}
+	setLinkProperties(properties, doc)
+	setMetadataProperties(properties, doc.Metadata)
+	setAccessProperties(properties, doc.Access)
+	return properties
+}
+
+// UpsertVectors indexes the documents without failing on the chapters that already exist:
+// unchanged chapters are skipped, changed ones are updated in place and only the chunks of
+// their changed subsections are indexed again. With fullSync the chapters that are not in
+// the documents are deleted.
+func (d *VectorsStore) UpsertVectors(ctx context.Context, collection Collection, data *RagData, fullSync bool) (*UpsertReport, error) {
+	report := &UpsertReport{
+		Created:   []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+		Deleted:   []string{},
+	}
+
+	indexed, err := d.indexedChapters(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(data.Documents))
+	for _, doc := range data.Documents {
+		if seen[doc.Chapter] {
+			return nil, fmt.Errorf("chapter %s: %w", doc.Chapter, ErrDuplicateChapter)
+		}
+		seen[doc.Chapter] = true
+	}
+
+	var created []*models.Object
+	var createdChunks []*models.Object
+	for _, doc := range data.Documents {
+		properties := chapterProperties(doc)
+
+		existing, ok := indexed[doc.Chapter]
+		switch {
+		case !ok:
+			chapterID := uuid.New().String()
+			created = append(created, &models.Object{
+				Class:      collection.Class,
+				ID:         strfmt.UUID(chapterID),
+				Tenant:     collection.Tenant,
+				Properties: properties,
+			})
+			for _, chunk := range d.chunking.chunkDocument(chapterID, doc) {
+				createdChunks = append(createdChunks, chunkToObject(chunk, collection))
+			}
+			report.Created = append(report.Created, doc.Chapter)
+
+		case existing.ContentHash == properties["contentHash"]:
+			report.Unchanged = append(report.Unchanged, doc.Chapter)
+
+		default:
+			previous, err := d.GetObjectWithID(ctx, collection.unrestricted(), existing.ID)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.updateChapter(ctx, collection, existing, doc, properties); err != nil {
+				return nil, err
+			}
+			existing.ContentHash = properties["contentHash"].(string)
+			existing.SubsectionHashes = properties["subsectionHashes"].([]string)
+			report.Updated = append(report.Updated, doc.Chapter)
+			report.Changes = append(report.Changes, ChapterChange{ID: existing.ID, Previous: *previous, Current: &doc})
+		}
+	}
+
+	insertCtx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+	if err := d.batchInsert(insertCtx, collection, created); err != nil {
+		return nil, err
+	}
+	if err := d.batchInsert(insertCtx, collection, createdChunks); err != nil {
+		return nil, err
+	}
+
+	if fullSync {
+		for chapter, existing := range indexed {
+			if seen[chapter] {
+				continue
+			}
+			previous, err := d.GetObjectWithID(ctx, collection.unrestricted(), existing.ID)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := d.DeleteObjectWithID(ctx, collection, existing.ID); err != nil {
+				return nil, err
+			}
+			report.Deleted = append(report.Deleted, chapter)
+			report.Changes = append(report.Changes, ChapterChange{ID: existing.ID, Previous: *previous})
+		}
+		sort.Strings(report.Deleted)
+	}
+	return report, nil
+}
+
+// updateChapter replaces the properties of a chapter object, the chunks of the subsections that did not change are kept
+func (d *VectorsStore) updateChapter(ctx context.Context, collection Collection, existing *indexedChapter, doc Document, properties map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	vector, err := d.propertiesVector(ctx, collection, properties)
+	if err != nil {
+		return err
+	}
+	err = d.client.Data().
+		Updater().
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
+		WithID(existing.ID).
+		WithProperties(properties).
+		WithVector(vector).
+		Do(ctx)
+	if err != nil {
+		return fmt.Errorf("error updating object with id %s: %w", existing.ID, err)
+	}
+
+	changed := changedSubsections(existing.SubsectionHashes, properties["subsectionHashes"].([]string))
+
+	for i := range changed {
+		if err := d.deleteSubsectionChunks(ctx, collection, existing.ID, i); err != nil {
+			return fmt.Errorf("error deleting chunks of object with id %s: %w", existing.ID, err)
+		}
+	}
+	var chunkObjects []*models.Object
+	for _, chunk := range d.chunking.chunkDocument(existing.ID, doc) {
+		if changed[chunk.SubsectionIndex] {
+			chunkObjects = append(chunkObjects, chunkToObject(chunk, collection))
+		}
+	}
+	return d.batchInsert(ctx, collection, chunkObjects)
+}
+
+// changedSubsections returns the indexes of the subsections whose hash changed, was added or was removed
+func changedSubsections(oldHashes []string, newHashes []string) map[int]bool {
+	changed := make(map[int]bool)
+	for i := 0; i < max(len(newHashes), len(oldHashes)); i++ {
+		if i >= len(newHashes) || i >= len(oldHashes) || newHashes[i] != oldHashes[i] {
+			changed[i] = true
+		}
+	}
+	return changed
+}
+
+func (d *VectorsStore) deleteSubsectionChunks(ctx context.Context, collection Collection, chapterID string, subsectionIndex int) error {
+	_, err := d.client.Batch().
+		ObjectsBatchDeleter().
+		WithClassName(collection.ChunkClass()).
+		WithTenant(collection.Tenant).
+		WithWhere(filters.Where().
+			WithOperator(filters.And).
+			WithOperands([]*filters.WhereBuilder{
+				filters.Where().
+					WithPath([]string{"chapterId"}).
+					WithOperator(filters.Equal).
+					WithValueText(chapterID),
+				filters.Where().
+					WithPath([]string{"subsectionIndex"}).
+					WithOperator(filters.Equal).
+					WithValueInt(int64(subsectionIndex)),
+			})).
+		Do(ctx)
+	return err
+}
+
+// indexedChapters returns the hashes of every chapter of the collection, by chapter name
+func (d *VectorsStore) indexedChapters(ctx context.Context, collection Collection) (map[string]*indexedChapter, error) {
+	chapters := make(map[string]*indexedChapter)
+	after := ""
+	for {
+		page, err := d.indexedChaptersPage(ctx, collection, after)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page {
+			itemMap, _ := item.(map[string]any)
+			chapter, _ := itemMap["chapter"].(string)
+			contentHash, _ := itemMap["contentHash"].(string)
+			additional, _ := itemMap["_additional"].(map[string]any)
+			id, _ := additional["id"].(string)
+
+			var hashes []string
+			rawHashes, _ := itemMap["subsectionHashes"].([]any)
+			for _, hash := range rawHashes {
+				value, _ := hash.(string)
+				hashes = append(hashes, value)
+			}
+			chapters[chapter] = &indexedChapter{ID: id, ContentHash: contentHash, SubsectionHashes: hashes}
+			after = id
+		}
+		if len(page) < exportPageSize {
+			return chapters, nil
+		}
+	}
+}
+
+func (d *VectorsStore) indexedChaptersPage(ctx context.Context, collection Collection, after string) ([]any, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := d.client.GraphQL().Get().
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
+		WithFields(
+			graphql.Field{Name: "chapter"},
+			graphql.Field{Name: "contentHash"},
+			graphql.Field{Name: "subsectionHashes"},
+			graphql.Field{Name: "_additional", Fields: []graphql.Field{{Name: "id"}}},
+		).
+		WithLimit(exportPageSize)
+	if after != "" {
+		query = query.WithAfter(after)
+	}
+
+	response, err := query.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL response error: %s", response.Errors[0].Message)
+	}
+	getData, ok := response.Data["Get"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid response structure: missing 'Get' key")
+	}
+	page, _ := getData[collection.Class].([]any)
+	return page, nil
+}
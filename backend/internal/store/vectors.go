@@ -3,10 +3,15 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 
+	"github.com/go-openapi/strfmt"
+	"github.com/google/uuid"
+	"github.com/mik-dmi/rag_chatbot/backend/internal/embedding"
 	"github.com/weaviate/weaviate-go-client/v4/weaviate"
 	"github.com/weaviate/weaviate-go-client/v4/weaviate/filters"
 	"github.com/weaviate/weaviate-go-client/v4/weaviate/graphql"
@@ -23,14 +28,24 @@ type RagData struct {
 type Document struct {
 	Chapter     string       `json:"chapter"`
 	Subsections []Subsection `json:"subsections"`
+	Source      string       `json:"source,omitempty"` // name of the file the chapter was imported from
+	Metadata    *Metadata    `json:"metadata,omitempty"`
+	Access      *Access      `json:"access,omitempty"`
+	URL         string       `json:"url,omitempty"`        // canonical url of the chapter in the published documentation
+	Breadcrumb  []string     `json:"breadcrumb,omitempty"` // path of the chapter in the documentation, without the chapter itself
 }
 type Subsection struct {
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	Pages   []int  `json:"pages,omitempty"`  // pages of the source file the subsection was found on
+	Anchor  string `json:"anchor,omitempty"` // fragment of the subsection in the page of the chapter url
 }
 
 type VectorsStore struct {
-	client *weaviate.Client
+	client    *weaviate.Client
+	chunking  ChunkingConfig
+	retrieval RetrievalConfig
+	embedder  embedding.Embedder // used by the collections without a weaviate vectorizer
 }
 
 type Query struct {
@@ -43,18 +58,6 @@ type VectorCreatedResponse struct {
 	ChaptersCreated []string `json:"list_of_chapters_created"`
 }
 
-type GraphQLResponse struct {
-	Data struct {
-		Get struct {
-			Book []struct {
-				Additional struct {
-					ID string `json:"id"`
-				} `json:"_additional"`
-			} `json:"Book"`
-		} `json:"Get"`
-	} `json:"data"`
-}
-
 type IDResponse struct {
 	Id string `json:"id"`
 }
@@ -63,16 +66,19 @@ type SuccessfullyAPIOperation struct {
 	Message string `json:"message"`
 }
 
-func (d *VectorsStore) CreateVectors(ctx context.Context, data *RagData) (*VectorCreatedResponse, error) {
+func (d *VectorsStore) CreateVectors(ctx context.Context, collection Collection, data *RagData) (*VectorCreatedResponse, error) {
 	var objects []*models.Object
+	var chunkObjects []*models.Object
 	var chaptersCreated []string
 
-	// Check if Chapter of data already exists
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	// the chapters are embedded and written in the deadline of the caller, WriteTimeoutDuration without one
+	ctx, cancel := writeContext(ctx)
 	defer cancel()
 
+	// Check if Chapter of data already exists
+
 	for _, doc := range data.Documents {
-		ok, err := d.chapterExists(ctx, doc.Chapter)
+		ok, err := d.chapterExists(ctx, collection, doc.Chapter)
 		if err != nil {
 			return nil, fmt.Errorf("error checking if a chapter already exits in weaviate: %w", err)
 		}
@@ -82,28 +88,32 @@ func (d *VectorsStore) CreateVectors(ctx context.Context, data *RagData) (*Vecto
 			return nil, fmt.Errorf("error: chapter %s %w", doc.Chapter, ErrChapterAlreadyExists)
 		}
 
-		var subs []Subsection
-		for _, subsection := range doc.Subsections {
-			subs = append(subs, Subsection{
-				Title:   subsection.Title,
-				Content: subsection.Content,
-			})
-		}
-
+		chapterID := uuid.New().String()
 		obj := &models.Object{
-			Class: "Book",
-			Properties: map[string]interface{}{
-				"chapter":     doc.Chapter,
-				"subsections": subs,
-			},
+			Class:      collection.Class,
+			ID:         strfmt.UUID(chapterID),
+			Tenant:     collection.Tenant,
+			Properties: chapterProperties(doc),
 		}
 		objects = append(objects, obj)
 		chaptersCreated = append(chaptersCreated, doc.Chapter)
 
+		// every subsection is also stored as one or more chunks that reference the chapter
+		for _, chunk := range d.chunking.chunkDocument(chapterID, doc) {
+			chunkObjects = append(chunkObjects, chunkToObject(chunk, collection))
+		}
+	}
+	// weaviate has no transactions, the chapters are removed again when the batch fails part way,
+	// so that retrying the chapters does not find them already existing
+	err := d.batchInsert(ctx, collection, objects)
+	if err == nil {
+		err = d.batchInsert(ctx, collection, chunkObjects)
 	}
-	_, err := d.client.Batch().ObjectsBatcher().WithObjects(objects...).Do(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("batch insert failed: %w", err)
+		if rollbackErr := d.rollbackChapters(ctx, collection, objects); rollbackErr != nil {
+			return nil, errors.Join(err, rollbackErr)
+		}
+		return nil, err
 	}
 
 	jsonChapters := VectorCreatedResponse{
@@ -113,45 +123,40 @@ func (d *VectorsStore) CreateVectors(ctx context.Context, data *RagData) (*Vecto
 	return &jsonChapters, nil
 }
 
-func (d *VectorsStore) GetClosestVectors(ctx context.Context, query string) ([]*Document, error) {
+// GetClosestVectors returns the chapters of the chunks closest to the query, best first, only from the documents matching the filter when it is not nil
+func (d *VectorsStore) GetClosestVectors(ctx context.Context, collection Collection, query string, filter *MetadataFilter) ([]*RetrievalHit, error) {
 	maxDistance := float32(0.5) //max similarity threshold
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	graphQLResponse, err := d.client.GraphQL().Get().
-		WithClassName("Book").
-		WithFields(
-			graphql.Field{Name: "chapter"},
-			graphql.Field{
-				Name: "subsections",
-				Fields: []graphql.Field{
-					{Name: "title"},
-					{Name: "content"},
-				},
-			},
-		).
-		WithNearText(d.client.GraphQL().NearTextArgBuilder().
-			WithConcepts([]string{query}).
-			WithDistance(maxDistance)).
-		WithLimit(5).
-		Do(ctx)
 
+	nearVector, err := d.nearVector(ctx, collection, query, maxDistance)
 	if err != nil {
 		return nil, err
 	}
+	get := d.client.GraphQL().Get().
+		WithClassName(collection.ChunkClass()).
+		WithTenant(collection.Tenant).
+		WithFields(chunkGraphQLFields("distance", "certainty", "score", "explainScore", "vector")...).
+		WithLimit(d.retrieval.normalized().Candidates)
+	if where := andWhere(filter.where(), accessWhere(collection.Reader)); where != nil {
+		get = get.WithWhere(where)
+	}
+	// the collections without a weaviate vectorizer are searched with the vector of the app embedder
+	if nearVector != nil {
+		get = get.WithNearVector(nearVector)
+	} else {
+		get = get.WithNearText(d.client.GraphQL().NearTextArgBuilder().
+			WithConcepts([]string{query}).
+			WithDistance(maxDistance))
+	}
+	graphQLResponse, err := get.Do(ctx)
 
-	//
-	jsonBytes, err := graphQLResponse.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
 
-	jsonStr := string(jsonBytes)
-	fmt.Println("Response from jsonStr:", jsonStr)
-
-	//
-
-	response, err := parserGraphQLResponseToResponse(graphQLResponse)
+	response, err := d.parserGraphQLResponseToResponse(graphQLResponse, collection.ChunkClass())
 	if err != nil {
 		return nil, err
 	}
@@ -160,61 +165,83 @@ func (d *VectorsStore) GetClosestVectors(ctx context.Context, query string) ([]*
 	return response, nil
 }
 
-func (d *VectorsStore) GetObjectIDByChapter(ctx context.Context, query string) (*IDResponse, error) {
+func (d *VectorsStore) GetObjectIDByChapter(ctx context.Context, collection Collection, query string) (*IDResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	result, err := d.client.GraphQL().Get().
-		WithClassName("Book").
-		WithWhere(
-			filters.Where().
-				WithPath([]string{"chapter"}).
-				WithOperator(filters.Equal).
-				WithValueText(query),
-		).
-		WithFields(
-			graphql.Field{
-				Name: "_additional",
-				Fields: []graphql.Field{
-					{
-						Name: "id",
-					},
-				},
-			},
-		).
-		Do(ctx)
+
+	ids, err := d.chapterIDs(ctx, collection, query, collection.Reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get object by chapter %s: %w", query, err)
 	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no object found for chapter %s: %w", query, ErrNotFound)
+	}
+	return &IDResponse{Id: ids[0]}, nil
+}
 
-	// Unmarshal the response into the struct
-	jsonBytes, err := result.MarshalBinary()
+// GetObjectWithID returns the document stored in a chapter object
+func (d *VectorsStore) GetObjectWithID(ctx context.Context, collection Collection, id string) (*Document, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	exists, err := d.client.Data().Checker().WithClassName(collection.Class).WithTenant(collection.Tenant).WithID(id).Do(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error checking if object with id %s exists: %w", id, err)
 	}
-
-	var response GraphQLResponse
-	if err := json.Unmarshal(jsonBytes, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response JSON: %w", err)
+	if !exists {
+		return nil, fmt.Errorf("object with id %s: %w", id, ErrNotFound)
 	}
 
-	if len(response.Data.Get.Book) > 0 {
-		objIDResponse := &IDResponse{
-			Id: response.Data.Get.Book[0].Additional.ID,
-		}
-		fmt.Println(objIDResponse)
-
-		return objIDResponse, nil
+	objects, err := d.client.Data().ObjectsGetter().
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
+		WithID(id).
+		Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s retrieving object with id %s", err.Error(), id)
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("object with id %s: %w", id, ErrNotFound)
+	}
+	// a document the reader can not access is reported as not found, so that its existence is not leaked
+	properties, _ := objects[0].Properties.(map[string]interface{})
+	access := accessFromProperties(properties)
+	if !access.Allows(collection.Reader) {
+		return nil, fmt.Errorf("object with id %s: %w", id, ErrNotFound)
 	}
 
-	return nil, fmt.Errorf("no object found for chapter: %s", query)
+	// the properties have the same names as the json fields of the document
+	propertiesJSON, err := json.Marshal(objects[0].Properties)
+	if err != nil {
+		return nil, err
+	}
+	document := &Document{}
+	if err := json.Unmarshal(propertiesJSON, document); err != nil {
+		return nil, err
+	}
+	// the metadata are stored as properties of their own so that they can be filtered
+	document.Metadata, err = metadataFromJSON(propertiesJSON)
+	if err != nil {
+		return nil, err
+	}
+	document.Access = access
+	var links struct {
+		SubsectionAnchors []string `json:"subsectionAnchors"`
+	}
+	if err := json.Unmarshal(propertiesJSON, &links); err != nil {
+		return nil, err
+	}
+	setSubsectionAnchors(document, links.SubsectionAnchors)
+	return document, nil
 }
 
-func (d *VectorsStore) DeleteObjectWithID(ctx context.Context, idToDelete string) (*SuccessfullyAPIOperation, error) {
+func (d *VectorsStore) DeleteObjectWithID(ctx context.Context, collection Collection, idToDelete string) (*SuccessfullyAPIOperation, error) {
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 	obj, err := d.client.Data().ObjectsGetter().
-		WithClassName("Book").
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
 		WithID(idToDelete).
 		Do(ctx)
 	if err != nil {
@@ -226,7 +253,8 @@ func (d *VectorsStore) DeleteObjectWithID(ctx context.Context, idToDelete string
 
 	err = d.client.Data().
 		Deleter().
-		WithClassName("Book").
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
 		WithID(idToDelete).
 		Do(ctx)
 
@@ -234,6 +262,10 @@ func (d *VectorsStore) DeleteObjectWithID(ctx context.Context, idToDelete string
 		return nil, fmt.Errorf("error deleting object with id %s: %w", idToDelete, err)
 	}
 
+	if err := d.deleteChunksWhere(ctx, collection, "chapterId", idToDelete); err != nil {
+		return nil, fmt.Errorf("error deleting chunks of object with id %s: %w", idToDelete, err)
+	}
+
 	response := &SuccessfullyAPIOperation{
 		Message: "Object deleted successfully ",
 	}
@@ -241,12 +273,13 @@ func (d *VectorsStore) DeleteObjectWithID(ctx context.Context, idToDelete string
 	return response, nil
 }
 
-func (d *VectorsStore) UpdateObjectWithID(ctx context.Context, updatedDocuments Document, idToUpdate string) (*SuccessfullyAPIOperation, error) {
+func (d *VectorsStore) UpdateObjectWithID(ctx context.Context, collection Collection, updatedDocuments Document, idToUpdate string) (*SuccessfullyAPIOperation, error) {
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 	obj, err := d.client.Data().ObjectsGetter().
-		WithClassName("Book").
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
 		WithID(idToUpdate).
 		Do(ctx)
 	if err != nil {
@@ -256,17 +289,36 @@ func (d *VectorsStore) UpdateObjectWithID(ctx context.Context, updatedDocuments
 		return nil, fmt.Errorf("error updating object with id %s, it does not exist: %w", idToUpdate, ErrNotFound)
 	}
 
+	properties := chapterProperties(updatedDocuments)
+	vector, err := d.propertiesVector(ctx, collection, properties)
+	if err != nil {
+		return nil, err
+	}
 	err = d.client.Data().
 		Updater().
-		WithClassName("Book").
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
 		WithID(idToUpdate).
-		WithProperties(updatedDocuments).
+		WithProperties(properties).
+		WithVector(vector).
 		Do(ctx)
 
 	if err != nil {
 		return nil, fmt.Errorf("error updating object with id %s: %w", idToUpdate, err)
 	}
 
+	// the chunks of the old version are replaced by the chunks of the updated document
+	if err := d.deleteChunksWhere(ctx, collection, "chapterId", idToUpdate); err != nil {
+		return nil, fmt.Errorf("error deleting chunks of object with id %s: %w", idToUpdate, err)
+	}
+	var chunkObjects []*models.Object
+	for _, chunk := range d.chunking.chunkDocument(idToUpdate, updatedDocuments) {
+		chunkObjects = append(chunkObjects, chunkToObject(chunk, collection))
+	}
+	if err := d.batchInsert(ctx, collection, chunkObjects); err != nil {
+		return nil, err
+	}
+
 	response := &SuccessfullyAPIOperation{
 		Message: "Object updated successfully",
 	}
@@ -275,43 +327,40 @@ func (d *VectorsStore) UpdateObjectWithID(ctx context.Context, updatedDocuments
 }
 
 // there is no endpoint for this action in the api
-func (d *VectorsStore) DeleteChapterWithChapterName(ctx context.Context, chapterName string) (*SuccessfullyAPIOperation, error) {
+func (d *VectorsStore) DeleteChapterWithChapterName(ctx context.Context, collection Collection, chapterName string) (*SuccessfullyAPIOperation, error) {
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	ok, err := d.chapterExists(ctx, chapterName)
+	ids, err := d.chapterIDs(ctx, collection, chapterName, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error checking if a chapter already exits in weaviate: %w", err)
 	}
-	if !ok {
+	if len(ids) == 0 {
 		return nil, fmt.Errorf("error can not delete chapter, chapter %s does not exits: %w", chapterName, ErrNotFound)
 	}
-	result, err := d.client.Batch().
-		ObjectsBatchDeleter().
-		WithClassName("Book").
-		WithWhere(
-			filters.Where().
-				WithPath([]string{"chapter"}).
-				WithOperator(filters.Equal).
-				WithValueText(chapterName),
-		).
-		WithOutput("verbose").
-		Do(ctx)
-
-	if err != nil {
-		return nil, err
+	// the chapters are deleted by id, a filter on the name would also delete the chapters with more words
+	for _, id := range ids {
+		err := d.client.Data().Deleter().
+			WithClassName(collection.Class).
+			WithTenant(collection.Tenant).
+			WithID(id).
+			Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error deleting chapter %s: %w", chapterName, err)
+		}
+		if err := d.deleteChunksWhere(ctx, collection, "chapterId", id); err != nil {
+			return nil, fmt.Errorf("error deleting chunks of chapter %s: %w", chapterName, err)
+		}
 	}
 
-	fmt.Print(result)
-
 	response := &SuccessfullyAPIOperation{
-		Message: *result.Output,
+		Message: fmt.Sprintf("%d objects deleted", len(ids)),
 	}
 
 	return response, nil
 }
 
-func parserGraphQLResponseToResponse(res *models.GraphQLResponse) ([]*Document, error) {
+func (d *VectorsStore) parserGraphQLResponseToResponse(res *models.GraphQLResponse, className string) ([]*RetrievalHit, error) {
 	if len(res.Errors) > 0 {
 		messages := make([]string, 0, len(res.Errors))
 		for _, e := range res.Errors {
@@ -325,94 +374,265 @@ func parserGraphQLResponseToResponse(res *models.GraphQLResponse) ([]*Document,
 		return nil, fmt.Errorf("invalid response structure: missing 'Get' key")
 	}
 
-	rawBooks, ok := getData["Book"].([]any)
-	if !ok || len(rawBooks) == 0 {
+	rawChunks, ok := getData[className].([]any)
+	if !ok || len(rawChunks) == 0 {
 		return nil, ErrNotFound
 	}
 
-	// Group results by chapter.
-	chapterMap := make(map[string]*Document)
-	for _, item := range rawBooks {
+	chunks := make([]Chunk, 0, len(rawChunks))
+	vectors := make([][]float32, 0, len(rawChunks))
+	for _, item := range rawChunks {
 		itemMap, ok := item.(map[string]any)
 		if !ok {
 			return nil, fmt.Errorf("invalid item format in response")
 		}
+		chunk, err := chunkFromGraphQL(itemMap)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+
+		// the vectors of the candidates are compared with each other to diversify the context
+		var vector []float32
+		additional, _ := itemMap["_additional"].(map[string]any)
+		rawVector, _ := additional["vector"].([]any)
+		for _, value := range rawVector {
+			number, _ := value.(float64)
+			vector = append(vector, float32(number))
+		}
+		vectors = append(vectors, vector)
+	}
 
-		/*
-			Check if the fields are nested under "properties". If yes, use that.
-			var props map[string]any
-			if p, exists := itemMap["properties"].(map[string]any); exists {
-				fmt.Println("Has properties")
-				props = p
-			} else {
-				fmt.Println("Does not have properties")
-				props = itemMap
-			}*/
-
-		chapter, _ := itemMap["chapter"].(string)
+	return d.chunking.chunksToHits(d.retrieval.diversify(chunks, vectors)), nil
+}
 
-		subsectionsRaw, ok := itemMap["subsections"].([]any)
-		if !ok {
-			subsectionsRaw = []any{}
-		}
-		var subs []Subsection
-		for _, subItem := range subsectionsRaw {
-			subMap, ok := subItem.(map[string]any)
-			if !ok {
-				continue
-			}
-			title, _ := subMap["title"].(string)
-			content, _ := subMap["content"].(string)
-			subs = append(subs, Subsection{
-				Title:   title,
-				Content: content,
-			})
+// chunkGraphQLFields are the properties of the retrieved chunks, with the additional fields of the search
+func chunkGraphQLFields(additional ...string) []graphql.Field {
+	fields := append([]graphql.Field{
+		{Name: "chapterId"},
+		{Name: "chapter"},
+		{Name: "title"},
+		{Name: "content"},
+		{Name: "subsectionIndex"},
+		{Name: "chunkIndex"},
+		{Name: "source"},
+		{Name: "pages"},
+		{Name: "url"},
+		{Name: "anchor"},
+		{Name: "breadcrumb"},
+	}, metadataGraphQLFields()...)
+	if len(additional) > 0 {
+		additionalFields := make([]graphql.Field, 0, len(additional))
+		for _, name := range additional {
+			additionalFields = append(additionalFields, graphql.Field{Name: name})
 		}
+		fields = append(fields, graphql.Field{Name: "_additional", Fields: additionalFields})
+	}
+	return fields
+}
 
-		if doc, exists := chapterMap[chapter]; exists {
-			doc.Subsections = append(doc.Subsections, subs...)
-		} else {
-			chapterMap[chapter] = &Document{
-				Chapter:     chapter,
-				Subsections: subs,
-			}
+// chunkFromGraphQL reads a chunk object of a graphql response, with its scores when they were asked for
+func chunkFromGraphQL(itemMap map[string]any) (Chunk, error) {
+	chapter, _ := itemMap["chapter"].(string)
+	chapterID, _ := itemMap["chapterId"].(string)
+	title, _ := itemMap["title"].(string)
+	content, _ := itemMap["content"].(string)
+	source, _ := itemMap["source"].(string)
+	url, _ := itemMap["url"].(string)
+	anchor, _ := itemMap["anchor"].(string)
+	additional, _ := itemMap["_additional"].(map[string]any)
+
+	var breadcrumb []string
+	rawBreadcrumb, _ := itemMap["breadcrumb"].([]any)
+	for _, crumb := range rawBreadcrumb {
+		if value, ok := crumb.(string); ok {
+			breadcrumb = append(breadcrumb, value)
 		}
 	}
 
-	documents := make([]*Document, 0, len(chapterMap))
-	for _, doc := range chapterMap {
-		documents = append(documents, doc)
+	var pages []int
+	rawPages, _ := itemMap["pages"].([]any)
+	for _, page := range rawPages {
+		pages = append(pages, toInt(page))
+	}
+
+	itemJSON, err := json.Marshal(itemMap)
+	if err != nil {
+		return Chunk{}, err
+	}
+	metadata, err := metadataFromJSON(itemJSON)
+	if err != nil {
+		return Chunk{}, err
 	}
 
-	return documents, nil
+	chunk := Chunk{
+		ChapterID:       chapterID,
+		Chapter:         chapter,
+		Title:           title,
+		Content:         content,
+		SubsectionIndex: toInt(itemMap["subsectionIndex"]),
+		ChunkIndex:      toInt(itemMap["chunkIndex"]),
+		Source:          source,
+		Pages:           pages,
+		Metadata:        metadata,
+		URL:             url,
+		Anchor:          anchor,
+		Breadcrumb:      breadcrumb,
+	}
+	if distance, ok := additional["distance"].(float64); ok {
+		chunk.setDistance(distance)
+	} else if score, ok := additional["score"].(string); ok {
+		// the bm25 and hybrid searches have no distance, their scores are sent as strings
+		chunk.Score, _ = strconv.ParseFloat(score, 64)
+	}
+	if certainty, ok := additional["certainty"].(float64); ok {
+		chunk.Certainty = certainty
+	}
+	chunk.ExplainScore, _ = additional["explainScore"].(string)
+	return chunk, nil
 }
 
 // false = chapter not found / true = chapter found
-func (d *VectorsStore) chapterExists(ctx context.Context, chapter string) (bool, error) {
+func (d *VectorsStore) chapterExists(ctx context.Context, collection Collection, chapter string) (bool, error) {
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
+	ids, err := d.chapterIDs(ctx, collection, chapter, nil)
+	if err != nil {
+		return false, err
+	}
+	return len(ids) > 0, nil
+}
+
+// maxChapterNameMatches bounds the chapters read to find the ones with a name
+const maxChapterNameMatches = 1000
+
+// chapterIDs returns the ids of the chapters named exactly chapter that the reader can read, every chapter with a nil reader.
+// The classes created before the chapter property was tokenized as a whole value match every chapter with the
+// words of the name, so the names are compared again here.
+func (d *VectorsStore) chapterIDs(ctx context.Context, collection Collection, chapter string, reader *Principal) ([]string, error) {
 	response, err := d.client.GraphQL().Get().
-		WithClassName("Book").
-		WithFields(graphql.Field{Name: "chapter"}).
-		WithWhere(filters.Where().
-			WithPath([]string{"chapter"}).
-			WithOperator(filters.Equal).
-			WithValueString(chapter)).
-		WithLimit(1).
+		WithClassName(collection.Class).
+		WithTenant(collection.Tenant).
+		WithFields(
+			graphql.Field{Name: "chapter"},
+			graphql.Field{Name: "_additional", Fields: []graphql.Field{{Name: "id"}}},
+		).
+		WithWhere(andWhere(
+			filters.Where().
+				WithPath([]string{"chapter"}).
+				WithOperator(filters.Equal).
+				WithValueText(chapter),
+			accessWhere(reader),
+		)).
+		WithLimit(maxChapterNameMatches).
 		Do(ctx)
 	if err != nil {
-
-		return false, err
+		return nil, err
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL response error: %s", response.Errors[0].Message)
 	}
 	getData, ok := response.Data["Get"].(map[string]any)
 	if !ok {
-		return false, fmt.Errorf("invalid response structure: missing 'Get'")
+		return nil, fmt.Errorf("invalid response structure: missing 'Get'")
+	}
+	rawChapters, _ := getData[collection.Class].([]any)
+
+	var ids []string
+	for _, item := range rawChapters {
+		itemMap, _ := item.(map[string]any)
+		if name, _ := itemMap["chapter"].(string); name != chapter {
+			continue
+		}
+		additional, _ := itemMap["_additional"].(map[string]any)
+		if id, _ := additional["id"].(string); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (d *VectorsStore) batchInsert(ctx context.Context, collection Collection, objects []*models.Object) error {
+	if len(objects) == 0 {
+		return nil
 	}
-	rawBooks, ok := getData["Book"].([]any)
-	if !ok || len(rawBooks) == 0 {
-		return false, nil
+	if err := d.embedObjects(ctx, collection, objects); err != nil {
+		return err
+	}
+	results, err := d.client.Batch().ObjectsBatcher().WithObjects(objects...).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("batch insert failed: %w", err)
+	}
+	for _, res := range results {
+		if res.Result == nil || res.Result.Errors == nil {
+			continue
+		}
+		for _, e := range res.Result.Errors.Error {
+			return fmt.Errorf("batch insert failed for object %s: %s", res.ID, e.Message)
+		}
+	}
+	return nil
+}
+
+// rollbackChapters deletes the chapter objects of a failed insert and the chunks already stored for them
+func (d *VectorsStore) rollbackChapters(ctx context.Context, collection Collection, objects []*models.Object) error {
+	// the insert may have failed because its context expired, the rollback gets its own time
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), QueryTimeoutDuration)
+	defer cancel()
+
+	var errs []error
+	for _, obj := range objects {
+		id := obj.ID.String()
+		exists, err := d.client.Data().Checker().WithClassName(collection.Class).WithTenant(collection.Tenant).WithID(id).Do(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error rolling back chapter %s: %w", id, err))
+			continue
+		}
+		if exists {
+			err := d.client.Data().Deleter().
+				WithClassName(collection.Class).
+				WithTenant(collection.Tenant).
+				WithID(id).
+				Do(ctx)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error rolling back chapter %s: %w", id, err))
+				continue
+			}
+		}
+		if err := d.deleteChunksWhere(ctx, collection, "chapterId", id); err != nil {
+			errs = append(errs, fmt.Errorf("error rolling back chunks of chapter %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *VectorsStore) deleteChunksWhere(ctx context.Context, collection Collection, property string, value string) error {
+	_, err := d.client.Batch().
+		ObjectsBatchDeleter().
+		WithClassName(collection.ChunkClass()).
+		WithTenant(collection.Tenant).
+		WithWhere(
+			filters.Where().
+				WithPath([]string{property}).
+				WithOperator(filters.Equal).
+				WithValueText(value),
+		).
+		Do(ctx)
+	return err
+}
+
+// numbers in graphql responses are decoded as float64
+func toInt(value any) int {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case json.Number:
+		n, _ := v.Int64()
+		return int(n)
 	}
-	return true, nil
+	return 0
 }
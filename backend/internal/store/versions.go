@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+)
+
+const (
+	VersionActionOriginal = "original" // text of a chapter before its first recorded change
+	VersionActionUpdate   = "update"
+	VersionActionRollback = "rollback"
+	VersionActionDelete   = "delete"
+
+	SubsectionAdded    = "added"
+	SubsectionRemoved  = "removed"
+	SubsectionModified = "modified"
+)
+
+type VersionsStore struct {
+	client *sql.DB
+}
+
+// ChapterVersion is the text of a chapter after one of its changes
+type ChapterVersion struct {
+	ID            string        `json:"id"`
+	KnowledgeBase string        `json:"knowledge_base"`
+	Tenant        string        `json:"-"`
+	ObjectID      string        `json:"object_id"`
+	Version       int           `json:"version"`
+	Action        string        `json:"action"`
+	UserID        string        `json:"user_id"`
+	Document      Document      `json:"document"`
+	Diff          *DocumentDiff `json:"diff,omitempty"`
+	CreatedAt     string        `json:"created_at"`
+}
+
+// DocumentDiff lists what changed between two versions of a chapter, subsections are matched by title
+type DocumentDiff struct {
+	ChapterFrom  string           `json:"chapter_from,omitempty"`
+	ChapterTo    string           `json:"chapter_to,omitempty"`
+	SourceFrom   string           `json:"source_from,omitempty"`
+	SourceTo     string           `json:"source_to,omitempty"`
+	MetadataFrom *Metadata        `json:"metadata_from,omitempty"`
+	MetadataTo   *Metadata        `json:"metadata_to,omitempty"`
+	AccessFrom   *Access          `json:"access_from,omitempty"`
+	AccessTo     *Access          `json:"access_to,omitempty"`
+	Subsections  []SubsectionDiff `json:"subsections"`
+}
+
+type SubsectionDiff struct {
+	Title      string `json:"title"`
+	Change     string `json:"change"`
+	ContentOld string `json:"content_old,omitempty"`
+	ContentNew string `json:"content_new,omitempty"`
+}
+
+func DiffDocuments(from Document, to Document) *DocumentDiff {
+	diff := &DocumentDiff{
+		Subsections: []SubsectionDiff{},
+	}
+	if from.Chapter != to.Chapter {
+		diff.ChapterFrom = from.Chapter
+		diff.ChapterTo = to.Chapter
+	}
+	if from.Source != to.Source {
+		diff.SourceFrom = from.Source
+		diff.SourceTo = to.Source
+	}
+	if !reflect.DeepEqual(from.Metadata, to.Metadata) {
+		diff.MetadataFrom = from.Metadata
+		diff.MetadataTo = to.Metadata
+	}
+	if !reflect.DeepEqual(from.Access, to.Access) {
+		diff.AccessFrom = from.Access
+		diff.AccessTo = to.Access
+	}
+
+	oldContent := make(map[string]string, len(from.Subsections))
+	for _, subsection := range from.Subsections {
+		oldContent[subsection.Title] = subsection.Content
+	}
+	newTitles := make(map[string]bool, len(to.Subsections))
+
+	// the subsections keep the order of the new version, the removed ones are listed at the end
+	for _, subsection := range to.Subsections {
+		newTitles[subsection.Title] = true
+		content, ok := oldContent[subsection.Title]
+		switch {
+		case !ok:
+			diff.Subsections = append(diff.Subsections, SubsectionDiff{
+				Title:      subsection.Title,
+				Change:     SubsectionAdded,
+				ContentNew: subsection.Content,
+			})
+		case content != subsection.Content:
+			diff.Subsections = append(diff.Subsections, SubsectionDiff{
+				Title:      subsection.Title,
+				Change:     SubsectionModified,
+				ContentOld: content,
+				ContentNew: subsection.Content,
+			})
+		}
+	}
+	for _, subsection := range from.Subsections {
+		if !newTitles[subsection.Title] {
+			diff.Subsections = append(diff.Subsections, SubsectionDiff{
+				Title:      subsection.Title,
+				Change:     SubsectionRemoved,
+				ContentOld: subsection.Content,
+			})
+		}
+	}
+	return diff
+}
+
+// Create stores the next version of a chapter, the version number is set from the versions already stored
+func (s *VersionsStore) Create(ctx context.Context, version *ChapterVersion) error {
+	query := `
+	INSERT INTO chapter_versions (knowledge_base, tenant, object_id, version, action, user_id, document, diff)
+	SELECT $1, $2, $3, COALESCE(MAX(version), 0) + 1, $4, $5, $6, $7
+	FROM chapter_versions
+	WHERE knowledge_base = $1 AND tenant = $2 AND object_id = $3
+	RETURNING id, version, created_at
+	`
+	// the versions of a chapter are numbered one at a time, the lock is released with the transaction
+	lockQuery := `SELECT pg_advisory_xact_lock(hashtext($1 || '/' || $2 || '/' || $3))`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	documentJSON, err := json.Marshal(version.Document)
+	if err != nil {
+		return err
+	}
+	var diffJSON []byte
+	if version.Diff != nil {
+		diffJSON, err = json.Marshal(version.Diff)
+		if err != nil {
+			return err
+		}
+	}
+
+	return withTx(s.client, ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, lockQuery, version.KnowledgeBase, version.Tenant, version.ObjectID); err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, query,
+			version.KnowledgeBase,
+			version.Tenant,
+			version.ObjectID,
+			version.Action,
+			version.UserID,
+			documentJSON,
+			diffJSON,
+		).Scan(
+			&version.ID,
+			&version.Version,
+			&version.CreatedAt,
+		)
+	})
+}
+
+// List returns the versions of a chapter, the newest first
+func (s *VersionsStore) List(ctx context.Context, knowledgeBase string, tenant string, objectID string) ([]*ChapterVersion, error) {
+	query := `
+	SELECT id, knowledge_base, tenant, object_id, version, action, user_id, document, diff, created_at
+	FROM chapter_versions
+	WHERE knowledge_base = $1 AND tenant = $2 AND object_id = $3
+	ORDER BY version DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.client.QueryContext(ctx, query, knowledgeBase, tenant, objectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*ChapterVersion
+	for rows.Next() {
+		version, err := scanChapterVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+func (s *VersionsStore) GetByVersion(ctx context.Context, knowledgeBase string, tenant string, objectID string, version int) (*ChapterVersion, error) {
+	query := `
+	SELECT id, knowledge_base, tenant, object_id, version, action, user_id, document, diff, created_at
+	FROM chapter_versions
+	WHERE knowledge_base = $1 AND tenant = $2 AND object_id = $3 AND version = $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	chapterVersion, err := scanChapterVersion(s.client.QueryRowContext(ctx, query, knowledgeBase, tenant, objectID, version))
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return chapterVersion, nil
+}
+
+func scanChapterVersion(row rowScanner) (*ChapterVersion, error) {
+	version := &ChapterVersion{}
+	var documentJSON, diffJSON []byte
+	err := row.Scan(
+		&version.ID,
+		&version.KnowledgeBase,
+		&version.Tenant,
+		&version.ObjectID,
+		&version.Version,
+		&version.Action,
+		&version.UserID,
+		&documentJSON,
+		&diffJSON,
+		&version.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(documentJSON, &version.Document); err != nil {
+		return nil, err
+	}
+	if diffJSON != nil {
+		version.Diff = &DocumentDiff{}
+		if err := json.Unmarshal(diffJSON, version.Diff); err != nil {
+			return nil, err
+		}
+	}
+	return version, nil
+}